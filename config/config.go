@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"text/template"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// Config is the configuration of controller in yaml or json, fields in
+// Features, Workers and EndpointsWindow only take effect after restart
+type Config struct {
+	ClusterDomain        string          `json:"clusterDomain"`
+	ClusterDomainAliases []string        `json:"clusterDomainAliases,omitempty"`
+	ServiceIPRange       string          `json:"serviceIPRange"`
+	PodIPRange           string          `json:"podIPRange"`
+	DNSServer            string          `json:"dnsServer"`
+	GRPCServer           string          `json:"grpcServer"`
+	OwnerID              string          `json:"ownerID"`
+	OwnerQueryServer     string          `json:"ownerQueryServer"`
+	TTL                  uint32          `json:"ttl"`
+	IngressTarget        string          `json:"ingressTarget"`
+	CanonicalPTR         bool            `json:"canonicalPTR"`
+	FlattenExternalNames bool            `json:"flattenExternalNames"`
+	Namespaces           NamespaceFilter `json:"namespaces"`
+	ServiceSelector      string          `json:"serviceSelector,omitempty"`
+	Naming               []NamingScheme  `json:"naming,omitempty"`
+	Features             Features        `json:"features"`
+	Workers              int             `json:"workers"`
+	EndpointsWindow      Duration        `json:"endpointsWindow"`
+	EndpointsMaxWait     Duration        `json:"endpointsMaxWait"`
+}
+
+// services in namespaces of Exclude are ignored, if Include isn't empty,
+// only services in these namespaces are published, Selector selects
+// namespaces by labels
+type NamespaceFilter struct {
+	Include  []string `json:"include,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+	Selector string   `json:"selector,omitempty"`
+}
+
+// NamingScheme is go templates of names of services, endpoints addresses
+// and ports in zone, names of all the schemes are published, empty zone is
+// cluster domain and empty template uses the default one like
+// "{{.Service}}.{{.Namespace}}.svc.{{.Zone}}". Templates are rendered with
+// Service, Namespace, Hostname, Port, Protocol and Zone
+type NamingScheme struct {
+	Zone      string `json:"zone,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Endpoints string `json:"endpoints,omitempty"`
+	Port      string `json:"port,omitempty"`
+}
+
+type Features struct {
+	WatchIngress     bool     `json:"watchIngress"`
+	WatchDNSResource bool     `json:"watchDNSResource"`
+	WatchPods        bool     `json:"watchPods"`
+	ViewIsolation    bool     `json:"viewIsolation"`
+	ViewLabel        string   `json:"viewLabel,omitempty"`
+	SharedNamespaces []string `json:"sharedNamespaces,omitempty"`
+}
+
+// Parse overrides fields of base with the ones in data, unknown fields are
+// rejected
+func Parse(data []byte, base Config) (*Config, error) {
+	cfg := base
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config failed:%s", err.Error())
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) Validate() error {
+	if _, err := g53.NameFromString(c.ClusterDomain); err != nil {
+		return fmt.Errorf("clusterDomain %q is invalid:%s", c.ClusterDomain, err.Error())
+	}
+	for _, alias := range c.ClusterDomainAliases {
+		if _, err := g53.NameFromString(alias); err != nil {
+			return fmt.Errorf("cluster domain alias %q is invalid:%s", alias, err.Error())
+		}
+	}
+	if _, err := util.ReverseZoneNames(c.ServiceIPRange); err != nil {
+		return fmt.Errorf("serviceIPRange %q is invalid:%s", c.ServiceIPRange, err.Error())
+	}
+	if _, err := util.ReverseZoneNames(c.PodIPRange); err != nil {
+		return fmt.Errorf("podIPRange %q is invalid:%s", c.PodIPRange, err.Error())
+	}
+	if ip := net.ParseIP(c.DNSServer); ip == nil || ip.To4() == nil {
+		return fmt.Errorf("dnsServer %q should be an ipv4 address", c.DNSServer)
+	}
+	if c.GRPCServer == "" {
+		return fmt.Errorf("grpcServer is empty")
+	}
+	if c.TTL > 1<<31-1 {
+		return fmt.Errorf("ttl %d is too large", c.TTL)
+	}
+	if c.IngressTarget != "" {
+		if _, err := g53.NameFromString(c.IngressTarget); err != nil {
+			return fmt.Errorf("ingressTarget %q is invalid:%s", c.IngressTarget, err.Error())
+		}
+	}
+	for _, ns := range c.Namespaces.Include {
+		if util.HasString(c.Namespaces.Exclude, ns) {
+			return fmt.Errorf("namespace %s is both included and excluded", ns)
+		}
+	}
+	if _, err := labels.Parse(c.Namespaces.Selector); err != nil {
+		return fmt.Errorf("namespace selector %q is invalid:%s", c.Namespaces.Selector, err.Error())
+	}
+	if _, err := labels.Parse(c.ServiceSelector); err != nil {
+		return fmt.Errorf("serviceSelector %q is invalid:%s", c.ServiceSelector, err.Error())
+	}
+	for i, scheme := range c.Naming {
+		if scheme.Zone != "" {
+			if _, err := g53.NameFromString(scheme.Zone); err != nil {
+				return fmt.Errorf("zone %q of naming scheme %d is invalid:%s", scheme.Zone, i, err.Error())
+			}
+		}
+		for _, tmpl := range []string{scheme.Service, scheme.Endpoints, scheme.Port} {
+			if _, err := template.New("name").Parse(tmpl); err != nil {
+				return fmt.Errorf("template %q of naming scheme %d is invalid:%s", tmpl, i, err.Error())
+			}
+		}
+	}
+	if c.Workers < 0 {
+		return fmt.Errorf("workers %d is negative", c.Workers)
+	}
+	if c.EndpointsWindow < 0 || c.EndpointsMaxWait < 0 {
+		return fmt.Errorf("endpointsWindow and endpointsMaxWait shouldn't be negative")
+	}
+	return nil
+}
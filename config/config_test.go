@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		ClusterDomain:  "cluster.local",
+		ServiceIPRange: "10.43.0.0/16",
+		PodIPRange:     "10.42.0.0/16",
+		DNSServer:      "10.43.0.10",
+		GRPCServer:     "127.0.0.1:5555",
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		check   func(*Config) bool
+		wantErr string
+	}{
+		{
+			name:  "empty config keeps base",
+			data:  "",
+			check: func(c *Config) bool { return reflect.DeepEqual(*c, validConfig()) },
+		},
+		{
+			name: "fields override base",
+			data: "clusterDomain: cluster.test\nttl: 30\nnamespaces:\n  exclude: [kube-system]\n",
+			check: func(c *Config) bool {
+				return c.ClusterDomain == "cluster.test" && c.TTL == 30 &&
+					reflect.DeepEqual(c.Namespaces.Exclude, []string{"kube-system"}) &&
+					c.ServiceIPRange == "10.43.0.0/16"
+			},
+		},
+		{
+			name: "naming schemes and durations",
+			data: "naming:\n- zone: corp.local\n  service: \"{{.Service}}.{{.Zone}}\"\nendpointsWindow: 200ms\nendpointsMaxWait: 2s\n",
+			check: func(c *Config) bool {
+				return reflect.DeepEqual(c.Naming, []NamingScheme{{Zone: "corp.local", Service: "{{.Service}}.{{.Zone}}"}}) &&
+					c.EndpointsWindow == Duration(200*time.Millisecond) &&
+					c.EndpointsMaxWait == Duration(2*time.Second)
+			},
+		},
+		{
+			name:    "unknown field",
+			data:    "clusterDomian: cluster.test\n",
+			wantErr: "parse config failed",
+		},
+		{
+			name:    "invalid yaml",
+			data:    "ttl: [\n",
+			wantErr: "parse config failed",
+		},
+		{
+			name:    "invalid value",
+			data:    "dnsServer: fd00::10\n",
+			wantErr: "dnsServer",
+		},
+	}
+
+	for _, c := range cases {
+		cfg, err := Parse([]byte(c.data), validConfig())
+		if c.wantErr != "" {
+			if err == nil || strings.Contains(err.Error(), c.wantErr) == false {
+				t.Errorf("%s: error should contain %q but get %v", c.name, c.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parse failed:%s", c.name, err.Error())
+		} else if c.check(cfg) == false {
+			t.Errorf("%s: unexpected config %+v", c.name, *cfg)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"invalid cluster domain", func(c *Config) { c.ClusterDomain = "a..b" }, "clusterDomain"},
+		{"invalid alias", func(c *Config) { c.ClusterDomainAliases = []string{"a..b"} }, "cluster domain alias"},
+		{"invalid service ip range", func(c *Config) { c.ServiceIPRange = "10.43.0.0" }, "serviceIPRange"},
+		{"invalid pod ip range", func(c *Config) { c.PodIPRange = "" }, "podIPRange"},
+		{"ipv6 dns server", func(c *Config) { c.DNSServer = "fd00::10" }, "dnsServer"},
+		{"empty grpc server", func(c *Config) { c.GRPCServer = "" }, "grpcServer"},
+		{"large ttl", func(c *Config) { c.TTL = 1 << 31 }, "ttl"},
+		{"invalid ingress target", func(c *Config) { c.IngressTarget = "a..b" }, "ingressTarget"},
+		{"namespace included and excluded", func(c *Config) {
+			c.Namespaces.Include = []string{"prod"}
+			c.Namespaces.Exclude = []string{"prod"}
+		}, "both included and excluded"},
+		{"invalid namespace selector", func(c *Config) { c.Namespaces.Selector = "a b" }, "namespace selector"},
+		{"invalid service selector", func(c *Config) { c.ServiceSelector = "a b" }, "serviceSelector"},
+		{"invalid scheme zone", func(c *Config) { c.Naming = []NamingScheme{{Zone: "a..b"}} }, "naming scheme 0"},
+		{"invalid scheme template", func(c *Config) { c.Naming = []NamingScheme{{}, {Service: "{{.Service"}} }, "naming scheme 1"},
+		{"negative workers", func(c *Config) { c.Workers = -1 }, "workers"},
+		{"negative window", func(c *Config) { c.EndpointsWindow = Duration(-time.Second) }, "endpointsWindow"},
+	}
+
+	for _, c := range cases {
+		cfg := validConfig()
+		c.modify(&cfg)
+		err := cfg.Validate()
+		if c.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: config should be valid:%s", c.name, err.Error())
+			}
+		} else if err == nil || strings.Contains(err.Error(), c.wantErr) == false {
+			t.Errorf("%s: error should contain %q but get %v", c.name, c.wantErr, err)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	cases := []struct {
+		data    string
+		want    Duration
+		wantErr bool
+	}{
+		{`"500ms"`, Duration(500 * time.Millisecond), false},
+		{`"1m30s"`, Duration(90 * time.Second), false},
+		{`"0s"`, 0, false},
+		{`500`, 0, true},
+		{`"5 minutes"`, 0, true},
+	}
+
+	for _, c := range cases {
+		var d Duration
+		err := json.Unmarshal([]byte(c.data), &d)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("unmarshal %s should fail", c.data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unmarshal %s failed:%s", c.data, err.Error())
+			continue
+		}
+		if d != c.want {
+			t.Errorf("unmarshal %s should get %v but get %v", c.data, time.Duration(c.want), time.Duration(d))
+		}
+
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Errorf("marshal %v failed:%s", time.Duration(d), err.Error())
+			continue
+		}
+		var back Duration
+		if err := json.Unmarshal(data, &back); err != nil || back != d {
+			t.Errorf("duration %s should round trip, but get %v", string(data), time.Duration(back))
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+const (
+	DomainSourceKubeadm    = "kubeadm"
+	DomainSourceCoreDNS    = "coredns"
+	DomainSourceResolvConf = "resolv-conf"
+
+	systemNamespace = "kube-system"
+	resolvConfPath  = "/etc/resolv.conf"
+
+	// network wider than /16 is split into at most 16 reverse zones
+	minSplitOnes = 12
+)
+
+var (
+	DefaultDNSServices   = []string{"kube-system/kube-dns", "kube-system/vanguard2", "kube-system/coredns"}
+	DefaultDomainSources = []string{DomainSourceKubeadm, DomainSourceCoreDNS, DomainSourceResolvConf}
+)
+
+// Detector fills the cluster settings left empty in config from objects of
+// the cluster, each detected value is logged with where it comes from
+type Detector struct {
+	Client client.Reader
+	// services in format namespace/name, the first one with cluster ip is
+	// used as dns server
+	DNSServices []string
+	// sources of cluster domain tried in order
+	DomainSources []string
+	// GuessIPRanges allows service ip range inferred from the address in
+	// use, the /16 network of kubernetes service ip, otherwise it's reported
+	// undetected
+	GuessIPRanges bool
+}
+
+type kubeadmNetworking struct {
+	Networking struct {
+		DNSDomain     string `json:"dnsDomain"`
+		ServiceSubnet string `json:"serviceSubnet"`
+		PodSubnet     string `json:"podSubnet"`
+	} `json:"networking"`
+}
+
+// Detect only changes empty fields, fields can't be detected are returned
+// in error and keep empty
+func (d *Detector) Detect(cfg *Config) error {
+	kubeadm := d.kubeadmNetworking()
+	var missing []string
+	if cfg.DNSServer == "" {
+		if ip, from := d.detectDNSServer(); ip != "" {
+			log.Printf("detect dnsServer %s from %s", ip, from)
+			cfg.DNSServer = ip
+		} else {
+			missing = append(missing, "dnsServer")
+		}
+	}
+	if cfg.ServiceIPRange == "" {
+		if network, from := d.detectServiceIPRange(kubeadm); network != "" {
+			log.Printf("detect serviceIPRange %s from %s", network, from)
+			cfg.ServiceIPRange = network
+		} else {
+			missing = append(missing, "serviceIPRange")
+		}
+	}
+	if cfg.PodIPRange == "" {
+		if network, from := d.detectPodIPRange(kubeadm); network != "" {
+			log.Printf("detect podIPRange %s from %s", network, from)
+			cfg.PodIPRange = network
+		} else {
+			missing = append(missing, "podIPRange")
+		}
+	}
+	if cfg.ClusterDomain == "" {
+		if domain, from := d.detectClusterDomain(kubeadm); domain != "" {
+			log.Printf("detect clusterDomain %s from %s", domain, from)
+			cfg.ClusterDomain = domain
+		} else {
+			missing = append(missing, "clusterDomain")
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("%s can't be detected", strings.Join(missing, ","))
+	}
+	return nil
+}
+
+func (d *Detector) detectDNSServer() (string, string) {
+	for _, name := range d.DNSServices {
+		parts := strings.Split(name, "/")
+		if len(parts) != 2 {
+			log.Printf("dns service %q isn't in format namespace/name", name)
+			continue
+		}
+		var svc corev1.Service
+		if err := d.Client.Get(context.TODO(), types.NamespacedName{Namespace: parts[0], Name: parts[1]}, &svc); err != nil {
+			continue
+		}
+		if ip := net.ParseIP(svc.Spec.ClusterIP); ip != nil && ip.To4() != nil {
+			return svc.Spec.ClusterIP, "service " + name
+		}
+	}
+	return "", ""
+}
+
+// the range of kubernetes service ip can't be known from the ip itself, the
+// /16 network of it is only guessed as the last resort
+func (d *Detector) detectServiceIPRange(kubeadm *kubeadmNetworking) (string, string) {
+	if kubeadm != nil {
+		if network := reverseNetwork(kubeadm.Networking.ServiceSubnet); network != "" {
+			return network, "config map kubeadm-config"
+		}
+	}
+	if network := reverseNetwork(d.componentFlag("kube-apiserver", "service-cluster-ip-range")); network != "" {
+		return network, "kube-apiserver flag --service-cluster-ip-range"
+	}
+
+	if d.GuessIPRanges == false {
+		return "", ""
+	}
+	var svc corev1.Service
+	if err := d.Client.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "kubernetes"}, &svc); err == nil {
+		if ip := net.ParseIP(svc.Spec.ClusterIP).To4(); ip != nil {
+			network := &net.IPNet{IP: ip.Mask(net.CIDRMask(16, 32)), Mask: net.CIDRMask(16, 32)}
+			return network.String(), "the /16 network of kubernetes service ip " + svc.Spec.ClusterIP
+		}
+	}
+	return "", ""
+}
+
+// node cidrs are slices of cluster cidr, the network covering them is used
+// if cluster cidr isn't configured
+func (d *Detector) detectPodIPRange(kubeadm *kubeadmNetworking) (string, string) {
+	if kubeadm != nil {
+		if network := reverseNetwork(kubeadm.Networking.PodSubnet); network != "" {
+			return network, "config map kubeadm-config"
+		}
+	}
+	if network := reverseNetwork(d.componentFlag("kube-controller-manager", "cluster-cidr")); network != "" {
+		return network, "kube-controller-manager flag --cluster-cidr"
+	}
+
+	var nodes corev1.NodeList
+	if err := d.Client.List(context.TODO(), nil, &nodes); err == nil {
+		var cidrs []string
+		for _, node := range nodes.Items {
+			if node.Spec.PodCIDR != "" {
+				cidrs = append(cidrs, node.Spec.PodCIDR)
+			}
+		}
+		//a single node only has a /24 one
+		if network := coveringNetwork(cidrs, 16); network != "" {
+			return network, fmt.Sprintf("the network covering pod cidrs of %d nodes", len(cidrs))
+		}
+	}
+	return "", ""
+}
+
+func (d *Detector) detectClusterDomain(kubeadm *kubeadmNetworking) (string, string) {
+	for _, source := range d.DomainSources {
+		var domain string
+		switch source {
+		case DomainSourceKubeadm:
+			if kubeadm != nil {
+				domain = kubeadm.Networking.DNSDomain
+			}
+		case DomainSourceCoreDNS:
+			domain = d.coreDNSDomain()
+		case DomainSourceResolvConf:
+			domain = resolvConfDomain(resolvConfPath)
+		default:
+			log.Printf("unknown cluster domain source %s", source)
+		}
+		if domain != "" {
+			return strings.TrimSuffix(domain, "."), source
+		}
+	}
+	return "", ""
+}
+
+func (d *Detector) kubeadmNetworking() *kubeadmNetworking {
+	var cm corev1.ConfigMap
+	if err := d.Client.Get(context.TODO(), types.NamespacedName{Namespace: systemNamespace, Name: "kubeadm-config"}, &cm); err != nil {
+		return nil
+	}
+	var kubeadm kubeadmNetworking
+	if err := yaml.Unmarshal([]byte(cm.Data["ClusterConfiguration"]), &kubeadm); err != nil {
+		log.Printf("parse config map kubeadm-config failed:%s", err.Error())
+		return nil
+	}
+	return &kubeadm
+}
+
+// componentFlag returns value of the flag of static pods like kube-apiserver
+func (d *Detector) componentFlag(component, flag string) string {
+	var pods corev1.PodList
+	opts := &client.ListOptions{
+		Namespace:     systemNamespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{"component": component}),
+	}
+	if err := d.Client.List(context.TODO(), opts, &pods); err != nil {
+		return ""
+	}
+	prefix := "--" + flag + "="
+	for _, pod := range pods.Items {
+		for _, c := range pod.Spec.Containers {
+			for _, arg := range append(c.Command, c.Args...) {
+				if strings.HasPrefix(arg, prefix) {
+					return strings.TrimPrefix(arg, prefix)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// the kubernetes plugin of coredns is like "kubernetes cluster.local in-addr.arpa {"
+func (d *Detector) coreDNSDomain() string {
+	var cm corev1.ConfigMap
+	if err := d.Client.Get(context.TODO(), types.NamespacedName{Namespace: systemNamespace, Name: "coredns"}, &cm); err != nil {
+		return ""
+	}
+	scanner := bufio.NewScanner(strings.NewReader(cm.Data["Corefile"]))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "kubernetes" && fields[1] != "{" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// search domains of pod are like "default.svc.cluster.local svc.cluster.local cluster.local"
+func resolvConfDomain(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if strings.HasPrefix(domain, "svc.") {
+				return strings.TrimPrefix(domain, "svc.")
+			}
+		}
+	}
+	return ""
+}
+
+// reverseNetwork picks the ipv4 one of dual stack ranges, and converts it to
+// the networks with 8, 16 or 24 bits mask which reverse zones support
+func reverseNetwork(ranges string) string {
+	for _, r := range strings.Split(ranges, ",") {
+		if network := coveringNetwork([]string{strings.TrimSpace(r)}, 24); network != "" {
+			return network
+		}
+	}
+	return ""
+}
+
+// coveringNetwork returns the comma separated networks with 8, 16 or 24 bits
+// mask which cover all the ipv4 cidrs, mask is at most maxOnes bits. Network
+// between /12 and /16 is split into its /16 networks, since reverse zone of
+// the /8 network covers a lot of addresses out of the range, like 10.0.0.0/8
+// for 10.96.0.0/12, networks wider than /12 are refused
+func coveringNetwork(cidrs []string, maxOnes int) string {
+	var base net.IP
+	ones := maxOnes
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil || network.IP.To4() == nil {
+			continue
+		}
+		ip := network.IP.To4()
+		if size, _ := network.Mask.Size(); size < ones {
+			ones = size
+		}
+		if base == nil {
+			base = ip
+			continue
+		}
+		for ones > 0 && base.Mask(net.CIDRMask(ones, 32)).Equal(ip.Mask(net.CIDRMask(ones, 32))) == false {
+			ones--
+		}
+	}
+	if base == nil || ones < minSplitOnes {
+		return ""
+	}
+
+	base = base.Mask(net.CIDRMask(ones, 32))
+	if ones < 16 {
+		var networks []string
+		mask := net.CIDRMask(16, 32)
+		for i := 0; i < 1<<uint(16-ones); i++ {
+			ip := net.IPv4(base[0], base[1]+byte(i), 0, 0).To4()
+			networks = append(networks, (&net.IPNet{IP: ip, Mask: mask}).String())
+		}
+		return strings.Join(networks, ",")
+	}
+	ones = ones / 8 * 8
+	mask := net.CIDRMask(ones, 32)
+	return (&net.IPNet{IP: base.Mask(mask), Mask: mask}).String()
+}
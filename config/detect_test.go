@@ -0,0 +1,220 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+// fakeReader serves config maps, services and nodes, pods are never found
+type fakeReader struct {
+	configMaps map[string]*corev1.ConfigMap
+	services   map[string]*corev1.Service
+	nodes      []corev1.Node
+}
+
+func (r *fakeReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		if cm, ok := r.configMaps[key.String()]; ok {
+			*o = *cm
+			return nil
+		}
+	case *corev1.Service:
+		if svc, ok := r.services[key.String()]; ok {
+			*o = *svc
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.String())
+}
+
+func (r *fakeReader) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	if nodes, ok := list.(*corev1.NodeList); ok {
+		nodes.Items = r.nodes
+	}
+	return nil
+}
+
+// kubeadm default service subnet 10.96.0.0/12
+var kubeadmServiceNetworks = "10.96.0.0/16,10.97.0.0/16,10.98.0.0/16,10.99.0.0/16," +
+	"10.100.0.0/16,10.101.0.0/16,10.102.0.0/16,10.103.0.0/16," +
+	"10.104.0.0/16,10.105.0.0/16,10.106.0.0/16,10.107.0.0/16," +
+	"10.108.0.0/16,10.109.0.0/16,10.110.0.0/16,10.111.0.0/16"
+
+func TestCoveringNetwork(t *testing.T) {
+	cases := []struct {
+		cidrs   []string
+		maxOnes int
+		want    string
+	}{
+		{[]string{"10.42.0.0/16"}, 24, "10.42.0.0/16"},
+		{[]string{"10.42.3.0/24"}, 24, "10.42.3.0/24"},
+		{[]string{"10.42.3.0/24"}, 16, "10.42.0.0/16"},
+		{[]string{"10.42.0.0/20"}, 24, "10.42.0.0/16"},
+		{[]string{"10.42.0.0/24", "10.42.1.0/24"}, 24, "10.42.0.0/16"},
+		{[]string{"10.42.3.0/25", "10.42.3.128/25"}, 24, "10.42.3.0/24"},
+		{[]string{"10.42.0.0/24", "fd00::/64", "invalid"}, 24, "10.42.0.0/24"},
+		//networks between /12 and /16 are split into /16 networks
+		{[]string{"10.96.0.0/12"}, 24, kubeadmServiceNetworks},
+		{[]string{"10.42.0.0/24", "10.43.0.0/24"}, 16, "10.42.0.0/16,10.43.0.0/16"},
+		{[]string{"172.16.0.0/14"}, 24, "172.16.0.0/16,172.17.0.0/16,172.18.0.0/16,172.19.0.0/16"},
+		//networks wider than /12 are refused
+		{[]string{"10.0.0.0/8"}, 24, ""},
+		{[]string{"10.0.0.0/11"}, 24, ""},
+		{[]string{"fd00::/64"}, 24, ""},
+		{nil, 24, ""},
+	}
+
+	for _, c := range cases {
+		if got := coveringNetwork(c.cidrs, c.maxOnes); got != c.want {
+			t.Errorf("covering network of %v with mask at most %d should be %q but get %q", c.cidrs, c.maxOnes, c.want, got)
+		}
+	}
+}
+
+func TestReverseNetwork(t *testing.T) {
+	cases := []struct {
+		ranges string
+		want   string
+	}{
+		{"10.43.0.0/16", "10.43.0.0/16"},
+		{"10.43.8.0/22", "10.43.0.0/16"},
+		{"192.168.1.0/24", "192.168.1.0/24"},
+		{"10.96.0.0/12", kubeadmServiceNetworks},
+		{"fd00::/108, 10.43.0.0/16", "10.43.0.0/16"},
+		{"10.43.0.0/16,fd00::/108", "10.43.0.0/16"},
+		{"fd00::/108", ""},
+		{"", ""},
+	}
+
+	for _, c := range cases {
+		if got := reverseNetwork(c.ranges); got != c.want {
+			t.Errorf("reverse network of %q should be %q but get %q", c.ranges, c.want, got)
+		}
+	}
+}
+
+func TestResolvConfDomain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolv")
+	if err != nil {
+		t.Fatalf("create temp dir failed:%s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		content string
+		want    string
+	}{
+		{"nameserver 10.43.0.10\nsearch default.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n", "cluster.local"},
+		{"search prod.svc.corp.local svc.corp.local corp.local example.com\n", "corp.local"},
+		{"nameserver 8.8.8.8\nsearch example.com\n", ""},
+		{"# search svc.cluster.local\n", ""},
+		{"", ""},
+	}
+
+	for i, c := range cases {
+		path := filepath.Join(dir, "resolv.conf")
+		if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatalf("write file failed:%s", err.Error())
+		}
+		if got := resolvConfDomain(path); got != c.want {
+			t.Errorf("case %d: domain should be %q but get %q", i, c.want, got)
+		}
+	}
+	if got := resolvConfDomain(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("missing file should have no domain but get %q", got)
+	}
+}
+
+func corednsConfigMap(corefile string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: systemNamespace, Name: "coredns"},
+		Data:       map[string]string{"Corefile": corefile},
+	}
+}
+
+func TestCoreDNSDomain(t *testing.T) {
+	cases := []struct {
+		corefile string
+		want     string
+	}{
+		{".:53 {\n    errors\n    kubernetes cluster.local in-addr.arpa ip6.arpa {\n       pods insecure\n    }\n}\n", "cluster.local"},
+		{".:53 {\n    kubernetes corp.local {\n    }\n}\n", "corp.local"},
+		//zones of kubernetes plugin default to server block
+		{"cluster.local:53 {\n    kubernetes {\n    }\n}\n", ""},
+		{".:53 {\n    forward . /etc/resolv.conf\n}\n", ""},
+	}
+
+	for i, c := range cases {
+		d := &Detector{Client: &fakeReader{configMaps: map[string]*corev1.ConfigMap{
+			systemNamespace + "/coredns": corednsConfigMap(c.corefile),
+		}}}
+		if got := d.coreDNSDomain(); got != c.want {
+			t.Errorf("case %d: domain should be %q but get %q", i, c.want, got)
+		}
+	}
+	if got := (&Detector{Client: &fakeReader{}}).coreDNSDomain(); got != "" {
+		t.Errorf("missing config map should have no domain but get %q", got)
+	}
+}
+
+func TestDetectGuessIPRanges(t *testing.T) {
+	reader := &fakeReader{
+		services: map[string]*corev1.Service{
+			"default/kubernetes": {Spec: corev1.ServiceSpec{ClusterIP: "10.96.0.1"}},
+		},
+		nodes: []corev1.Node{
+			{Spec: corev1.NodeSpec{PodCIDR: "10.244.1.0/24"}},
+		},
+	}
+	base := Config{ClusterDomain: "cluster.local", DNSServer: "10.96.0.10"}
+
+	cfg := base
+	d := &Detector{Client: reader}
+	err := d.Detect(&cfg)
+	if err == nil || strings.Contains(err.Error(), "serviceIPRange can't") == false {
+		t.Errorf("service ip range shouldn't be guessed by default, but get %v", err)
+	}
+	if cfg.ServiceIPRange != "" {
+		t.Errorf("undetected service ip range should keep empty, but get %s", cfg.ServiceIPRange)
+	}
+	if cfg.PodIPRange != "10.244.0.0/16" {
+		t.Errorf("pod ip range should be detected from pod cidrs of nodes, but get %s", cfg.PodIPRange)
+	}
+
+	cfg = base
+	d.GuessIPRanges = true
+	if err := d.Detect(&cfg); err != nil {
+		t.Fatalf("ip ranges should be guessed:%s", err.Error())
+	}
+	if cfg.ServiceIPRange != "10.96.0.0/16" || cfg.PodIPRange != "10.244.0.0/16" {
+		t.Errorf("guessed ip ranges are wrong:%s %s", cfg.ServiceIPRange, cfg.PodIPRange)
+	}
+
+	//ranges configured in cluster are used without guessing
+	reader.configMaps = map[string]*corev1.ConfigMap{
+		systemNamespace + "/kubeadm-config": {
+			Data: map[string]string{"ClusterConfiguration": "networking:\n  serviceSubnet: 10.96.0.0/12\n  podSubnet: 10.245.0.0/16\n"},
+		},
+	}
+	cfg = base
+	d.GuessIPRanges = false
+	if err := d.Detect(&cfg); err != nil {
+		t.Fatalf("detect failed:%s", err.Error())
+	}
+	if cfg.ServiceIPRange != kubeadmServiceNetworks || cfg.PodIPRange != "10.245.0.0/16" {
+		t.Errorf("ip ranges should come from kubeadm config:%s %s", cfg.ServiceIPRange, cfg.PodIPRange)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+const DefaultConfigMapKey = "config.yaml"
+
+// Source returns the content of config
+type Source interface {
+	Load() ([]byte, error)
+	String() string
+}
+
+// FileSource reads config file, config map mounted as volume is also a file
+type FileSource string
+
+func (s FileSource) Load() ([]byte, error) {
+	return ioutil.ReadFile(string(s))
+}
+
+func (s FileSource) String() string {
+	return "file " + string(s)
+}
+
+// ConfigMapSource reads config from the key of a config map
+type ConfigMapSource struct {
+	Client    client.Reader
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func (s *ConfigMapSource) Load() ([]byte, error) {
+	var cm corev1.ConfigMap
+	if err := s.Client.Get(context.TODO(), types.NamespacedName{Namespace: s.Namespace, Name: s.Name}, &cm); err != nil {
+		return nil, err
+	}
+	data, ok := cm.Data[s.Key]
+	if ok == false {
+		return nil, fmt.Errorf("config map %s/%s has no key %s", s.Namespace, s.Name, s.Key)
+	}
+	return []byte(data), nil
+}
+
+func (s *ConfigMapSource) String() string {
+	return fmt.Sprintf("config map %s/%s key %s", s.Namespace, s.Name, s.Key)
+}
+
+// Watcher polls the source and reports the changed config, fields missing
+// in the source keep the value in base
+type Watcher struct {
+	src  Source
+	base Config
+	last []byte
+}
+
+// NewWatcher loads the current config from src
+func NewWatcher(src Source, base Config) (*Watcher, *Config, error) {
+	data, err := src.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config from %s failed:%s", src.String(), err.Error())
+	}
+	cfg, err := Parse(data, base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config from %s is invalid:%s", src.String(), err.Error())
+	}
+	return &Watcher{
+		src:  src,
+		base: base,
+		last: data,
+	}, cfg, nil
+}
+
+// Run calls onChange when the content of source changes, invalid config is
+// logged and ignored, so the current config is kept until it's fixed
+func (w *Watcher) Run(interval time.Duration, stop <-chan struct{}, onChange func(*Config)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		data, err := w.src.Load()
+		if err != nil {
+			log.Printf("load config from %s failed:%s", w.src.String(), err.Error())
+			continue
+		}
+		if bytes.Equal(data, w.last) {
+			continue
+		}
+		w.last = data
+
+		cfg, err := Parse(data, w.base)
+		if err != nil {
+			log.Printf("reject config from %s:%s", w.src.String(), err.Error())
+			continue
+		}
+		onChange(cfg)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySource returns the content set by test
+type memorySource struct {
+	lock sync.Mutex
+	data string
+	err  error
+}
+
+func (s *memorySource) set(data string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data, s.err = data, err
+}
+
+func (s *memorySource) Load() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return []byte(s.data), s.err
+}
+
+func (s *memorySource) String() string {
+	return "memory"
+}
+
+func TestNewWatcher(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		loadErr error
+		wantErr string
+	}{
+		{"valid", "ttl: 30\n", nil, ""},
+		{"load failed", "", fmt.Errorf("no such file"), "load config from memory failed"},
+		{"invalid config", "ttl: -1\n", nil, "config from memory is invalid"},
+	}
+
+	for _, c := range cases {
+		src := &memorySource{data: c.data, err: c.loadErr}
+		w, cfg, err := NewWatcher(src, validConfig())
+		if c.wantErr != "" {
+			if err == nil || strings.Contains(err.Error(), c.wantErr) == false {
+				t.Errorf("%s: error should contain %q but get %v", c.name, c.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: create watcher failed:%s", c.name, err.Error())
+		} else if w == nil || cfg.TTL != 30 {
+			t.Errorf("%s: current config should be loaded, but get %+v", c.name, cfg)
+		}
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	src := &memorySource{data: "ttl: 30\n"}
+	w, _, err := NewWatcher(src, validConfig())
+	if err != nil {
+		t.Fatalf("create watcher failed:%s", err.Error())
+	}
+
+	changes := make(chan *Config, 10)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		w.Run(5*time.Millisecond, stop, func(cfg *Config) { changes <- cfg })
+		close(stopped)
+	}()
+
+	expectNoChange := func(step string) {
+		select {
+		case cfg := <-changes:
+			t.Errorf("%s: config shouldn't be reported, but get %+v", step, cfg)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	expectChange := func(step string, ttl uint32) {
+		select {
+		case cfg := <-changes:
+			if cfg.TTL != ttl {
+				t.Errorf("%s: ttl should be %d but get %d", step, ttl, cfg.TTL)
+			}
+			if cfg.ClusterDomain != "cluster.local" {
+				t.Errorf("%s: missing fields should keep base", step)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: changed config isn't reported", step)
+		}
+	}
+
+	expectNoChange("unchanged")
+	src.set("ttl: 60\n", nil)
+	expectChange("changed", 60)
+	src.set("ttl: 60\n", fmt.Errorf("connection refused"))
+	expectNoChange("load failed")
+	src.set("ttl: 60\nunknown: true\n", nil)
+	expectNoChange("invalid")
+	src.set("ttl: 90\n", nil)
+	expectChange("fixed", 90)
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("watcher should return after stopped")
+	}
+}
@@ -0,0 +1,442 @@
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const SchemaVersion = "1.0.1"
+
+// cname chain of flattened ExternalName is followed at most this times
+const maxCNAMEChain = 8
+
+// sections of Kubernetes DNS-Based Service Discovery specification 1.0.1,
+// ExternalName which is an ip or whose target is flattened is published as
+// address records instead of the cname the specification requires
+const (
+	SectionSchemaVersion = "2.2 Record for Schema Version"
+	SectionClusterIPA    = "2.3.1 A Records for a Service with ClusterIP"
+	SectionClusterIPSRV  = "2.3.2 SRV Records for a Service with ClusterIP"
+	SectionClusterIPPTR  = "2.3.3 PTR Record for a Service with ClusterIP"
+	SectionHeadlessA     = "2.4.1 A Records for a Headless Service"
+	SectionHeadlessSRV   = "2.4.2 SRV Records for a Headless Service"
+	SectionHeadlessPTR   = "2.4.3 PTR Records for a Headless Service"
+	SectionExternalName  = "2.5.1 Record for an ExternalName Service"
+)
+
+var Sections = []string{
+	SectionSchemaVersion,
+	SectionClusterIPA,
+	SectionClusterIPSRV,
+	SectionClusterIPPTR,
+	SectionHeadlessA,
+	SectionHeadlessSRV,
+	SectionHeadlessPTR,
+	SectionExternalName,
+}
+
+type Deviation struct {
+	Section string `json:"section"`
+	Object  string `json:"object,omitempty"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+type Report struct {
+	Deviations []Deviation `json:"deviations"`
+}
+
+// Namer generates the names of services, names of the first namer are
+// expected in ptr records
+type Namer interface {
+	Zone() *g53.Name
+	ServiceName(service, namespace string) (*g53.Name, error)
+	EndpointsName(hostname, service, namespace string) (*g53.Name, error)
+	PortName(port, protocol, service, namespace string) (*g53.Name, error)
+}
+
+type specNamer struct {
+	zone *g53.Name
+}
+
+// SpecNamer generates the names defined by the specification in cluster
+// domain
+func SpecNamer(clusterDomain string) (Namer, error) {
+	zone, err := g53.NameFromString(clusterDomain)
+	if err != nil {
+		return nil, err
+	}
+	return &specNamer{zone}, nil
+}
+
+func (n *specNamer) Zone() *g53.Name {
+	return n.zone
+}
+
+func (n *specNamer) ServiceName(service, namespace string) (*g53.Name, error) {
+	return g53.NameFromStringUnsafe(strings.Join([]string{service, namespace, "svc"}, ".")).Concat(n.zone)
+}
+
+func (n *specNamer) EndpointsName(hostname, service, namespace string) (*g53.Name, error) {
+	name, err := n.ServiceName(service, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return g53.NameFromStringUnsafe(hostname).Concat(name)
+}
+
+func (n *specNamer) PortName(port, protocol, service, namespace string) (*g53.Name, error) {
+	name, err := n.ServiceName(service, namespace)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Join([]string{"_" + port, "_" + strings.ToLower(protocol)}, ".")
+	return g53.NameFromStringUnsafe(prefix).Concat(name)
+}
+
+type checker struct {
+	namers    []Namer
+	records   *Records
+	endpoints map[string]*corev1.Endpoints
+	report    *Report
+}
+
+// Check compares records with what the specification requires for the
+// services and endpoints in objs, objects of other kinds are ignored. Names
+// of every namer are checked, SpecNamer generates the names of the
+// specification. Only ready ipv4 addresses are checked, srv records of
+// headless service follow the named ports of endpoints. Addresses published
+// for ExternalName instead of cname should be the addresses of the target
+// in records
+func Check(objs []runtime.Object, records *Records, namers []Namer) *Report {
+	c := &checker{
+		namers:    namers,
+		records:   records,
+		endpoints: make(map[string]*corev1.Endpoints),
+		report:    &Report{},
+	}
+	for _, obj := range objs {
+		if ep, ok := obj.(*corev1.Endpoints); ok {
+			c.endpoints[ep.Namespace+"/"+ep.Name] = ep
+		}
+	}
+
+	var zones []*g53.Name
+	for _, namer := range namers {
+		if hasName(zones, namer.Zone()) == false {
+			zones = append(zones, namer.Zone())
+			c.checkSchemaVersion(namer.Zone())
+		}
+	}
+	for _, obj := range objs {
+		if svc, ok := obj.(*corev1.Service); ok {
+			for i, namer := range namers {
+				c.checkService(svc, namer, i == 0)
+			}
+		}
+	}
+	return c.report
+}
+
+func (c *checker) checkSchemaVersion(zone *g53.Name) {
+	name, _ := g53.NameFromStringUnsafe("dns-version").Concat(zone)
+	txt := c.records.Get(name, g53.RR_TXT)
+	if txt == nil {
+		c.deviate(SectionSchemaVersion, "", name, "TXT record is missing")
+		return
+	}
+	for _, rdata := range txt.Rdatas {
+		if strings.Trim(rdata.String(), `"`) == SchemaVersion {
+			return
+		}
+	}
+	c.deviate(SectionSchemaVersion, "", name, fmt.Sprintf("TXT record should be %q", SchemaVersion))
+}
+
+// ptr records only point to names of the first namer
+func (c *checker) checkService(svc *corev1.Service, namer Namer, ptr bool) {
+	object := "Service " + svc.Namespace + "/" + svc.Name
+	name, err := namer.ServiceName(svc.Name, svc.Namespace)
+	if err != nil {
+		c.deviate(SectionClusterIPA, object, namer.Zone(), fmt.Sprintf("generate service name failed:%s", err.Error()))
+		return
+	}
+	switch {
+	case svc.Spec.Type == corev1.ServiceTypeExternalName:
+		c.checkExternalName(svc, object, name)
+	case svc.Spec.ClusterIP == corev1.ClusterIPNone:
+		c.checkHeadless(svc, object, namer, name, ptr)
+	case svc.Spec.ClusterIP != "":
+		c.checkClusterIP(svc, object, namer, name, ptr)
+	}
+}
+
+func (c *checker) checkClusterIP(svc *corev1.Service, object string, namer Namer, name *g53.Name, ptr bool) {
+	ip := net.ParseIP(svc.Spec.ClusterIP)
+	if ip == nil || ip.To4() == nil {
+		return
+	}
+
+	c.expectExactly(SectionClusterIPA, object, name, g53.RR_A, []string{svc.Spec.ClusterIP})
+
+	for _, port := range svc.Spec.Ports {
+		if port.Name == "" {
+			continue
+		}
+		if portName, err := portName(namer, svc, port.Name, port.Protocol); err != nil {
+			c.deviate(SectionClusterIPSRV, object, name, err.Error())
+		} else {
+			c.expectSRV(SectionClusterIPSRV, object, portName, port.Port, name)
+		}
+	}
+
+	if rn, err := util.ReverseIPName(svc.Spec.ClusterIP); err == nil && ptr {
+		c.expectContains(SectionClusterIPPTR, object, rn, g53.RR_PTR, name.String(false))
+	}
+}
+
+func (c *checker) checkHeadless(svc *corev1.Service, object string, namer Namer, name *g53.Name, ptr bool) {
+	var ips []string
+	ep := c.endpoints[svc.Namespace+"/"+svc.Name]
+	if ep != nil {
+		for _, subset := range ep.Subsets {
+			for _, addr := range subset.Addresses {
+				if isIPv4(addr.IP) {
+					ips = append(ips, addr.IP)
+				}
+			}
+		}
+	}
+	c.expectExactly(SectionHeadlessA, object, name, g53.RR_A, ips)
+	if ep == nil {
+		return
+	}
+
+	for _, subset := range ep.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.Hostname == "" || isIPv4(addr.IP) == false {
+				continue
+			}
+
+			hostName, err := namer.EndpointsName(addr.Hostname, svc.Name, svc.Namespace)
+			if err != nil {
+				c.deviate(SectionHeadlessA, object, name, fmt.Sprintf("hostname %s is invalid", addr.Hostname))
+				continue
+			}
+			c.expectContains(SectionHeadlessA, object, hostName, g53.RR_A, addr.IP)
+
+			for _, port := range subset.Ports {
+				if port.Name == "" {
+					continue
+				}
+				if portName, err := portName(namer, svc, port.Name, port.Protocol); err != nil {
+					c.deviate(SectionHeadlessSRV, object, name, err.Error())
+				} else {
+					c.expectSRV(SectionHeadlessSRV, object, portName, port.Port, hostName)
+				}
+			}
+
+			if rn, err := util.ReverseIPName(addr.IP); err == nil && ptr {
+				c.expectContains(SectionHeadlessPTR, object, rn, g53.RR_PTR, hostName.String(false))
+			}
+		}
+	}
+}
+
+func (c *checker) checkExternalName(svc *corev1.Service, object string, name *g53.Name) {
+	if ip := net.ParseIP(svc.Spec.ExternalName); ip != nil {
+		addrs := map[g53.RRType][]string{}
+		if ip.To4() != nil {
+			addrs[g53.RR_A] = []string{ip.String()}
+		} else {
+			addrs[g53.RR_AAAA] = []string{ip.String()}
+		}
+		c.expectAddresses(object, name, addrs)
+		return
+	}
+
+	target, err := g53.NameFromString(svc.Spec.ExternalName)
+	if err != nil {
+		c.deviate(SectionExternalName, object, name, fmt.Sprintf("external name %s is invalid", svc.Spec.ExternalName))
+		return
+	}
+	flattened := c.records.Get(name, g53.RR_A) != nil || c.records.Get(name, g53.RR_AAAA) != nil
+	if flattened == false || c.records.Get(name, g53.RR_CNAME) != nil {
+		c.expectExactly(SectionExternalName, object, name, g53.RR_CNAME, []string{target.String(false)})
+		return
+	}
+
+	addrs := c.resolve(target)
+	if len(addrs) == 0 {
+		c.deviate(SectionExternalName, object, name, fmt.Sprintf("addresses are published but target %s has no address", target.String(false)))
+		return
+	}
+	c.expectAddresses(object, name, addrs)
+}
+
+// name of ExternalName has exactly the addresses without cname
+func (c *checker) expectAddresses(object string, name *g53.Name, addrs map[g53.RRType][]string) {
+	for _, typ := range []g53.RRType{g53.RR_A, g53.RR_AAAA} {
+		c.expectExactly(SectionExternalName, object, name, typ, addrs[typ])
+	}
+	c.expectExactly(SectionExternalName, object, name, g53.RR_CNAME, nil)
+}
+
+// resolve returns the addresses of name in records, cname is followed
+func (c *checker) resolve(name *g53.Name) map[g53.RRType][]string {
+	for i := 0; i < maxCNAMEChain; i++ {
+		addrs := make(map[g53.RRType][]string)
+		for _, typ := range []g53.RRType{g53.RR_A, g53.RR_AAAA} {
+			if rrset := c.records.Get(name, typ); rrset != nil {
+				for _, rdata := range rrset.Rdatas {
+					addrs[typ] = append(addrs[typ], rdata.String())
+				}
+			}
+		}
+		if len(addrs) != 0 {
+			return addrs
+		}
+		cname := c.records.Get(name, g53.RR_CNAME)
+		if cname == nil || len(cname.Rdatas) == 0 {
+			return nil
+		}
+		name = cname.Rdatas[0].(*g53.CName).Name
+	}
+	return nil
+}
+
+func (c *checker) expectExactly(section, object string, name *g53.Name, typ g53.RRType, rdatas []string) {
+	rrset := c.records.Get(name, typ)
+	if rrset == nil {
+		if len(rdatas) != 0 {
+			c.deviate(section, object, name, fmt.Sprintf("%s record is missing, should be %s", typ.String(), strings.Join(rdatas, ", ")))
+		}
+		return
+	}
+
+	for _, s := range rdatas {
+		if hasRdata(rrset, typ, s) == false {
+			c.deviate(section, object, name, fmt.Sprintf("%s record %s is missing", typ.String(), s))
+		}
+	}
+	for _, rdata := range rrset.Rdatas {
+		expected := false
+		for _, s := range rdatas {
+			if e, err := g53.RdataFromString(typ, s); err == nil && isRdataEqual(e, rdata) {
+				expected = true
+				break
+			}
+		}
+		if expected == false {
+			c.deviate(section, object, name, fmt.Sprintf("unexpected %s record %s", typ.String(), rdata.String()))
+		}
+	}
+}
+
+func (c *checker) expectContains(section, object string, name *g53.Name, typ g53.RRType, rdata string) {
+	rrset := c.records.Get(name, typ)
+	if rrset == nil {
+		c.deviate(section, object, name, fmt.Sprintf("%s record is missing, should be %s", typ.String(), rdata))
+	} else if hasRdata(rrset, typ, rdata) == false {
+		c.deviate(section, object, name, fmt.Sprintf("%s record %s is missing", typ.String(), rdata))
+	}
+}
+
+// priority and weight of srv are up to implementation
+func (c *checker) expectSRV(section, object string, name *g53.Name, port int32, target *g53.Name) {
+	rrset := c.records.Get(name, g53.RR_SRV)
+	if rrset != nil {
+		for _, rdata := range rrset.Rdatas {
+			if srv, ok := rdata.(*g53.SRV); ok && int32(srv.Port) == port && srv.Target.Equals(target) {
+				return
+			}
+		}
+	}
+	c.deviate(section, object, name, fmt.Sprintf("SRV record with port %d and target %s is missing", port, target.String(false)))
+}
+
+func (c *checker) deviate(section, object string, name *g53.Name, message string) {
+	c.report.Deviations = append(c.report.Deviations, Deviation{
+		Section: section,
+		Object:  object,
+		Name:    name.String(false),
+		Message: message,
+	})
+}
+
+func portName(namer Namer, svc *corev1.Service, port string, protocol corev1.Protocol) (*g53.Name, error) {
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+	name, err := namer.PortName(port, string(protocol), svc.Name, svc.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("generate name of port %s failed:%s", port, err.Error())
+	}
+	return name, nil
+}
+
+// Write prints deviations grouped by section, sections without deviation
+// are reported as passed
+func (r *Report) Write(w io.Writer) {
+	for _, section := range Sections {
+		var deviations []Deviation
+		for _, d := range r.Deviations {
+			if d.Section == section {
+				deviations = append(deviations, d)
+			}
+		}
+
+		if len(deviations) == 0 {
+			fmt.Fprintf(w, "[PASS] %s\n", section)
+			continue
+		}
+		fmt.Fprintf(w, "[FAIL] %s: %d deviations\n", section, len(deviations))
+		for _, d := range deviations {
+			if d.Object != "" {
+				fmt.Fprintf(w, "  %s: %s %s\n", d.Object, d.Name, d.Message)
+			} else {
+				fmt.Fprintf(w, "  %s %s\n", d.Name, d.Message)
+			}
+		}
+	}
+}
+
+func hasRdata(rrset *g53.RRset, typ g53.RRType, s string) bool {
+	expect, err := g53.RdataFromString(typ, s)
+	if err != nil {
+		return false
+	}
+	for _, rdata := range rrset.Rdatas {
+		if isRdataEqual(rdata, expect) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare of cname rdata always returns 0
+func isRdataEqual(a, b g53.Rdata) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
+
+func hasName(names []*g53.Name, name *g53.Name) bool {
+	for _, n := range names {
+		if n.Equals(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPv4(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && addr.To4() != nil
+}
@@ -0,0 +1,149 @@
+package conformance
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+	"github.com/zdnscloud/vanguard2-controller/controller"
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const (
+	testClusterDomain  = "cluster.local"
+	testServiceIPRange = "10.43.0.0/16"
+	testPodIPRange     = "10.42.0.0/16"
+	testDNSServer      = "10.43.0.10"
+)
+
+func loadObjects(t *testing.T) []runtime.Object {
+	objs, err := util.LoadObjects("testdata/services.yaml")
+	if err != nil {
+		t.Fatalf("load objects failed:%s", err.Error())
+	}
+	return objs
+}
+
+// renderRecords publishes objs with offline controller into memstore
+func renderRecords(t *testing.T, objs []runtime.Object, schemes []config.NamingScheme, aliases []string, opts controller.Options) *Records {
+	store := memstore.New()
+	client, err := controller.NewVgClientWithBackend(store, testClusterDomain, testServiceIPRange, testPodIPRange, testDNSServer, "", "")
+	if err != nil {
+		t.Fatalf("create client failed:%s", err.Error())
+	}
+	if err := client.SetNamingSchemes(schemes); err != nil {
+		t.Fatalf("set naming schemes failed:%s", err.Error())
+	}
+	if err := client.SetClusterDomainAliases(aliases); err != nil {
+		t.Fatalf("set aliases failed:%s", err.Error())
+	}
+	if _, err := controller.NewOfflineController(client, objs, opts); err != nil {
+		t.Fatalf("render records failed:%s", err.Error())
+	}
+
+	var rrsets []*g53.RRset
+	for _, zone := range store.Zones(controller.DefaultView) {
+		zoneRRsets, err := store.RRsets(controller.DefaultView, zone)
+		if err != nil {
+			t.Fatalf("get rrsets of zone %s failed:%s", zone, err.Error())
+		}
+		rrsets = append(rrsets, zoneRRsets...)
+	}
+	return NewRecords(rrsets)
+}
+
+func namers(t *testing.T, schemes []config.NamingScheme, aliases []string) []Namer {
+	controllerNamers, err := controller.NewNamers(testClusterDomain, schemes, aliases)
+	if err != nil {
+		t.Fatalf("create namers failed:%s", err.Error())
+	}
+	var result []Namer
+	for _, namer := range controllerNamers {
+		result = append(result, namer)
+	}
+	return result
+}
+
+func specNamers(t *testing.T) []Namer {
+	namer, err := SpecNamer(testClusterDomain)
+	if err != nil {
+		t.Fatalf("create namer failed:%s", err.Error())
+	}
+	return []Namer{namer}
+}
+
+func TestRenderedRecordsConform(t *testing.T) {
+	objs := loadObjects(t)
+	schemes := []config.NamingScheme{
+		{},
+		{Zone: "corp.local", Service: "{{.Service}}-{{.Namespace}}.{{.Zone}}", Endpoints: "{{.Hostname}}.{{.Service}}-{{.Namespace}}.{{.Zone}}", Port: "_{{.Port}}._{{.Protocol}}.{{.Service}}-{{.Namespace}}.{{.Zone}}"},
+	}
+	aliases := []string{"cluster.example"}
+
+	for _, c := range []struct {
+		name    string
+		schemes []config.NamingScheme
+		aliases []string
+		opts    controller.Options
+	}{
+		{"default naming", nil, nil, controller.Options{}},
+		{"naming schemes and aliases", schemes, aliases, controller.Options{}},
+		{"flattened external names", nil, nil, controller.Options{FlattenExternalNames: true}},
+	} {
+		records := renderRecords(t, objs, c.schemes, c.aliases, c.opts)
+		www, _ := g53.NameFromString("www.default.svc.cluster.local")
+		if flattened := records.Get(www, g53.RR_A) != nil; flattened != c.opts.FlattenExternalNames {
+			t.Errorf("%s: external name should be flattened only with option", c.name)
+		}
+		if report := Check(objs, records, namers(t, c.schemes, c.aliases)); len(report.Deviations) != 0 {
+			t.Errorf("%s: records should conform:%v", c.name, report.Deviations)
+		}
+	}
+
+	//spec names are still checked by default
+	records := renderRecords(t, objs, schemes, aliases, controller.Options{})
+	if report := Check(objs, records, specNamers(t)); len(report.Deviations) != 0 {
+		t.Errorf("records of cluster domain should conform:%v", report.Deviations)
+	}
+	records = renderRecords(t, objs, schemes[1:], nil, controller.Options{})
+	if report := Check(objs, records, specNamers(t)); len(report.Deviations) == 0 {
+		t.Errorf("records without spec names shouldn't conform")
+	}
+}
+
+func TestDeviations(t *testing.T) {
+	objs := loadObjects(t)
+	records, err := LoadRecords("testdata/deviating.zone")
+	if err != nil {
+		t.Fatalf("load records failed:%s", err.Error())
+	}
+
+	report := Check(objs, records, specNamers(t))
+	var deviations []string
+	for _, d := range report.Deviations {
+		deviations = append(deviations, d.Section+" "+d.Name)
+	}
+	sort.Strings(deviations)
+	expected := []string{
+		SectionSchemaVersion + " dns-version.cluster.local.",
+		SectionClusterIPA + " web.default.svc.cluster.local.",
+		SectionClusterIPA + " web.default.svc.cluster.local.",
+		SectionClusterIPSRV + " _http._tcp.web.default.svc.cluster.local.",
+		SectionHeadlessPTR + " 8.0.42.10.in-addr.arpa.",
+		SectionExternalName + " search.default.svc.cluster.local.",
+		SectionExternalName + " search.default.svc.cluster.local.",
+		SectionExternalName + " legacy.default.svc.cluster.local.",
+		SectionExternalName + " legacy.default.svc.cluster.local.",
+		SectionExternalName + " www.default.svc.cluster.local.",
+		SectionExternalName + " www.default.svc.cluster.local.",
+	}
+	sort.Strings(expected)
+	if reflect.DeepEqual(deviations, expected) == false {
+		t.Errorf("deviations should be %v, but get %v", expected, deviations)
+	}
+}
@@ -0,0 +1,71 @@
+package conformance
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+)
+
+// Records is the generated zone data to check, rrsets of all the zones
+// could be put together
+type Records struct {
+	rrsets map[string]*g53.RRset
+}
+
+func NewRecords(rrsets []*g53.RRset) *Records {
+	r := &Records{
+		rrsets: make(map[string]*g53.RRset),
+	}
+	for _, rrset := range rrsets {
+		r.add(rrset)
+	}
+	return r
+}
+
+// LoadRecords reads records in master file format, one rr per line, lines
+// start with ';' are comments
+func LoadRecords(path string) (*Records, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewRecords(nil)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		rrset, err := g53.RRsetFromString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rr %s:%s", line, err.Error())
+		}
+		r.add(rrset)
+	}
+	return r, scanner.Err()
+}
+
+func (r *Records) add(rrset *g53.RRset) {
+	key := recordKey(rrset.Name, rrset.Type)
+	if current, ok := r.rrsets[key]; ok {
+		for _, rdata := range rrset.Rdatas {
+			current.AddRdata(rdata)
+		}
+	} else {
+		r.rrsets[key] = rrset.Clone()
+	}
+}
+
+// Get returns nil if the rrset doesn't exist
+func (r *Records) Get(name *g53.Name, typ g53.RRType) *g53.RRset {
+	return r.rrsets[recordKey(name, typ)]
+}
+
+func recordKey(name *g53.Name, typ g53.RRType) string {
+	return strings.ToLower(name.String(false)) + "/" + typ.String()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+	"github.com/zdnscloud/vanguard2-controller/conformance"
+	"github.com/zdnscloud/vanguard2-controller/controller"
+	"github.com/zdnscloud/vanguard2-controller/crd"
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// records to check come from zone file, zone transfer, or are rendered by
+// controller if neither is specified
+func runConformance(args []string) error {
+	var manifests, clusterDomain, clusterDomainAliases, serviceIPRange, podIPRange, serverAddress, zoneFile, configFile string
+	var jsonOutput bool
+	var xfr controller.XFRConfig
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	fs.StringVar(&manifests, "f", "", "yaml or json manifest file, or directory of manifests")
+	fs.StringVar(&clusterDomain, "cluster-domain", "cluster.local", "k8s cluster domain")
+	fs.StringVar(&clusterDomainAliases, "cluster-domain-aliases", "", "comma separated domains where records of cluster domain are published as well")
+	fs.StringVar(&configFile, "config", "", "controller config file, its naming schemes, cluster domain and aliases are checked")
+	fs.StringVar(&serviceIPRange, "service-ip-range", "", "comma separated networks of service ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&podIPRange, "pod-ip-range", "", "comma separated networks of pod ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&serverAddress, "dns-server", "", "k8s dns service address")
+	fs.StringVar(&zoneFile, "zone-file", "", "records to check in master file format, like the output of render")
+	fs.StringVar(&xfr.Server, "xfr-server", "", "dns server address to transfer the zones to check from")
+	fs.StringVar(&xfr.TSIGKey, "tsig-key", "", "tsig key name to sign zone transfer")
+	fs.StringVar(&xfr.TSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	fs.StringVar(&xfr.TSIGAlgorithm, "tsig-algorithm", "hmac-md5", "tsig algorithm")
+	fs.BoolVar(&jsonOutput, "json", false, "print deviations as json")
+	fs.Parse(args)
+
+	if manifests == "" {
+		return fmt.Errorf("manifests should be specified with -f")
+	}
+
+	naming, err := loadConfigFile(configFile, config.Config{
+		ClusterDomain:        clusterDomain,
+		ClusterDomainAliases: splitList(clusterDomainAliases),
+	})
+	if err != nil {
+		return err
+	}
+	namers, err := controller.NewNamers(naming.ClusterDomain, naming.Naming, naming.ClusterDomainAliases)
+	if err != nil {
+		return err
+	}
+
+	if err := crd.AddToScheme(scheme.Scheme); err != nil {
+		return err
+	}
+	objs, err := util.LoadObjects(manifests)
+	if err != nil {
+		return err
+	}
+
+	var records *conformance.Records
+	switch {
+	case zoneFile != "":
+		records, err = conformance.LoadRecords(zoneFile)
+	case xfr.Server != "":
+		records, err = transferRecords(xfr, namers, serviceIPRange, podIPRange)
+	default:
+		records, err = renderRecords(objs, naming, serviceIPRange, podIPRange, serverAddress)
+	}
+	if err != nil {
+		return err
+	}
+
+	var checkNamers []conformance.Namer
+	for _, namer := range namers {
+		checkNamers = append(checkNamers, namer)
+	}
+	report := conformance.Check(objs, records, checkNamers)
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+	} else {
+		report.Write(os.Stdout)
+	}
+
+	if len(report.Deviations) != 0 {
+		return fmt.Errorf("%d deviations found", len(report.Deviations))
+	}
+	return nil
+}
+
+func transferRecords(xfr controller.XFRConfig, namers []controller.Namer, serviceIPRange, podIPRange string) (*conformance.Records, error) {
+	var zones []*g53.Name
+	for _, namer := range namers {
+		if hasName(zones, namer.Zone()) == false {
+			zones = append(zones, namer.Zone())
+		}
+	}
+	for _, ipRange := range []string{serviceIPRange, podIPRange} {
+		if ipRange != "" {
+			reverseZones, err := util.ReverseZoneNames(ipRange)
+			if err != nil {
+				return nil, err
+			}
+			zones = append(zones, reverseZones...)
+		}
+	}
+
+	var rrsets []*g53.RRset
+	for _, zone := range zones {
+		var err error
+		var tsig *g53.TSIG
+		if xfr.TSIGKey != "" {
+			if tsig, err = g53.NewTSIG(xfr.TSIGKey, xfr.TSIGSecret, xfr.TSIGAlgorithm); err != nil {
+				return nil, err
+			}
+		}
+		zoneRRsets, err := util.AXFR(xfr.Server, controller.DefaultView, zone, tsig)
+		if err != nil {
+			return nil, fmt.Errorf("transfer zone %s failed:%s", zone.String(false), err.Error())
+		}
+		rrsets = append(rrsets, zoneRRsets...)
+	}
+	return conformance.NewRecords(rrsets), nil
+}
+
+func renderRecords(objs []runtime.Object, naming *config.Config, serviceIPRange, podIPRange, serverAddress string) (*conformance.Records, error) {
+	cfg := *naming
+	cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer = serviceIPRange, podIPRange, serverAddress
+	store := memstore.New()
+	client, err := newOfflineClient(store, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := controller.Options{FlattenExternalNames: naming.FlattenExternalNames}
+	if _, err := controller.NewOfflineController(client, objs, opts); err != nil {
+		return nil, err
+	}
+
+	var rrsets []*g53.RRset
+	for _, zone := range store.Zones(controller.DefaultView) {
+		zoneRRsets, err := store.RRsets(controller.DefaultView, zone)
+		if err != nil {
+			return nil, err
+		}
+		rrsets = append(rrsets, zoneRRsets...)
+	}
+	return conformance.NewRecords(rrsets), nil
+}
+
+func hasName(names []*g53.Name, name *g53.Name) bool {
+	for _, n := range names {
+		if n.Equals(name) {
+			return true
+		}
+	}
+	return false
+}
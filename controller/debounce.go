@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// debouncer coalesces the changes of a key, the key is added to queue after
+// it keeps quiet for window, but no later than maxDelay after its first
+// pending change
+type debouncer struct {
+	window   time.Duration
+	maxDelay time.Duration
+	add      func(types.NamespacedName)
+
+	lock    sync.Mutex
+	pending map[types.NamespacedName]*pendingKey
+}
+
+type pendingKey struct {
+	first time.Time
+	timer *time.Timer
+}
+
+func newDebouncer(window, maxDelay time.Duration, add func(types.NamespacedName)) *debouncer {
+	if maxDelay < window {
+		maxDelay = window
+	}
+	return &debouncer{
+		window:   window,
+		maxDelay: maxDelay,
+		add:      add,
+		pending:  make(map[types.NamespacedName]*pendingKey),
+	}
+}
+
+func (d *debouncer) touch(key types.NamespacedName) {
+	if d.window <= 0 {
+		d.add(key)
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := time.Now()
+	p, ok := d.pending[key]
+	if ok == false {
+		p = &pendingKey{first: now}
+		p.timer = time.AfterFunc(d.window, func() { d.fire(key, p) })
+		d.pending[key] = p
+		return
+	}
+
+	delay := d.window
+	if deadline := p.first.Add(d.maxDelay); now.Add(delay).After(deadline) {
+		delay = deadline.Sub(now)
+	}
+	p.timer.Reset(delay)
+}
+
+func (d *debouncer) fire(key types.NamespacedName, p *pendingKey) {
+	d.lock.Lock()
+	if d.pending[key] != p {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.lock.Unlock()
+	d.add(key)
+}
+
+// cancel drops the pending change of key, since the key is added to queue
+// by others
+func (d *debouncer) cancel(key types.NamespacedName) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if p, ok := d.pending[key]; ok {
+		p.timer.Stop()
+		delete(d.pending, key)
+	}
+}
+
+// flush adds all pending keys to queue without waiting
+func (d *debouncer) flush() {
+	d.lock.Lock()
+	var keys []types.NamespacedName
+	for key, p := range d.pending {
+		p.timer.Stop()
+		delete(d.pending, key)
+		keys = append(keys, key)
+	}
+	d.lock.Unlock()
+	for _, key := range keys {
+		d.add(key)
+	}
+}
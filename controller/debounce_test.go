@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type addedKey struct {
+	key  types.NamespacedName
+	time time.Time
+}
+
+type keyRecorder struct {
+	lock  sync.Mutex
+	added []addedKey
+}
+
+func (r *keyRecorder) add(key types.NamespacedName) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.added = append(r.added, addedKey{key, time.Now()})
+}
+
+func (r *keyRecorder) keys() []addedKey {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]addedKey(nil), r.added...)
+}
+
+var (
+	keyA = types.NamespacedName{Namespace: "default", Name: "a"}
+	keyB = types.NamespacedName{Namespace: "default", Name: "b"}
+)
+
+func TestDebouncerWithoutWindow(t *testing.T) {
+	r := &keyRecorder{}
+	d := newDebouncer(0, 0, r.add)
+	d.touch(keyA)
+	d.touch(keyA)
+	if added := r.keys(); len(added) != 2 {
+		t.Errorf("key should be added on every touch without window, but get %d", len(added))
+	}
+}
+
+func TestDebouncerCoalesceInWindow(t *testing.T) {
+	window := 50 * time.Millisecond
+	r := &keyRecorder{}
+	d := newDebouncer(window, time.Second, r.add)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		d.touch(keyA)
+		time.Sleep(window / 5)
+	}
+	d.touch(keyB)
+	lastTouch := time.Now()
+	time.Sleep(3 * window)
+
+	added := r.keys()
+	if len(added) != 2 {
+		t.Fatalf("changes in window should be coalesced to one add per key, but get %v", added)
+	}
+	for _, a := range added {
+		if a.key == keyA && a.time.Sub(start) < window {
+			t.Errorf("key shouldn't be added before it keeps quiet for window")
+		}
+		if a.key == keyB && a.time.Sub(lastTouch) < window-time.Millisecond {
+			t.Errorf("key shouldn't be added before window passed")
+		}
+	}
+}
+
+func TestDebouncerMaxDelay(t *testing.T) {
+	window := 40 * time.Millisecond
+	maxDelay := 100 * time.Millisecond
+	r := &keyRecorder{}
+	d := newDebouncer(window, maxDelay, r.add)
+
+	start := time.Now()
+	for time.Since(start) < 3*maxDelay {
+		d.touch(keyA)
+		time.Sleep(window / 4)
+	}
+	time.Sleep(2 * window)
+
+	added := r.keys()
+	//keep touching never lets the key quiet for window, only maxDelay fires
+	if len(added) < 2 || len(added) > 4 {
+		t.Fatalf("key should be added about every maxDelay, but get %d adds", len(added))
+	}
+	if first := added[0].time.Sub(start); first < maxDelay-time.Millisecond || first > maxDelay+window {
+		t.Errorf("key should be added once maxDelay passed, but it's added after %v", first)
+	}
+}
+
+func TestDebouncerCancel(t *testing.T) {
+	window := 30 * time.Millisecond
+	r := &keyRecorder{}
+	d := newDebouncer(window, window, r.add)
+
+	d.touch(keyA)
+	d.touch(keyB)
+	d.cancel(keyA)
+	//cancel of key without pending change is ignored
+	d.cancel(types.NamespacedName{Namespace: "default", Name: "c"})
+	time.Sleep(3 * window)
+
+	added := r.keys()
+	if len(added) != 1 || added[0].key != keyB {
+		t.Errorf("canceled key shouldn't be added, but get %v", added)
+	}
+
+	//key is debounced again after cancel
+	d.touch(keyA)
+	time.Sleep(3 * window)
+	if added := r.keys(); len(added) != 2 || added[1].key != keyA {
+		t.Errorf("key should be added after touched again, but get %v", added)
+	}
+}
+
+func TestDebouncerFlush(t *testing.T) {
+	r := &keyRecorder{}
+	d := newDebouncer(time.Hour, time.Hour, r.add)
+
+	d.touch(keyA)
+	d.touch(keyB)
+	d.touch(keyA)
+	if added := r.keys(); len(added) != 0 {
+		t.Fatalf("key shouldn't be added before window passed, but get %v", added)
+	}
+
+	d.flush()
+	var keys []string
+	for _, a := range r.keys() {
+		keys = append(keys, a.key.String())
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != keyA.String() || keys[1] != keyB.String() {
+		t.Errorf("flush should add every pending key once, but get %v", keys)
+	}
+
+	d.flush()
+	if added := r.keys(); len(added) != 2 {
+		t.Errorf("flushed keys shouldn't be added again, but get %d adds", len(added))
+	}
+}
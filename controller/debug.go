@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zdnscloud/g53"
+)
+
+const (
+	ObjectKindService   = "Service"
+	ObjectKindEndpoints = "Endpoints"
+)
+
+type ZoneInfo struct {
+	View string `json:"view"`
+	Zone string `json:"zone"`
+}
+
+type ObjectRecords struct {
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	RRsets    []PushedRRset `json:"rrsets"`
+	Errors    []RRsetError  `json:"errors"`
+}
+
+// ObjectError is the last error of rrset generated by the object, object
+// fields are empty if the rrset doesn't belong to any service
+type ObjectError struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	RRsetError
+}
+
+// DebugHandler serves read only debug api of the controller, zones are
+// transferred from the server in xfr to compare with desired state, the other
+// apis read the state kept in memory. The api isn't authenticated, so diff
+// can only be applied by the diff command
+func (c *Controller) DebugHandler(xfr XFRConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/diff", c.readOnly(func(w http.ResponseWriter, r *http.Request) {
+		c.serveDiff(w, r, xfr)
+	}))
+	mux.HandleFunc("/debug/zones", c.readOnly(c.serveZones))
+	mux.HandleFunc("/debug/rrsets", c.readOnly(c.serveRRsets))
+	mux.HandleFunc("/debug/records", c.readOnly(c.serveObjectRecords))
+	mux.HandleFunc("/debug/errors", c.readOnly(c.serveErrors))
+	mux.HandleFunc("/debug/queue", c.readOnly(c.serveQueue))
+	return mux
+}
+
+func (c *Controller) readOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c.reloadLock.RLock()
+		defer c.reloadLock.RUnlock()
+		h(w, r)
+	}
+}
+
+func (c *Controller) serveDiff(w http.ResponseWriter, r *http.Request, xfr XFRConfig) {
+	diffs, err := c.Diff(xfr)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, diffs)
+}
+
+func (c *Controller) serveZones(w http.ResponseWriter, r *http.Request) {
+	store := c.client.state.store
+	zones := []ZoneInfo{}
+	for _, view := range store.Views() {
+		for _, zone := range store.Zones(view) {
+			zones = append(zones, ZoneInfo{View: view, Zone: zone})
+		}
+	}
+	writeJSON(w, zones)
+}
+
+// view and zone are optional filters, default view is selected by empty
+// view parameter only if it's given
+func (c *Controller) serveRRsets(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	_, filterView := query["view"]
+	view := query.Get("view")
+	var zone *g53.Name
+	if z := query.Get("zone"); z != "" {
+		var err error
+		if zone, err = g53.NameFromString(z); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	rrsets := []PushedRRset{}
+	for _, rrset := range c.client.state.findRRsets(func(*g53.RRset) bool { return true }) {
+		if filterView && rrset.View != view {
+			continue
+		}
+		if zone != nil && rrset.Zone != zone.String(false) {
+			continue
+		}
+		rrsets = append(rrsets, rrset)
+	}
+	writeJSON(w, rrsets)
+}
+
+// records of service are its own name and reverse name of cluster ip,
+// records of endpoints are the names under service name, pod reverse names
+// included
+func (c *Controller) serveObjectRecords(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	records := ObjectRecords{
+		Kind:      query.Get("kind"),
+		Namespace: query.Get("namespace"),
+		Name:      query.Get("name"),
+		RRsets:    []PushedRRset{},
+		Errors:    []RRsetError{},
+	}
+	if records.Namespace == "" || records.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("namespace and name should be specified"))
+		return
+	}
+
+	var match func(*g53.Name) bool
+	serviceName, err := c.client.getServiceNameByKey(records.Name, records.Namespace)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch strings.ToLower(records.Kind) {
+	case strings.ToLower(ObjectKindService):
+		records.Kind = ObjectKindService
+		match = func(n *g53.Name) bool { return n.Equals(serviceName) }
+	case strings.ToLower(ObjectKindEndpoints):
+		records.Kind = ObjectKindEndpoints
+		match = func(n *g53.Name) bool {
+			return n.Compare(serviceName, false).Relation == g53.SUBDOMAIN
+		}
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("kind should be %s or %s", ObjectKindService, ObjectKindEndpoints))
+		return
+	}
+
+	records.RRsets = append(records.RRsets, c.client.state.findRRsets(func(rrset *g53.RRset) bool {
+		if rrset.Type == g53.RR_PTR {
+			return match(rrset.Rdatas[0].(*g53.PTR).Name)
+		}
+		return match(rrset.Name)
+	})...)
+	for _, e := range c.client.state.getErrors() {
+		if name := rrsetErrorOwnerName(e); name != nil && match(name) {
+			records.Errors = append(records.Errors, e)
+		}
+	}
+	writeJSON(w, records)
+}
+
+func (c *Controller) serveErrors(w http.ResponseWriter, r *http.Request) {
+	errors := []ObjectError{}
+	for _, e := range c.client.state.getErrors() {
+		objErr := ObjectError{RRsetError: e}
+		if name := rrsetErrorOwnerName(e); name != nil {
+			objErr.Kind, objErr.Namespace, objErr.Name = c.client.getObjectOfName(name)
+		}
+		errors = append(errors, objErr)
+	}
+	writeJSON(w, errors)
+}
+
+func (c *Controller) serveQueue(w http.ResponseWriter, r *http.Request) {
+	m := queueMetrics.snapshot(ServiceQueueName)
+	m.Workers = c.workers()
+	m.BusyWorkers = atomic.LoadInt64(&c.busyWorkers)
+	writeJSON(w, m)
+}
+
+// ptr rrset belongs to the object of its target
+func rrsetErrorOwnerName(e RRsetError) *g53.Name {
+	if e.Type == "PTR" {
+		if len(e.Rdatas) == 0 {
+			return nil
+		}
+		name, _ := g53.NameFromString(e.Rdatas[0])
+		return name
+	}
+	name, _ := g53.NameFromString(e.Name)
+	return name
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
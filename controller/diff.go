@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/crd"
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const (
+	DiffActionAdd    = "add"
+	DiffActionDelete = "delete"
+	DiffActionUpdate = "update"
+)
+
+// XFRConfig is the dns server to transfer zones from, tsig is used if
+// TSIGKey isn't empty
+type XFRConfig struct {
+	Server        string
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+}
+
+func (cfg XFRConfig) tsig() (*g53.TSIG, error) {
+	if cfg.TSIGKey == "" {
+		return nil, nil
+	}
+	return g53.NewTSIG(cfg.TSIGKey, cfg.TSIGSecret, cfg.TSIGAlgorithm)
+}
+
+type RRsetDiff struct {
+	View    string   `json:"view"`
+	Zone    string   `json:"zone"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Action  string   `json:"action"`
+	Desired []string `json:"desired,omitempty"`
+	Actual  []string `json:"actual,omitempty"`
+
+	zone    *g53.Name
+	desired *g53.RRset
+	actual  *g53.RRset
+}
+
+// Diff compares the records generated from current cluster state with the
+// zones transferred from dns server in every view, soa and owner records are
+// ignored
+func (c *Controller) Diff(cfg XFRConfig) ([]RRsetDiff, error) {
+	desired, err := c.desiredState()
+	if err != nil {
+		return nil, err
+	}
+
+	tsig, err := cfg.tsig()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []RRsetDiff
+	for _, view := range desired.Views() {
+		for _, zone := range desired.Zones(view) {
+			zoneName := g53.NameFromStringUnsafe(zone)
+			desiredRRsets, err := desired.RRsets(view, zone)
+			if err != nil {
+				return nil, err
+			}
+
+			actualRRsets, err := util.AXFR(cfg.Server, view, zoneName, tsig)
+			if err != nil {
+				return nil, fmt.Errorf("transfer zone %s in view %q failed:%s", zone, view, err.Error())
+			}
+
+			zoneDiffs := diffRRsets(view, zoneName, desiredRRsets, actualRRsets)
+			if c.client.registry != nil {
+				zoneDiffs = c.client.registry.ignoreForeignRRsets(zoneDiffs, actualRRsets)
+			}
+			diffs = append(diffs, zoneDiffs...)
+		}
+	}
+	return diffs, nil
+}
+
+// ApplyDiff makes the dns server match the desired state
+func (c *Controller) ApplyDiff(diffs []RRsetDiff) error {
+	var failed int
+	for _, diff := range diffs {
+		var err error
+		switch diff.Action {
+		case DiffActionAdd, DiffActionUpdate:
+			err = c.client.replaceRRsetInView(diff.View, diff.zone, diff.desired)
+		case DiffActionDelete:
+			err = c.client.deleteRRsetInView(diff.View, diff.zone, diff.actual.Name, diff.actual.Type)
+		}
+		if err != nil {
+			failed += 1
+			log.Printf("%s rrset %s %s in view %q failed:%s", diff.Action, diff.Name, diff.Type, diff.View, err.Error())
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d changes failed", failed, len(diffs))
+	}
+	return nil
+}
+
+func diffRRsets(view string, zone *g53.Name, desired, actual []*g53.RRset) []RRsetDiff {
+	actualIndex := make(map[string]*g53.RRset)
+	for _, rrset := range actual {
+		if isIgnoredInDiff(rrset) == false {
+			actualIndex[rrsetKey(rrset.Name, rrset.Type)] = rrset
+		}
+	}
+
+	var diffs []RRsetDiff
+	for _, rrset := range desired {
+		if isIgnoredInDiff(rrset) {
+			continue
+		}
+
+		key := rrsetKey(rrset.Name, rrset.Type)
+		if old, ok := actualIndex[key]; ok == false {
+			diffs = append(diffs, newRRsetDiff(view, zone, DiffActionAdd, rrset, nil))
+		} else {
+			delete(actualIndex, key)
+			if isRRsetEqual(old, rrset) == false {
+				diffs = append(diffs, newRRsetDiff(view, zone, DiffActionUpdate, rrset, old))
+			}
+		}
+	}
+
+	for _, rrset := range actual {
+		if _, ok := actualIndex[rrsetKey(rrset.Name, rrset.Type)]; ok {
+			diffs = append(diffs, newRRsetDiff(view, zone, DiffActionDelete, nil, rrset))
+		}
+	}
+	return diffs
+}
+
+// zone shared with other writers, rrsets without our owner record aren't
+// deleted
+func (r *ownerRegistry) ignoreForeignRRsets(diffs []RRsetDiff, actual []*g53.RRset) []RRsetDiff {
+	owned := make(map[string]struct{})
+	for _, rrset := range actual {
+		if rrset.Type != g53.RR_TXT {
+			continue
+		}
+		//owner record may be shared with other writers
+		for _, rdata := range rrset.Rdatas {
+			owned[rrsetKey(rrset.Name, rrset.Type)+"/"+rdata.String()] = struct{}{}
+		}
+	}
+
+	var result []RRsetDiff
+	ownerValue := (&g53.Txt{Data: []string{r.ownerValue()}}).String()
+	for _, diff := range diffs {
+		if diff.Action == DiffActionDelete {
+			ownerName := r.ownerName(diff.actual.Name, diff.actual.Type)
+			if _, ok := owned[rrsetKey(ownerName, g53.RR_TXT)+"/"+ownerValue]; ok == false {
+				continue
+			}
+		}
+		result = append(result, diff)
+	}
+	return result
+}
+
+func newRRsetDiff(view string, zone *g53.Name, action string, desired, actual *g53.RRset) RRsetDiff {
+	header := desired
+	if header == nil {
+		header = actual
+	}
+	return RRsetDiff{
+		View:    view,
+		Zone:    zone.String(false),
+		Name:    header.Name.String(false),
+		Type:    header.Type.String(),
+		Action:  action,
+		Desired: rdataStrings(desired),
+		Actual:  rdataStrings(actual),
+		zone:    zone,
+		desired: desired,
+		actual:  actual,
+	}
+}
+
+func (d RRsetDiff) String() string {
+	switch d.Action {
+	case DiffActionAdd:
+		return fmt.Sprintf("+ %s %s %s", d.Name, d.Type, strings.Join(d.Desired, ", "))
+	case DiffActionDelete:
+		return fmt.Sprintf("- %s %s %s", d.Name, d.Type, strings.Join(d.Actual, ", "))
+	default:
+		return fmt.Sprintf("~ %s %s %s -> %s", d.Name, d.Type, strings.Join(d.Actual, ", "), strings.Join(d.Desired, ", "))
+	}
+}
+
+func isIgnoredInDiff(rrset *g53.RRset) bool {
+	return rrset.Type == g53.RR_SOA ||
+		strings.HasPrefix(rrset.Name.String(false), OwnerRecordPrefix)
+}
+
+func rdataStrings(rrset *g53.RRset) []string {
+	if rrset == nil {
+		return nil
+	}
+
+	ss := make([]string, 0, len(rrset.Rdatas))
+	for _, rdata := range rrset.Rdatas {
+		ss = append(ss, rdata.String())
+	}
+	return ss
+}
+
+// desiredState generates all the records from objects in cache into a memory
+// store
+func (c *Controller) desiredState() (*memstore.Store, error) {
+	//namespaces are required by view label and namespace selector
+	lists := []runtime.Object{&corev1.ServiceList{}, &corev1.EndpointsList{}, &corev1.NamespaceList{}}
+	if c.opts.WatchIngress {
+		lists = append(lists, &extv1beta1.IngressList{})
+	}
+	if c.opts.WatchDNSResource {
+		lists = append(lists, &crd.DNSZoneList{}, &crd.DNSRecordList{})
+	}
+	if c.opts.WatchPods {
+		lists = append(lists, &corev1.PodList{})
+	}
+
+	var objs []runtime.Object
+	for _, list := range lists {
+		if err := c.cache.List(context.TODO(), nil, list); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, items...)
+	}
+
+	store := memstore.New()
+	client, err := c.client.cloneWithBackend(store)
+	if err != nil {
+		return nil, err
+	}
+	offline, err := NewOfflineController(client, objs, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	//services exported by member clusters aren't in local cache
+	if c.clusterset != nil {
+		offline.clusterset = c.clusterset
+		if err := offline.enqueueClustersetServices(); err != nil {
+			return nil, err
+		}
+		offline.processQueue()
+	}
+	return store, nil
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/zdnscloud/g53"
+)
+
+// rrset is deleted if any rdata of its owner record is ours
+func TestIgnoreForeignRRsets(t *testing.T) {
+	r := newOwnerRegistry("east", "")
+	zone := g53.NameFromStringUnsafe(testClusterDomain)
+	rrset := func(s string) *g53.RRset {
+		rrset, err := g53.RRsetFromString(s)
+		if err != nil {
+			t.Fatalf("invalid rrset %s:%s", s, err.Error())
+		}
+		return rrset
+	}
+
+	ours := rrset("a.cluster.local 5 IN A 10.43.0.1")
+	foreign := rrset("b.cluster.local 5 IN A 10.43.0.2")
+	owner := r.ownerRRset(ours.Name, ours.Type)
+	owner.Rdatas = append([]g53.Rdata{&g53.Txt{Data: []string{OwnerHeritage + ",owner=west"}}}, owner.Rdatas...)
+	actual := []*g53.RRset{ours, foreign, owner}
+
+	diffs := r.ignoreForeignRRsets([]RRsetDiff{
+		newRRsetDiff(DefaultView, zone, DiffActionDelete, nil, ours),
+		newRRsetDiff(DefaultView, zone, DiffActionDelete, nil, foreign),
+	}, actual)
+	if len(diffs) != 1 || diffs[0].actual != ours {
+		t.Errorf("only rrset owned by us should be deleted:%v", diffs)
+	}
+}
@@ -0,0 +1,432 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/zdnscloud/vanguard2-controller/crd"
+)
+
+const (
+	DefaultZoneSerial  = 1981616
+	DefaultZoneRefresh = 1800
+	DefaultZoneRetry   = 900
+	DefaultZoneExpire  = 604800
+	DefaultZoneMinimum = 86400
+)
+
+// dnsZoneKey is the name of DNSZone, it shares the queue with services
+type dnsZoneKey string
+
+// dnsRecordKey shares the queue with services
+type dnsRecordKey types.NamespacedName
+
+// dnsZoneOwners tracks the zone created for each DNSZone, a zone is only
+// created for one of the DNSZones declaring it
+type dnsZoneOwners struct {
+	lock  sync.Mutex
+	zones map[string]*g53.Name
+}
+
+func newDNSZoneOwners() *dnsZoneOwners {
+	return &dnsZoneOwners{zones: make(map[string]*g53.Name)}
+}
+
+func (o *dnsZoneOwners) get(owner string) *g53.Name {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.zones[owner]
+}
+
+func (o *dnsZoneOwners) claim(owner string, zone *g53.Name) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for other, z := range o.zones {
+		if other != owner && z.Equals(zone) {
+			return fmt.Errorf("zone %s is declared by DNSZone %s", zone.String(false), other)
+		}
+	}
+	o.zones[owner] = zone
+	return nil
+}
+
+// transfer hands the zone of owner over to other, release if other is empty
+func (o *dnsZoneOwners) transfer(owner, other string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if other != "" {
+		o.zones[other] = o.zones[owner]
+	}
+	delete(o.zones, owner)
+}
+
+// rrsets of a name declared by several DNSRecords are merged by type, the
+// rrset of each type comes from the first DNSRecord in namespace/name order
+func newDNSRecordRegistry() *nameRegistry {
+	return newNameRegistry(func(owners map[types.NamespacedName][]*g53.RRset) []*g53.RRset {
+		var rrsets []*g53.RRset
+		for _, owner := range sortedOwners(owners) {
+			for _, rrset := range owners[owner] {
+				if findRRset(rrsets, rrset.Type) == nil {
+					rrsets = append(rrsets, rrset)
+				}
+			}
+		}
+		return rrsets
+	})
+}
+
+// reconcileDNSZone creates the zone of the DNSZone in cache and deletes the
+// zone it declared before, invalid spec is reported in status and isn't
+// retried
+func (c *Controller) reconcileDNSZone(name string) error {
+	var zone crd.DNSZone
+	if err := c.cache.Get(context.TODO(), types.NamespacedName{Name: name}, &zone); err != nil {
+		if apierrors.IsNotFound(err) {
+			return c.releaseDNSZone(name)
+		}
+		return err
+	}
+
+	zoneName, err := g53.NameFromString(zone.Spec.Zone)
+	if err != nil {
+		c.updateDNSZoneStatus(&zone, fmt.Errorf("invalid zone name %s:%s", zone.Spec.Zone, err.Error()))
+		return c.releaseDNSZone(name)
+	}
+	if old := c.dnsZones.get(name); old != nil && old.Equals(zoneName) == false {
+		if err := c.releaseDNSZone(name); err != nil {
+			return err
+		}
+	}
+
+	if managed := c.client.getZone(zoneName); managed != nil && managed.Equals(zoneName) && c.client.isCustomZone(zoneName) == false {
+		c.updateDNSZoneStatus(&zone, fmt.Errorf("zone %s is managed by controller", zone.Spec.Zone))
+		return nil
+	}
+	params, err := dnsZoneTemplateParameter(zoneName, &zone.Spec)
+	if err == nil {
+		err = c.dnsZones.claim(name, zoneName)
+	}
+	if err != nil {
+		c.updateDNSZoneStatus(&zone, err)
+		return nil
+	}
+
+	_, err = c.client.createCustomZone(zoneName, CustomZoneTemplate, params)
+	c.updateDNSZoneStatus(&zone, err)
+	if err != nil {
+		return err
+	}
+	//records may be handled before the zone exists
+	return c.enqueueDNSRecordsInZone(zoneName)
+}
+
+// releaseDNSZone deletes the zone created for the DNSZone with the records
+// in it, zone still declared by another DNSZone is handed over to it
+func (c *Controller) releaseDNSZone(name string) error {
+	zone := c.dnsZones.get(name)
+	if zone == nil {
+		return nil
+	}
+
+	var zones crd.DNSZoneList
+	if err := c.cache.List(context.TODO(), nil, &zones); err != nil {
+		return err
+	}
+	for _, other := range zones.Items {
+		if z, err := g53.NameFromString(other.Spec.Zone); err == nil && other.Name != name && z.Equals(zone) {
+			c.dnsZones.transfer(name, other.Name)
+			c.queue.Add(dnsZoneKey(other.Name))
+			return nil
+		}
+	}
+
+	//records are kept in zone shared with other writers unless withdrawn
+	for _, owner := range c.dnsRecords.owners() {
+		records := c.dnsRecords.records(owner)
+		var kept []serviceRecord
+		for _, r := range records {
+			if r.zone.Equals(zone) == false {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == len(records) {
+			continue
+		}
+		if err := c.publishShared(c.dnsRecords, owner, kept, "dns records"); err != nil {
+			return err
+		}
+	}
+	if err := c.client.deleteCustomZone(zone); err != nil {
+		return err
+	}
+	c.dnsRecords.forgetZone(DefaultView, zone)
+	c.dnsZones.transfer(name, "")
+	return c.enqueueDNSRecordsInZone(zone)
+}
+
+func (c *Controller) enqueueDNSRecordsInZone(zone *g53.Name) error {
+	var records crd.DNSRecordList
+	if err := c.cache.List(context.TODO(), nil, &records); err != nil {
+		return err
+	}
+	for _, record := range records.Items {
+		if name, err := g53.NameFromString(record.Spec.Name); err == nil && isNameInZone(name, zone) {
+			c.queue.Add(dnsRecordKey{Namespace: record.Namespace, Name: record.Name})
+		}
+	}
+	return nil
+}
+
+func dnsZoneTemplateParameter(zoneName *g53.Name, spec *crd.DNSZoneSpec) (map[string]interface{}, error) {
+	mname, err := g53.NameFromString(spec.SOA.MName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid soa mname %s:%s", spec.SOA.MName, err.Error())
+	}
+	rname, err := g53.NameFromString(spec.SOA.RName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid soa rname %s:%s", spec.SOA.RName, err.Error())
+	}
+
+	if len(spec.NameServers) == 0 {
+		return nil, fmt.Errorf("zone %s has no name server", spec.Zone)
+	}
+
+	var nameServers []map[string]string
+	for _, ns := range spec.NameServers {
+		name, err := g53.NameFromString(ns.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name server %s:%s", ns.Name, err.Error())
+		}
+
+		nameServer := map[string]string{"name": name.String(false)}
+		if isNameInZone(name, zoneName) {
+			if ip := net.ParseIP(ns.IP); ip == nil || ip.To4() == nil {
+				return nil, fmt.Errorf("name server %s in zone should have ipv4 address", ns.Name)
+			}
+			nameServer["ip"] = ns.IP
+		}
+		nameServers = append(nameServers, nameServer)
+	}
+
+	return map[string]interface{}{
+		"origin":      zoneName.String(false),
+		"ttl":         ttlOrDefault(spec.TTL),
+		"mname":       mname.String(false),
+		"rname":       rname.String(false),
+		"serial":      valueOrDefault(spec.SOA.Serial, DefaultZoneSerial),
+		"refresh":     valueOrDefault(spec.SOA.Refresh, DefaultZoneRefresh),
+		"retry":       valueOrDefault(spec.SOA.Retry, DefaultZoneRetry),
+		"expire":      valueOrDefault(spec.SOA.Expire, DefaultZoneExpire),
+		"minimum":     valueOrDefault(spec.SOA.Minimum, DefaultZoneMinimum),
+		"nameServers": nameServers,
+	}, nil
+}
+
+// reconcileDNSRecord publishes the rrset of the DNSRecord in cache, only
+// the first DNSRecord in namespace/name order declaring a name and type is
+// published, the others report the conflict in status
+func (c *Controller) reconcileDNSRecord(key types.NamespacedName) error {
+	var records []serviceRecord
+	var record crd.DNSRecord
+	found := true
+	var invalid error
+	if err := c.cache.Get(context.TODO(), key, &record); err != nil {
+		if apierrors.IsNotFound(err) == false {
+			return err
+		}
+		found = false
+	} else if zone, rrset, err := c.dnsRecordToRRset(&record); err != nil {
+		invalid = err
+	} else {
+		records = append(records, serviceRecord{DefaultView, zone, rrset})
+	}
+
+	old := c.dnsRecords.records(key)
+	err := c.publishShared(c.dnsRecords, key, records, "dns records")
+	c.enqueueDNSRecordPeers(key, old, records)
+	if found {
+		status := invalid
+		if status == nil {
+			status = err
+		}
+		if status == nil {
+			status = c.dnsRecordConflict(key, records)
+		}
+		c.updateDNSRecordStatus(&record, status)
+	}
+	return err
+}
+
+// the first owner of a name and type may change, other owners update
+// their status
+func (c *Controller) enqueueDNSRecordPeers(key types.NamespacedName, old, current []serviceRecord) {
+	changed := make(map[string]serviceRecord)
+	for _, r := range old {
+		changed[r.key()] = r
+	}
+	for _, r := range current {
+		if _, ok := changed[r.key()]; ok {
+			delete(changed, r.key())
+		} else {
+			changed[r.key()] = r
+		}
+	}
+	for _, r := range changed {
+		for _, owner := range c.dnsRecords.typeOwners(r.view, r.rrset.Name, r.rrset.Type) {
+			if owner != key {
+				c.queue.Add(dnsRecordKey(owner))
+			}
+		}
+	}
+}
+
+func (c *Controller) dnsRecordConflict(key types.NamespacedName, records []serviceRecord) error {
+	for _, r := range records {
+		if owners := c.dnsRecords.typeOwners(r.view, r.rrset.Name, r.rrset.Type); len(owners) != 0 && owners[0] != key {
+			return fmt.Errorf("%s %s is declared by DNSRecord %s", r.rrset.Name.String(false), r.rrset.Type.String(), owners[0].String())
+		}
+	}
+	return nil
+}
+
+func (c *Controller) dnsRecordToRRset(record *crd.DNSRecord) (*g53.Name, *g53.RRset, error) {
+	name, err := g53.NameFromString(record.Spec.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid name %s:%s", record.Spec.Name, err.Error())
+	}
+
+	typ, err := g53.TypeFromString(record.Spec.Type)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid type %s:%s", record.Spec.Type, err.Error())
+	}
+	if isSupportedRRType(typ) == false || typ == g53.RR_SOA {
+		return nil, nil, fmt.Errorf("type %s isn't supported", record.Spec.Type)
+	}
+
+	var zone *g53.Name
+	if record.Spec.Zone != "" {
+		zone, err = g53.NameFromString(record.Spec.Zone)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zone %s:%s", record.Spec.Zone, err.Error())
+		}
+		if c.client.isCustomZone(zone) == false {
+			return nil, nil, fmt.Errorf("zone %s isn't created from DNSZone", record.Spec.Zone)
+		}
+		if isNameInZone(name, zone) == false {
+			return nil, nil, fmt.Errorf("name %s isn't in zone %s", record.Spec.Name, record.Spec.Zone)
+		}
+	} else if zone = c.client.getZone(name); zone == nil {
+		return nil, nil, fmt.Errorf("name %s isn't in any managed zone", record.Spec.Name)
+	} else if c.client.isCustomZone(zone) == false {
+		//records of services and ptrs are generated by controller
+		return nil, nil, fmt.Errorf("name %s is in zone %s generated by controller", record.Spec.Name, zone.String(false))
+	}
+
+	if len(record.Spec.Rdatas) == 0 {
+		return nil, nil, fmt.Errorf("record has no rdata")
+	}
+	var rdatas []g53.Rdata
+	for _, s := range record.Spec.Rdatas {
+		rdata, err := g53.RdataFromString(typ, s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid rdata %s:%s", s, err.Error())
+		}
+		rdatas = append(rdatas, rdata)
+	}
+
+	return zone, &g53.RRset{
+		Name:   name,
+		Type:   typ,
+		Class:  g53.CLASS_IN,
+		Ttl:    ttlOrDefault(record.Spec.TTL),
+		Rdatas: rdatas,
+	}, nil
+}
+
+func (c *Controller) updateDNSZoneStatus(zone *crd.DNSZone, err error) {
+	c.updateStatus(zone, func(latest runtime.Object) {
+		setReadyCondition(&latest.(*crd.DNSZone).Status, zone.Generation, err)
+	})
+}
+
+func (c *Controller) updateDNSRecordStatus(record *crd.DNSRecord, err error) {
+	c.updateStatus(record, func(latest runtime.Object) {
+		setReadyCondition(&latest.(*crd.DNSRecord).Status, record.Generation, err)
+	})
+}
+
+// object in cache may be stale, status is set on the latest object and
+// retried on conflict
+func (c *Controller) updateStatus(obj runtime.Object, setStatus func(runtime.Object)) {
+	//offline controller has no k8s client
+	if c.k8sClient == nil {
+		return
+	}
+
+	meta := obj.(metav1.Object)
+	key := types.NamespacedName{Namespace: meta.GetNamespace(), Name: meta.GetName()}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest := obj.DeepCopyObject()
+		if err := c.k8sClient.Get(context.TODO(), key, latest); err != nil {
+			return err
+		}
+		setStatus(latest)
+		return c.k8sClient.Status().Update(context.TODO(), latest)
+	})
+	if err != nil && apierrors.IsNotFound(err) == false {
+		log.Printf("update status of %s failed:%s", key.String(), err.Error())
+	}
+}
+
+func setReadyCondition(status *crd.Status, generation int64, err error) {
+	cond := crd.Condition{
+		Type:   crd.ConditionReady,
+		Status: corev1.ConditionTrue,
+		Reason: crd.ReasonSynced,
+	}
+	if err != nil {
+		cond.Status = corev1.ConditionFalse
+		cond.Reason = crd.ReasonSyncError
+		cond.Message = err.Error()
+	}
+
+	status.ObservedGeneration = generation
+	for i, old := range status.Conditions {
+		if old.Type == cond.Type {
+			cond.LastTransitionTime = old.LastTransitionTime
+			if old.Status != cond.Status {
+				cond.LastTransitionTime = metav1.Now()
+			}
+			status.Conditions[i] = cond
+			return
+		}
+	}
+	cond.LastTransitionTime = metav1.Now()
+	status.Conditions = append(status.Conditions, cond)
+}
+
+func ttlOrDefault(ttl uint32) g53.RRTTL {
+	if ttl == 0 {
+		return DefaultTTL
+	}
+	return g53.RRTTL(ttl)
+}
+
+func valueOrDefault(v, defaultValue uint32) uint32 {
+	if v == 0 {
+		return defaultValue
+	}
+	return v
+}
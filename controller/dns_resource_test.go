@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/vanguard2-controller/crd"
+)
+
+// custom zone is created once, updates only change the records from template
+func TestCustomZone(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+
+	zone := g53.NameFromStringUnsafe("example.com")
+	spec := func(ns, ip string) map[string]interface{} {
+		params, err := dnsZoneTemplateParameter(zone, &crd.DNSZoneSpec{
+			Zone:        "example.com",
+			SOA:         crd.SOA{MName: "ns.example.com", RName: "root.example.com"},
+			NameServers: []crd.NameServer{{Name: ns, IP: ip}},
+		})
+		if err != nil {
+			t.Fatalf("invalid zone spec:%s", err.Error())
+		}
+		return params
+	}
+
+	if created, err := env.client.createCustomZone(zone, CustomZoneTemplate, spec("ns1.example.com", "1.1.1.1")); err != nil || created == false {
+		t.Fatalf("create zone failed:%v", err)
+	}
+	www, _ := g53.RRsetFromString("www.example.com 5 IN A 2.2.2.2")
+	if err := env.client.replaceRRset(zone, www); err != nil {
+		t.Fatalf("add record failed:%s", err.Error())
+	}
+
+	if created, err := env.client.createCustomZone(zone, CustomZoneTemplate, spec("ns2.example.com", "3.3.3.3")); err != nil || created {
+		t.Fatalf("update zone failed:%v", err)
+	}
+	store := env.server.Store()
+	if store.GetRRset(DefaultView, "example.com", www.Name, g53.RR_A) == nil {
+		t.Errorf("records in zone should be kept")
+	}
+	if store.GetRRset(DefaultView, "example.com", g53.NameFromStringUnsafe("ns1.example.com"), g53.RR_A) != nil {
+		t.Errorf("glue of old name server should be deleted")
+	}
+	if ns := store.GetRRset(DefaultView, "example.com", zone, g53.RR_NS); ns == nil || len(ns.Rdatas) != 1 || ns.Rdatas[0].String() != "ns2.example.com." {
+		t.Errorf("name server should be updated:%v", ns)
+	}
+
+	if err := env.client.deleteCustomZone(zone); err != nil {
+		t.Fatalf("delete zone failed:%s", err.Error())
+	}
+	if store.GetRRset(DefaultView, "example.com", zone, g53.RR_SOA) != nil {
+		t.Errorf("zone should be deleted")
+	}
+}
+
+func dnsZone(name, zone string) *crd.DNSZone {
+	return &crd.DNSZone{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Generation: 1},
+		Spec: crd.DNSZoneSpec{
+			Zone:        zone,
+			SOA:         crd.SOA{MName: "ns." + zone, RName: "root." + zone},
+			NameServers: []crd.NameServer{{Name: "ns." + zone, IP: "1.1.1.1"}},
+		},
+	}
+}
+
+func dnsRecord(namespace, name, rrName, typ string, rdatas ...string) *crd.DNSRecord {
+	return &crd.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Generation: 1},
+		Spec:       crd.DNSRecordSpec{Name: rrName, Type: typ, Rdatas: rdatas},
+	}
+}
+
+// records of names with suffix, soa, ns and glue records of zone template
+// are excluded
+func (env *testEnv) recordsWithSuffix(suffix string) []string {
+	var records []string
+	for _, r := range env.records() {
+		fields := strings.Fields(r)
+		if strings.HasSuffix(fields[0], suffix) == false || strings.HasPrefix(fields[0], "ns.") ||
+			fields[1] == "SOA" || fields[1] == "NS" {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestDNSRecords(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{WatchDNSResource: true})
+	defer env.close()
+
+	//record before its zone is published once the zone is created
+	web := dnsRecord("prod", "web", "www.example.com", "A", "10.0.0.1")
+	env.run(step{createEvent, web})
+	if got := env.recordsWithSuffix("example.com."); len(got) != 0 {
+		t.Fatalf("record shouldn't be published without zone:%v", got)
+	}
+	zone := dnsZone("example", "example.com")
+	env.run(step{createEvent, zone})
+	want := []string{"www.example.com. A 10.0.0.1"}
+	if got := env.recordsWithSuffix("example.com."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	//rrset of the same name and type comes from the first record
+	api := dnsRecord("dev", "api", "www.example.com", "A", "10.0.0.2")
+	env.run(step{createEvent, api})
+	want = []string{"www.example.com. A 10.0.0.2"}
+	if got := env.recordsWithSuffix("example.com."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+	if err := env.ctl.dnsRecordConflict(types.NamespacedName{Namespace: "prod", Name: "web"}, env.ctl.dnsRecords.records(types.NamespacedName{Namespace: "prod", Name: "web"})); err == nil {
+		t.Errorf("conflict of record should be reported")
+	}
+	env.run(step{deleteEvent, api})
+	want = []string{"www.example.com. A 10.0.0.1"}
+	if got := env.recordsWithSuffix("example.com."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("rrset of the other record should be kept\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	//records generated by controller can't be changed
+	svc := clusterIPService("default", "db", "10.43.0.8")
+	env.run(step{createEvent, svc})
+	env.run(step{createEvent, dnsRecord("prod", "db", "db.default.svc.cluster.local", "A", "10.0.0.3")})
+	env.run(step{createEvent, dnsRecord("prod", "ptr", "8.0.43.10.in-addr.arpa", "PTR", "evil.example.com")})
+	want = []string{
+		"8.0.43.10.in-addr.arpa. PTR db.default.svc.cluster.local.",
+		"db.default.svc.cluster.local. A 10.43.0.8",
+		"www.example.com. A 10.0.0.1",
+	}
+	if got := env.recordsWithSuffix("."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records in managed zones should be rejected\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	//records are deleted with zone
+	env.run(step{deleteEvent, zone})
+	store := env.server.Store()
+	if store.GetRRset(DefaultView, "example.com", g53.NameFromStringUnsafe("example.com"), g53.RR_SOA) != nil {
+		t.Errorf("zone should be deleted")
+	}
+	env.run(step{createEvent, zone})
+	want = []string{"www.example.com. A 10.0.0.1"}
+	if got := env.recordsWithSuffix("example.com."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records should be published in recreated zone\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	//failed deletion is retried
+	env.server.Stop()
+	delete(env.objs, objectKey(web))
+	env.syncCache()
+	key := types.NamespacedName{Namespace: "prod", Name: "web"}
+	if err := env.ctl.reconcileDNSRecord(key); err == nil {
+		t.Errorf("reconcile should fail so record is retried")
+	}
+	if n := env.ctl.dnsRecords.pendingCount(); n != 1 {
+		t.Errorf("1 name should be pending but got %d", n)
+	}
+}
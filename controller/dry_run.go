@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+)
+
+const (
+	ChangeAddZone      = "add_zone"
+	ChangeDeleteZone   = "delete_zone"
+	ChangeAddRRset     = "add_rrset"
+	ChangeDeleteRRset  = "delete_rrset"
+	ChangeDeleteDomain = "delete_domain"
+	ChangeDeleteRdata  = "delete_rdata"
+	ChangeUpdateRdata  = "update_rdata"
+)
+
+// DryRunBackend records the changes instead of sending them to vanguard2,
+// every request succeeds
+type DryRunBackend struct {
+	lock sync.Mutex
+	out  io.Writer
+}
+
+type Change struct {
+	Time      time.Time     `json:"time"`
+	Operation string        `json:"operation"`
+	View      string        `json:"view"`
+	Zones     []string      `json:"zones,omitempty"`
+	Names     []string      `json:"names,omitempty"`
+	RRsets    []ChangeRRset `json:"rrsets,omitempty"`
+	OldRRset  *ChangeRRset  `json:"oldRRset,omitempty"`
+}
+
+type ChangeRRset struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    uint32   `json:"ttl,omitempty"`
+	Rdatas []string `json:"rdatas,omitempty"`
+}
+
+var _ pb.DynamicUpdateInterfaceClient = &DryRunBackend{}
+
+// changes are written to out as json lines, or logged if out is nil
+func NewDryRunBackend(out io.Writer) *DryRunBackend {
+	return &DryRunBackend{
+		out: out,
+	}
+}
+
+func (b *DryRunBackend) AddZone(ctx context.Context, in *pb.AddZoneRequest, opts ...grpc.CallOption) (*pb.AddZoneResponse, error) {
+	b.record(&Change{Operation: ChangeAddZone, View: in.View, Zones: []string{in.Zone}})
+	return &pb.AddZoneResponse{}, nil
+}
+
+func (b *DryRunBackend) DeleteZone(ctx context.Context, in *pb.DeleteZoneRequest, opts ...grpc.CallOption) (*pb.DeleteZoneResponse, error) {
+	b.record(&Change{Operation: ChangeDeleteZone, View: in.View, Zones: in.Zones})
+	return &pb.DeleteZoneResponse{}, nil
+}
+
+func (b *DryRunBackend) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (*pb.AddRRsetResponse, error) {
+	b.record(&Change{Operation: ChangeAddRRset, View: in.View, Zones: []string{in.Zone}, RRsets: changeRRsets(in.Rrsets)})
+	return &pb.AddRRsetResponse{}, nil
+}
+
+func (b *DryRunBackend) DeleteDomain(ctx context.Context, in *pb.DeleteDomainRequest, opts ...grpc.CallOption) (*pb.DeleteDomainResponse, error) {
+	b.record(&Change{Operation: ChangeDeleteDomain, View: in.View, Zones: []string{in.Zone}, Names: in.Names})
+	return &pb.DeleteDomainResponse{}, nil
+}
+
+func (b *DryRunBackend) DeleteRRset(ctx context.Context, in *pb.DeleteRRsetRequest, opts ...grpc.CallOption) (*pb.DeleteRRsetResponse, error) {
+	var rrsets []ChangeRRset
+	for _, header := range in.Rrsets {
+		rrsets = append(rrsets, ChangeRRset{Name: header.Name, Type: header.Type.String()})
+	}
+	b.record(&Change{Operation: ChangeDeleteRRset, View: in.View, Zones: []string{in.Zone}, RRsets: rrsets})
+	return &pb.DeleteRRsetResponse{}, nil
+}
+
+func (b *DryRunBackend) DeleteRdata(ctx context.Context, in *pb.DeleteRdataRequest, opts ...grpc.CallOption) (*pb.DeleteRdataResponse, error) {
+	b.record(&Change{Operation: ChangeDeleteRdata, View: in.View, Zones: []string{in.Zone}, RRsets: changeRRsets(in.Rrsets)})
+	return &pb.DeleteRdataResponse{}, nil
+}
+
+func (b *DryRunBackend) UpdateRdata(ctx context.Context, in *pb.UpdateRdataRequest, opts ...grpc.CallOption) (*pb.UpdateRdataResponse, error) {
+	change := &Change{Operation: ChangeUpdateRdata, View: in.View, Zones: []string{in.Zone}}
+	if in.OldRrset != nil {
+		old := changeRRsets([]*pb.RRset{in.OldRrset})[0]
+		change.OldRRset = &old
+	}
+	if in.NewRrset != nil {
+		change.RRsets = changeRRsets([]*pb.RRset{in.NewRrset})
+	}
+	b.record(change)
+	return &pb.UpdateRdataResponse{}, nil
+}
+
+func (b *DryRunBackend) record(change *Change) {
+	change.Time = time.Now()
+	if b.out == nil {
+		log.Printf("dry run: %s", change.String())
+		return
+	}
+
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("marshal change failed:%s", err.Error())
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, err := b.out.Write(append(data, '\n')); err != nil {
+		log.Printf("write change failed:%s", err.Error())
+	}
+}
+
+func (c *Change) String() string {
+	var rrsets []string
+	for _, rrset := range c.RRsets {
+		rrsets = append(rrsets, rrset.String())
+	}
+	s := fmt.Sprintf("%s view:%q zones:%v", c.Operation, c.View, c.Zones)
+	if len(c.Names) != 0 {
+		s += fmt.Sprintf(" names:%v", c.Names)
+	}
+	if c.OldRRset != nil {
+		s += " old:" + c.OldRRset.String()
+	}
+	if len(rrsets) != 0 {
+		s += " rrsets:" + strings.Join(rrsets, ", ")
+	}
+	return s
+}
+
+func (r ChangeRRset) String() string {
+	if len(r.Rdatas) == 0 {
+		return r.Name + " " + r.Type
+	}
+	return fmt.Sprintf("%s %d %s %s", r.Name, r.TTL, r.Type, strings.Join(r.Rdatas, " | "))
+}
+
+func changeRRsets(rrsets []*pb.RRset) []ChangeRRset {
+	var changes []ChangeRRset
+	for _, rrset := range rrsets {
+		changes = append(changes, ChangeRRset{
+			Name:   rrset.Name,
+			Type:   rrset.Type.String(),
+			TTL:    rrset.Ttl,
+			Rdatas: rrset.Rdatas,
+		})
+	}
+	return changes
+}
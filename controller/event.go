@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	EventSource              = "vanguard2-controller"
+	EventReasonHostnameInUse = "HostnameConflict"
+
+	// same event of an object is only reported once in this interval
+	eventDedupInterval = 10 * time.Minute
+)
+
+// eventRecorder reports events of objects to k8s, events are dropped if
+// create is nil, like in offline controller
+type eventRecorder struct {
+	create func(*corev1.Event) error
+	lock   sync.Mutex
+	last   map[string]time.Time
+}
+
+func newEventRecorder(create func(*corev1.Event) error) *eventRecorder {
+	return &eventRecorder{
+		create: create,
+		last:   make(map[string]time.Time),
+	}
+}
+
+func (r *eventRecorder) event(obj runtime.Object, typ, reason, message string) {
+	if r.create == nil {
+		return
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	kind := obj.GetObjectKind().GroupVersionKind()
+	if kind.Kind == "" {
+		//objects from cache don't have type meta
+		if kinds, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(kinds) != 0 {
+			kind = kinds[0]
+		}
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%s/%s", kind.Kind, accessor.GetNamespace(), accessor.GetName(), reason, message)
+	now := time.Now()
+	r.lock.Lock()
+	if last, ok := r.last[key]; ok && now.Sub(last) < eventDedupInterval {
+		r.lock.Unlock()
+		return
+	}
+	r.last[key] = now
+	for k, last := range r.last {
+		if now.Sub(last) >= eventDedupInterval {
+			delete(r.last, k)
+		}
+	}
+	r.lock.Unlock()
+
+	t := metav1.NewTime(now)
+	apiVersion, _ := kind.ToAPIVersionAndKind()
+	e := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", accessor.GetName(), now.UnixNano()),
+			Namespace: accessor.GetNamespace(),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            kind.Kind,
+			APIVersion:      apiVersion,
+			Namespace:       accessor.GetNamespace(),
+			Name:            accessor.GetName(),
+			UID:             accessor.GetUID(),
+			ResourceVersion: accessor.GetResourceVersion(),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           typ,
+		Source:         corev1.EventSource{Component: EventSource},
+		FirstTimestamp: t,
+		LastTimestamp:  t,
+		Count:          1,
+	}
+	if err := r.create(e); err != nil {
+		log.Printf("create event %s of %s %s/%s failed:%s", reason, kind.Kind, accessor.GetNamespace(), accessor.GetName(), err.Error())
+	}
+}
+
+func (c *Controller) recordEvent(obj runtime.Object, typ, reason, message string) {
+	c.events.event(obj, typ, reason, message)
+}
+
+func (c *Controller) createEvent(e *corev1.Event) error {
+	return c.k8sClient.Create(context.TODO(), e)
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// cname chain of flattened external name is followed at most this times
+const maxFlattenDepth = 8
+
+// externalNameTargets tracks the names walked to flatten external name
+// services, the target and the names in its cname chain, services are
+// reconciled again when records of any of them change
+type externalNameTargets struct {
+	lock    sync.Mutex
+	targets map[types.NamespacedName]map[string]struct{}
+}
+
+func newExternalNameTargets() *externalNameTargets {
+	return &externalNameTargets{
+		targets: make(map[types.NamespacedName]map[string]struct{}),
+	}
+}
+
+func (t *externalNameTargets) set(key types.NamespacedName, names []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(names) == 0 {
+		delete(t.targets, key)
+		return
+	}
+	targets := make(map[string]struct{})
+	for _, name := range names {
+		targets[name] = struct{}{}
+	}
+	t.targets[key] = targets
+}
+
+func (t *externalNameTargets) dependents(names map[string]struct{}) []types.NamespacedName {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var keys []types.NamespacedName
+	for key, targets := range t.targets {
+		for name := range names {
+			if _, ok := targets[name]; ok {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// externalNameRRsets returns a or aaaa rrset if external name is an ip,
+// with FlattenExternalNames, name in managed zones is replaced by addresses
+// published for it in each view, otherwise it's a cname. The names walked to
+// flatten it are returned as well
+func (c *Controller) externalNameRRsets(svc *corev1.Service, n *g53.Name, views []string) (map[string][]*g53.RRset, []string) {
+	rrsets := make(map[string][]*g53.RRset)
+	inAllViews := func(rrset *g53.RRset) map[string][]*g53.RRset {
+		for _, view := range views {
+			rrsets[view] = []*g53.RRset{rrset}
+		}
+		return rrsets
+	}
+
+	if ip := net.ParseIP(svc.Spec.ExternalName); ip != nil {
+		if ip.To4() != nil {
+			rdata, _ := g53.AFromString(ip.String())
+			return inAllViews(newRRset(n, g53.RR_A, c.ttl(), rdata)), nil
+		}
+		rdata, err := g53.AAAAFromString(ip.String())
+		if err != nil {
+			return nil, nil
+		}
+		return inAllViews(newRRset(n, g53.RR_AAAA, c.ttl(), rdata)), nil
+	}
+
+	en, err := g53.NameFromString(svc.Spec.ExternalName)
+	if err != nil {
+		c.recordEvent(svc, corev1.EventTypeWarning, EventReasonInvalidExternalName,
+			fmt.Sprintf("external name %s is invalid:%s", svc.Spec.ExternalName, err.Error()))
+		return nil, nil
+	}
+
+	cname := newRRset(n, g53.RR_CNAME, c.ttl(), &g53.CName{Name: en})
+	if c.opts.FlattenExternalNames == false || c.client.getZone(en) == nil {
+		return inAllViews(cname), nil
+	}
+
+	var walked []string
+	for _, view := range views {
+		rdatas, names := c.resolvePublished(view, en)
+		walked = append(walked, names...)
+		//target isn't published yet
+		if len(rdatas) == 0 {
+			rrsets[view] = []*g53.RRset{cname}
+			continue
+		}
+		for _, typ := range []g53.RRType{g53.RR_A, g53.RR_AAAA} {
+			var typed []g53.Rdata
+			unique := make(map[string]struct{})
+			for _, rdata := range rdatas {
+				if _, ok := unique[rdata.String()]; ok == false && rdataType(rdata) == typ {
+					unique[rdata.String()] = struct{}{}
+					typed = append(typed, rdata)
+				}
+			}
+			if len(typed) != 0 {
+				rrsets[view] = append(rrsets[view], newRRset(n, typ, c.ttl(), typed...))
+			}
+		}
+	}
+	return rrsets, walked
+}
+
+// resolvePublished returns addresses of name in service records of the
+// view, cname is followed, names in the chain are returned as well
+func (c *Controller) resolvePublished(view string, name *g53.Name) ([]g53.Rdata, []string) {
+	c.publishedLock.Lock()
+	defer c.publishedLock.Unlock()
+
+	var walked []string
+	for i := 0; i < maxFlattenDepth; i++ {
+		walked = append(walked, name.String(false))
+		var rdatas []g53.Rdata
+		var cname *g53.Name
+		for _, records := range c.published {
+			for _, r := range records {
+				if r.view != view || r.rrset.Name.Equals(name) == false {
+					continue
+				}
+				switch r.rrset.Type {
+				case g53.RR_A, g53.RR_AAAA:
+					rdatas = append(rdatas, r.rrset.Rdatas...)
+				case g53.RR_CNAME:
+					cname = r.rrset.Rdatas[0].(*g53.CName).Name
+				}
+			}
+		}
+		if len(rdatas) != 0 || cname == nil {
+			return rdatas, walked
+		}
+		name = cname
+	}
+	return nil, walked
+}
+
+func rdataType(rdata g53.Rdata) g53.RRType {
+	if _, ok := rdata.(*g53.AAAA); ok {
+		return g53.RR_AAAA
+	}
+	return g53.RR_A
+}
+
+// enqueue flattened external name services pointing to names whose
+// records changed
+func (c *Controller) enqueueExternalNameDependents(key types.NamespacedName, old, current map[string]serviceRecord) {
+	names := make(map[string]struct{})
+	for k, r := range old {
+		if n, ok := current[k]; ok == false || isRRsetEqual(r.rrset, n.rrset) == false {
+			names[r.rrset.Name.String(false)] = struct{}{}
+		}
+	}
+	for k, r := range current {
+		if _, ok := old[k]; ok == false {
+			names[r.rrset.Name.String(false)] = struct{}{}
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	for _, dependent := range c.externalNames.dependents(names) {
+		if dependent != key {
+			c.enqueueService(dependent.Namespace, dependent.Name)
+		}
+	}
+}
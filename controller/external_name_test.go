@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestExternalNameRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		flatten bool
+		steps   []step
+		records []string
+	}{
+		{
+			name: "ipv4",
+			steps: []step{
+				{createEvent, externalNameService("default", "legacy", "192.168.1.10")},
+			},
+			records: []string{
+				"legacy.default.svc.cluster.local. A 192.168.1.10",
+			},
+		},
+		{
+			name: "ipv6",
+			steps: []step{
+				{createEvent, externalNameService("default", "legacy", "2001:db8::10")},
+			},
+			records: []string{
+				"legacy.default.svc.cluster.local. AAAA 2001:db8::10",
+			},
+		},
+		{
+			name: "internal name without flatten",
+			steps: []step{
+				{createEvent, clusterIPService("prod", "db", "10.43.0.30")},
+				{createEvent, externalNameService("default", "db", "db.prod.svc.cluster.local")},
+			},
+			records: []string{
+				"30.0.43.10.in-addr.arpa. PTR db.prod.svc.cluster.local.",
+				"db.default.svc.cluster.local. CNAME db.prod.svc.cluster.local.",
+				"db.prod.svc.cluster.local. A 10.43.0.30",
+			},
+		},
+		{
+			name:    "flatten target created later",
+			flatten: true,
+			steps: []step{
+				{createEvent, externalNameService("default", "db", "db.prod.svc.cluster.local")},
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"10.42.0.5"})},
+			},
+			records: []string{
+				"10-42-0-5.db.prod.svc.cluster.local. A 10.42.0.5",
+				"5.0.42.10.in-addr.arpa. PTR 10-42-0-5.db.prod.svc.cluster.local.",
+				"db.default.svc.cluster.local. A 10.42.0.5",
+				"db.prod.svc.cluster.local. A 10.42.0.5",
+			},
+		},
+		{
+			name:    "flatten target changed",
+			flatten: true,
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"10.42.0.5"})},
+				{createEvent, externalNameService("default", "db", "db.prod.svc.cluster.local")},
+				{createEvent, externalNameService("default", "alias", "db.default.svc.cluster.local")},
+				{updateEvent, endpoints("prod", "db", []string{"10.42.0.6"})},
+			},
+			records: []string{
+				"10-42-0-6.db.prod.svc.cluster.local. A 10.42.0.6",
+				"6.0.42.10.in-addr.arpa. PTR 10-42-0-6.db.prod.svc.cluster.local.",
+				"alias.default.svc.cluster.local. A 10.42.0.6",
+				"db.default.svc.cluster.local. A 10.42.0.6",
+				"db.prod.svc.cluster.local. A 10.42.0.6",
+			},
+		},
+		{
+			name:    "flatten target deleted",
+			flatten: true,
+			steps: []step{
+				{createEvent, clusterIPService("prod", "db", "10.43.0.30")},
+				{createEvent, externalNameService("default", "db", "db.prod.svc.cluster.local")},
+				{deleteEvent, clusterIPService("prod", "db", "10.43.0.30")},
+			},
+			records: []string{
+				"db.default.svc.cluster.local. CNAME db.prod.svc.cluster.local.",
+			},
+		},
+		{
+			name:    "flatten external target",
+			flatten: true,
+			steps: []step{
+				{createEvent, externalNameService("default", "search", "www.example.com")},
+			},
+			records: []string{
+				"search.default.svc.cluster.local. CNAME www.example.com.",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnvWithOptions(t, Options{FlattenExternalNames: tc.flatten})
+			defer env.close()
+			for _, s := range tc.steps {
+				env.run(s)
+			}
+			if got := env.records(); reflect.DeepEqual(got, tc.records) == false {
+				t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(tc.records), joinLines(got))
+			}
+		})
+	}
+}
+
+// every name in the cname chain is a target of flattened external name
+func TestExternalNameChainTargets(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{FlattenExternalNames: true})
+	defer env.close()
+
+	env.run(step{createEvent, externalNameService("default", "db", "db.prod.svc.cluster.local")})
+	env.run(step{createEvent, externalNameService("default", "alias", "db.default.svc.cluster.local")})
+	dependents := env.ctl.externalNames.dependents(map[string]struct{}{"db.prod.svc.cluster.local.": {}})
+	if len(dependents) != 2 {
+		t.Errorf("both services should depend on the end of chain:%v", dependents)
+	}
+
+	env.run(step{createEvent, clusterIPService("prod", "db", "10.43.0.30")})
+	want := []string{
+		"30.0.43.10.in-addr.arpa. PTR db.prod.svc.cluster.local.",
+		"alias.default.svc.cluster.local. A 10.43.0.30",
+		"db.default.svc.cluster.local. A 10.43.0.30",
+		"db.prod.svc.cluster.local. A 10.43.0.30",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	env.run(step{deleteEvent, externalNameService("default", "alias", "db.default.svc.cluster.local")})
+	if dependents := env.ctl.externalNames.dependents(map[string]struct{}{"db.default.svc.cluster.local.": {}}); len(dependents) != 0 {
+		t.Errorf("deleted service shouldn't depend on any name:%v", dependents)
+	}
+}
+
+// external name is flattened to the addresses published in each view
+func TestFlattenExternalNameInViews(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{FlattenExternalNames: true, ViewIsolation: true, SharedNamespaces: []string{"shared"}})
+	defer env.close()
+
+	env.run(step{createEvent, clusterIPService("a", "web", "10.43.0.5")})
+	env.run(step{createEvent, externalNameService("shared", "web", "web.a.svc.cluster.local")})
+
+	store := env.server.Store()
+	name := g53.NameFromStringUnsafe("web.shared.svc.cluster.local")
+	if rrset := store.GetRRset("a", testClusterDomain, name, g53.RR_A); rrset == nil || rrset.Rdatas[0].String() != "10.43.0.5" {
+		t.Errorf("external name should be flattened in view of target:%v", rrset)
+	}
+	if rrset := store.GetRRset(DefaultView, testClusterDomain, name, g53.RR_CNAME); rrset == nil {
+		t.Errorf("external name should be cname in view without target")
+	}
+	if targets := env.ctl.externalNames.dependents(map[string]struct{}{"web.a.svc.cluster.local.": {}}); reflect.DeepEqual(targets, []types.NamespacedName{{Namespace: "shared", Name: "web"}}) == false {
+		t.Errorf("target should be tracked:%v", targets)
+	}
+}
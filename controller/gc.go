@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/zdnscloud/g53"
+
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const (
+	IdleCheckInterval = time.Second
+)
+
+// CollectGarbage deletes the records left by objects deleted while the
+// controller was down, which happens when zones are shared with other
+// writers and aren't wiped on start. It waits until the queue is drained for
+// the first time, then the zones generated from objects in cache are
+// transferred from the server in xfr, rrsets owned by this controller which
+// are neither desired nor pushed are deleted, so are our owner records whose
+// rrset is gone
+func (c *Controller) CollectGarbage(xfr XFRConfig) error {
+	if c.waitForIdle() == false {
+		return nil
+	}
+
+	c.reloadLock.RLock()
+	client := c.client
+	if client.registry == nil {
+		c.reloadLock.RUnlock()
+		return nil
+	}
+	desired, err := c.desiredState()
+	c.reloadLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tsig, err := xfr.tsig()
+	if err != nil {
+		return err
+	}
+
+	var failed, deleted int
+	for _, view := range desired.Views() {
+		for _, zone := range desired.Zones(view) {
+			if client.state.hasZone(view, zone) == false {
+				continue
+			}
+
+			zoneName := g53.NameFromStringUnsafe(zone)
+			actual, err := util.AXFR(xfr.Server, view, zoneName, tsig)
+			if err != nil {
+				failed += 1
+				log.Printf("transfer zone %s in view %q failed:%s", zone, view, err.Error())
+				continue
+			}
+			n, err := c.collectZoneGarbage(client, view, zoneName, actual, desired)
+			deleted += n
+			if err != nil {
+				failed += 1
+				log.Printf("collect garbage in zone %s view %q failed:%s", zone, view, err.Error())
+			}
+		}
+	}
+
+	log.Printf("%d garbage rrsets are deleted", deleted)
+	if failed != 0 {
+		return fmt.Errorf("%d zones aren't cleaned up", failed)
+	}
+	return nil
+}
+
+// waitForIdle returns false if the controller is shut down before the queue
+// is drained
+func (c *Controller) waitForIdle() bool {
+	for {
+		select {
+		case <-c.stopCh:
+			return false
+		case <-time.After(IdleCheckInterval):
+		}
+		if c.queue.Len() == 0 && atomic.LoadInt64(&c.busyWorkers) == 0 {
+			return true
+		}
+	}
+}
+
+// workers are blocked by the reload lock, so rrsets pushed after the zone is
+// transferred are kept. Client replaced by reload cleans up its zones itself
+func (c *Controller) collectZoneGarbage(client *VgClient, view string, zone *g53.Name, actual []*g53.RRset, desired *memstore.Store) (int, error) {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.client != client {
+		return 0, nil
+	}
+
+	zoneName := zone.String(false)
+	rrsets, owners := client.registry.garbage(actual, func(name *g53.Name, typ g53.RRType) bool {
+		return desired.GetRRset(view, zoneName, name, typ) != nil ||
+			client.state.store.GetRRset(view, zoneName, name, typ) != nil
+	})
+	for _, rrset := range rrsets {
+		if err := client.deleteRRsetInView(view, zone, rrset.Name, rrset.Type); err != nil {
+			return 0, err
+		}
+	}
+	for _, owner := range owners {
+		if err := client.deleteOwnerRecord(view, zone, owner); err != nil {
+			return 0, err
+		}
+	}
+	return len(rrsets) + len(owners), nil
+}
+
+// garbage returns the rrsets in actual owned by us which aren't kept, and
+// the owner records with our owner value whose rrset doesn't exist
+func (r *ownerRegistry) garbage(actual []*g53.RRset, keep func(*g53.Name, g53.RRType) bool) (rrsets, owners []*g53.RRset) {
+	index := make(map[string]*g53.RRset)
+	for _, rrset := range actual {
+		index[rrsetKey(rrset.Name, rrset.Type)] = rrset
+	}
+
+	for _, rrset := range actual {
+		if rrset.Type == g53.RR_SOA || keep(rrset.Name, rrset.Type) {
+			continue
+		}
+
+		if name, typ, ok := ownerTarget(rrset.Name); ok {
+			if _, exists := index[rrsetKey(name, typ)]; exists == false && rrset.Type == g53.RR_TXT && r.isOwnedBy(rrset) {
+				owners = append(owners, rrset)
+			}
+		} else if owner, ok := index[rrsetKey(r.ownerName(rrset.Name, rrset.Type), g53.RR_TXT)]; ok && r.isOwnedBy(owner) {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets, owners
+}
+
+// only our owner value is deleted, since owner record may be shared with
+// other writers
+func (c *VgClient) deleteOwnerRecord(view string, zone *g53.Name, owner *g53.RRset) error {
+	value := &g53.Txt{Data: []string{c.registry.ownerValue()}}
+	_, err := c.grpcClient.DeleteRdata(context.TODO(), &pb.DeleteRdataRequest{
+		Zone:   zone.String(false),
+		Rrsets: []*pb.RRset{rrsetToPB(newRRset(owner.Name, g53.RR_TXT, owner.Ttl, value))},
+		View:   view,
+	})
+	return err
+}
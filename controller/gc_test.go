@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/zdnscloud/g53"
+)
+
+// owned rrsets which aren't kept are garbage, so are owner records whose
+// rrset is gone, rrsets of other writers are never touched
+func TestGarbage(t *testing.T) {
+	r := newOwnerRegistry("east", "")
+	rrset := func(s string) *g53.RRset {
+		rrset, err := g53.RRsetFromString(s)
+		if err != nil {
+			t.Fatalf("invalid rrset %s:%s", s, err.Error())
+		}
+		return rrset
+	}
+
+	kept := rrset("a.cluster.local 5 IN A 10.43.0.1")
+	stale := rrset("b.cluster.local 5 IN A 10.43.0.2")
+	foreign := rrset("c.cluster.local 5 IN A 10.43.0.3")
+	foreignOwner := r.ownerRRset(foreign.Name, foreign.Type)
+	foreignOwner.Rdatas = []g53.Rdata{&g53.Txt{Data: []string{OwnerHeritage + ",owner=west"}}}
+	orphan := r.ownerRRset(g53.NameFromStringUnsafe("d.cluster.local"), g53.RR_SRV)
+	actual := []*g53.RRset{
+		rrset("cluster.local 5 IN SOA ns.cluster.local. root.cluster.local. 1 3600 1800 604800 5"),
+		kept, r.ownerRRset(kept.Name, kept.Type),
+		stale, r.ownerRRset(stale.Name, stale.Type),
+		foreign, foreignOwner,
+		orphan,
+	}
+
+	rrsets, owners := r.garbage(actual, func(name *g53.Name, typ g53.RRType) bool {
+		return name.Equals(kept.Name) || name.Equals(r.ownerName(kept.Name, kept.Type))
+	})
+	if len(rrsets) != 1 || rrsets[0] != stale {
+		t.Errorf("only stale rrset owned by us should be deleted:%v", rrsets)
+	}
+	if len(owners) != 1 || owners[0] != orphan {
+		t.Errorf("only owner record without rrset should be deleted:%v", owners)
+	}
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/zdnscloud/g53"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var ingressRecordTypes = []g53.RRType{g53.RR_A, g53.RR_AAAA, g53.RR_CNAME}
+
+// records of a host shared by several ingresses come from the first one
+// in namespace/name order
+func newIngressRegistry() *nameRegistry {
+	return newNameRegistry(func(owners map[types.NamespacedName][]*g53.RRset) []*g53.RRset {
+		var first *types.NamespacedName
+		for owner := range owners {
+			if first == nil || owner.String() < first.String() {
+				o := owner
+				first = &o
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		return owners[*first]
+	})
+}
+
+// ingressKey shares the queue with services
+type ingressKey types.NamespacedName
+
+func (c *Controller) enqueueIngress(namespace, name string) {
+	c.queue.Add(ingressKey{Namespace: namespace, Name: name})
+}
+
+// reconcileIngress makes the records of hosts used by the ingress match the
+// ingress in cache, hosts still used by other ingresses are kept
+func (c *Controller) reconcileIngress(key types.NamespacedName) error {
+	var records []serviceRecord
+	var ing extv1beta1.Ingress
+	if err := c.cache.Get(context.TODO(), key, &ing); err != nil {
+		if apierrors.IsNotFound(err) == false {
+			return err
+		}
+	} else {
+		rrsets := c.ingressRRsets(&ing)
+		for _, host := range ingressHosts(&ing) {
+			zone := c.client.getZone(host)
+			if zone == nil {
+				log.Printf("ingress %s host %s isn't in any managed zone", key.String(), host.String(true))
+				continue
+			}
+			for _, typ := range ingressRecordTypes {
+				if rrset, ok := rrsets[typ]; ok {
+					rrset = rrset.Clone()
+					rrset.Name = host
+					records = append(records, serviceRecord{DefaultView, zone, rrset})
+				}
+			}
+		}
+	}
+	return c.publishShared(c.ingresses, key, records, "ingress rrsets")
+}
+
+// rrset name is left empty, it's filled with each host of the ingress
+func (c *Controller) ingressRRsets(ing *extv1beta1.Ingress) map[g53.RRType]*g53.RRset {
+	rrsets := make(map[g53.RRType]*g53.RRset)
+	if c.ingressTarget != nil {
+		rrsets[g53.RR_CNAME] = &g53.RRset{
+			Type:   g53.RR_CNAME,
+			Class:  g53.CLASS_IN,
+			Ttl:    c.ttl(),
+			Rdatas: []g53.Rdata{&g53.CName{Name: c.ingressTarget}},
+		}
+		return rrsets
+	}
+
+	var lbHost *g53.Name
+	for _, lb := range ing.Status.LoadBalancer.Ingress {
+		if lb.IP == "" {
+			if lb.Hostname != "" && lbHost == nil {
+				lbHost, _ = g53.NameFromString(lb.Hostname)
+			}
+			continue
+		}
+
+		ip := net.ParseIP(lb.IP)
+		if ip == nil {
+			continue
+		}
+
+		var typ g53.RRType
+		var rdata g53.Rdata
+		var err error
+		if ip.To4() != nil {
+			typ = g53.RR_A
+			rdata, err = g53.AFromString(lb.IP)
+		} else {
+			typ = g53.RR_AAAA
+			rdata, err = g53.AAAAFromString(lb.IP)
+		}
+		if err != nil {
+			continue
+		}
+
+		rrset, ok := rrsets[typ]
+		if ok == false {
+			rrset = &g53.RRset{
+				Type:  typ,
+				Class: g53.CLASS_IN,
+				Ttl:   c.ttl(),
+			}
+			rrsets[typ] = rrset
+		}
+		rrset.Rdatas = append(rrset.Rdatas, rdata)
+	}
+
+	//cname can't coexist with other data
+	if len(rrsets) == 0 && lbHost != nil {
+		rrsets[g53.RR_CNAME] = &g53.RRset{
+			Type:   g53.RR_CNAME,
+			Class:  g53.CLASS_IN,
+			Ttl:    c.ttl(),
+			Rdatas: []g53.Rdata{&g53.CName{Name: lbHost}},
+		}
+	}
+	return rrsets
+}
+
+func ingressHosts(ing *extv1beta1.Ingress) []*g53.Name {
+	var hosts []*g53.Name
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" {
+			continue
+		}
+
+		host, err := g53.NameFromString(rule.Host)
+		if err != nil || hasName(hosts, host) {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func hasName(names []*g53.Name, name *g53.Name) bool {
+	for _, n := range names {
+		if n.Equals(name) {
+			return true
+		}
+	}
+	return false
+}
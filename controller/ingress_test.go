@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func ingress(namespace, name string, hosts []string, ips ...string) *extv1beta1.Ingress {
+	ing := &extv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+	for _, host := range hosts {
+		ing.Spec.Rules = append(ing.Spec.Rules, extv1beta1.IngressRule{Host: host})
+	}
+	for _, ip := range ips {
+		ing.Status.LoadBalancer.Ingress = append(ing.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: ip})
+	}
+	return ing
+}
+
+func TestIngressSharedHost(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{WatchIngress: true})
+	defer env.close()
+
+	web := ingress("prod", "web", []string{"www.cluster.local", "web.cluster.local"}, "192.168.1.10")
+	api := ingress("prod", "api", []string{"www.cluster.local"}, "192.168.1.20")
+	env.run(step{createEvent, web})
+	env.run(step{createEvent, api})
+	want := []string{
+		"web.cluster.local. A 192.168.1.10",
+		"www.cluster.local. A 192.168.1.20",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	env.run(step{deleteEvent, api})
+	want = []string{
+		"web.cluster.local. A 192.168.1.10",
+		"www.cluster.local. A 192.168.1.10",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("host should be kept for the other ingress\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	env.server.Stop()
+	delete(env.objs, objectKey(web))
+	env.syncCache()
+	if err := env.ctl.reconcileIngress(types.NamespacedName{Namespace: "prod", Name: "web"}); err == nil {
+		t.Errorf("reconcile should fail so ingress is retried")
+	}
+	if n := env.ctl.ingresses.pendingCount(); n != 2 {
+		t.Errorf("2 hosts should be pending but got %d", n)
+	}
+}
@@ -1,21 +1,25 @@
 package controller
 
 import (
-	"context"
+	"sync"
+	"time"
 
 	"github.com/zdnscloud/g53"
 	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
 
 	"github.com/zdnscloud/gok8s/cache"
+	"github.com/zdnscloud/gok8s/client"
 	"github.com/zdnscloud/gok8s/client/config"
 	"github.com/zdnscloud/gok8s/controller"
 	"github.com/zdnscloud/gok8s/event"
 	"github.com/zdnscloud/gok8s/handler"
 	"github.com/zdnscloud/gok8s/predicate"
-	"github.com/zdnscloud/vanguard2-controller/util"
+	"github.com/zdnscloud/vanguard2-controller/crd"
 )
 
 const (
@@ -24,18 +28,97 @@ const (
 )
 
 type Controller struct {
-	cache      cache.Cache
-	controller controller.Controller
-	client     *VgClient
-	stopCh     chan struct{}
+	cache         client.Reader
+	controller    controller.Controller
+	k8sClient     client.Client
+	client        *VgClient
+	ingressTarget *g53.Name
+	viewIsolation *viewIsolation
+	scope         *serviceScope
+	opts          Options
+	queue         workqueue.RateLimitingInterface
+	publishedLock sync.Mutex
+	published     map[types.NamespacedName]map[string]serviceRecord
+	busyWorkers   int64
+	endpoints     *debouncer
+	ptrs          *ptrRegistry
+	ingresses     *nameRegistry
+	dnsZones      *dnsZoneOwners
+	dnsRecords    *nameRegistry
+	clusterset    *MultiClusterController
+	// records of services exported by member clusters
+	clustersetRecords *nameRegistry
+	events            *eventRecorder
+	externalNames     *externalNameTargets
+	reloadLock        sync.RWMutex
+	stopCh            chan struct{}
+	stopOnce          sync.Once
+	stopped           chan struct{}
+	workerGroup       sync.WaitGroup
+	failedLock        sync.Mutex
+	failed            map[interface{}]struct{}
 }
 
-func NewK8sController(client *VgClient) (*Controller, error) {
+type Options struct {
+	WatchIngress bool
+	// cname target of ingress hosts, load balancer ips are used if it's empty
+	IngressTarget    string
+	WatchDNSResource bool
+	// services of each namespace are only visible in the view named by the
+	// namespace or by its ViewLabel label value
+	ViewIsolation    bool
+	ViewLabel        string
+	SharedNamespaces []string
+	// number of services reconciled concurrently, events of one service are
+	// always handled in order
+	Workers int
+	// endpoints updates of a service are coalesced until there is no update
+	// in EndpointsWindow, or EndpointsMaxWait has passed since the first one
+	EndpointsWindow  time.Duration
+	EndpointsMaxWait time.Duration
+	// ptr of ip shared by several names only has the first name in
+	// alphabetical order, instead of all of them
+	CanonicalPTR bool
+	// pods with hostname and subdomain are published under the headless
+	// service named by the subdomain
+	WatchPods bool
+	TTL       uint32
+	// services in ExcludeNamespaces are ignored, if IncludeNamespaces isn't
+	// empty, only services in these namespaces are published
+	IncludeNamespaces []string
+	ExcludeNamespaces []string
+	// label selectors further restricting the services, a service opts out
+	// with ServiceIgnoreAnnotation
+	NamespaceSelector string
+	ServiceSelector   string
+	// ExternalName in managed zones is replaced by the addresses of the
+	// target, ExternalName which is an ip is always published as address
+	FlattenExternalNames bool
+}
+
+func NewK8sController(vgClient *VgClient, opts Options) (*Controller, error) {
+	registerQueueMetrics()
+	c, err := newController(vgClient, opts, ServiceQueueName)
+	if err != nil {
+		return nil, err
+	}
+
 	k8sCfg, err := config.GetConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.WatchDNSResource {
+		if err := crd.AddToScheme(scheme.Scheme); err != nil {
+			return nil, err
+		}
+	}
+
+	k8sClient, err := client.New(k8sCfg, client.Options{})
+	if err != nil {
+		return nil, err
+	}
+
 	cache, err := cache.New(k8sCfg, cache.Options{})
 	if err != nil {
 		return nil, err
@@ -57,60 +140,164 @@ func NewK8sController(client *VgClient) (*Controller, error) {
 		return []string{ep.ObjectMeta.Name + "." + ep.ObjectMeta.Namespace}
 	})
 
-	stopCh := make(chan struct{})
-	go cache.Start(stopCh)
-	cache.WaitForCacheSync(stopCh)
+	go cache.Start(c.stopCh)
+	cache.WaitForCacheSync(c.stopCh)
 
 	controller := controller.New("vanguard_k8s_controller", cache, scheme.Scheme)
 	controller.Watch(&corev1.Endpoints{})
 	controller.Watch(&corev1.Service{})
+	controller.Watch(&corev1.Namespace{})
+	if opts.WatchIngress {
+		controller.Watch(&extv1beta1.Ingress{})
+	}
+	if opts.WatchDNSResource {
+		controller.Watch(&crd.DNSZone{})
+		controller.Watch(&crd.DNSRecord{})
+	}
+	if opts.WatchPods {
+		controller.Watch(&corev1.Pod{})
+	}
+	c.controller = controller
+	c.cache = cache
+	c.k8sClient = k8sClient
+	c.events = newEventRecorder(c.createEvent)
+	return c, nil
+}
+
+// queue without name has no metrics
+func newController(vgClient *VgClient, opts Options, queueName string) (*Controller, error) {
 	c := &Controller{
-		controller: controller,
-		cache:      cache,
-		client:     client,
-		stopCh:     stopCh,
+		client:            vgClient,
+		opts:              opts,
+		queue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), queueName),
+		published:         make(map[types.NamespacedName]map[string]serviceRecord),
+		ptrs:              newPTRRegistry(opts.CanonicalPTR),
+		ingresses:         newIngressRegistry(),
+		dnsZones:          newDNSZoneOwners(),
+		dnsRecords:        newDNSRecordRegistry(),
+		clustersetRecords: newClustersetRegistry(),
+		events:            newEventRecorder(nil),
+		externalNames:     newExternalNameTargets(),
+		stopCh:            make(chan struct{}),
+		stopped:           make(chan struct{}),
+		failed:            make(map[interface{}]struct{}),
+	}
+	c.endpoints = newDebouncer(opts.EndpointsWindow, opts.EndpointsMaxWait, func(key types.NamespacedName) {
+		c.queue.Add(key)
+	})
+	if opts.IngressTarget != "" {
+		target, err := g53.NameFromString(opts.IngressTarget)
+		if err != nil {
+			return nil, err
+		}
+		c.ingressTarget = target
+	}
+	if opts.ViewIsolation {
+		c.viewIsolation = newViewIsolation(opts.ViewLabel, opts.SharedNamespaces)
+	}
+	scope, err := newServiceScope(opts)
+	if err != nil {
+		return nil, err
 	}
+	c.scope = scope
 	return c, nil
 }
 
+// Run returns after Shutdown stops watching, workers keep running until
+// the queue is drained by Shutdown
 func (c *Controller) Run() {
+	c.startWorkers()
 	c.controller.Start(c.stopCh, c, predicate.NewIgnoreUnchangedUpdate())
+	close(c.stopped)
+}
+
+func (c *Controller) startWorkers() {
+	for i := 0; i < c.workers(); i++ {
+		c.workerGroup.Add(1)
+		go func() {
+			defer c.workerGroup.Done()
+			c.runWorker()
+		}()
+	}
 }
 
 func (c *Controller) OnCreate(e event.CreateEvent) (handler.Result, error) {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
 	switch o := e.Object.(type) {
 	case *corev1.Endpoints:
-		c.handleEndPointCreate(o)
+		c.enqueueService(o.Namespace, o.Name)
 	case *corev1.Service:
-		c.handleServiceCreate(o)
+		c.enqueueService(o.Namespace, o.Name)
+	case *corev1.Pod:
+		c.enqueuePodService(o)
+	case *extv1beta1.Ingress:
+		c.enqueueIngress(o.Namespace, o.Name)
+	case *crd.DNSZone:
+		c.queue.Add(dnsZoneKey(o.Name))
+	case *crd.DNSRecord:
+		c.queue.Add(dnsRecordKey{Namespace: o.Namespace, Name: o.Name})
 	}
 
 	return handler.Result{}, nil
 }
 
 func (c *Controller) OnUpdate(e event.UpdateEvent) (handler.Result, error) {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
 	switch old := e.ObjectOld.(type) {
 	case *corev1.Endpoints:
 		new := e.ObjectNew.(*corev1.Endpoints)
-		if len(old.Subsets) != 0 || len(new.Subsets) != 0 {
-			s, err := c.getService(old.Name, old.Namespace)
-			if err == nil {
-				c.handleEndPointUpdate(s, old, new)
-			}
+		if isSubsetsEqual(old, new) == false {
+			c.endpoints.touch(types.NamespacedName{Namespace: new.Namespace, Name: new.Name})
 		}
 	case *corev1.Service:
 		new := e.ObjectNew.(*corev1.Service)
-		c.handleServiceUpdate(old, new)
+		if isServiceStatusOnlyChanged(old, new) == false {
+			c.enqueueService(new.Namespace, new.Name)
+		}
+	case *corev1.Namespace:
+		c.handleNamespaceUpdate(old, e.ObjectNew.(*corev1.Namespace))
+	case *corev1.Pod:
+		new := e.ObjectNew.(*corev1.Pod)
+		if isPodNameChanged(old, new) {
+			c.enqueuePodService(old)
+			c.enqueuePodService(new)
+		}
+	case *extv1beta1.Ingress:
+		c.enqueueIngress(old.Namespace, old.Name)
+	case *crd.DNSZone:
+		//status update doesn't change generation
+		if new := e.ObjectNew.(*crd.DNSZone); old.Generation != new.Generation {
+			c.queue.Add(dnsZoneKey(new.Name))
+		}
+	case *crd.DNSRecord:
+		if new := e.ObjectNew.(*crd.DNSRecord); old.Generation != new.Generation {
+			c.queue.Add(dnsRecordKey{Namespace: new.Namespace, Name: new.Name})
+		}
 	}
 	return handler.Result{}, nil
 }
 
 func (c *Controller) OnDelete(e event.DeleteEvent) (handler.Result, error) {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+
 	switch o := e.Object.(type) {
 	case *corev1.Endpoints:
-		c.handleEndPointDelete(o)
+		c.enqueueService(o.Namespace, o.Name)
 	case *corev1.Service:
-		c.handleServiceDelete(o)
+		c.enqueueService(o.Namespace, o.Name)
+	case *corev1.Pod:
+		c.enqueuePodService(o)
+	case *extv1beta1.Ingress:
+		c.enqueueIngress(o.Namespace, o.Name)
+	case *crd.DNSZone:
+		c.queue.Add(dnsZoneKey(o.Name))
+	case *crd.DNSRecord:
+		c.queue.Add(dnsRecordKey{Namespace: o.Namespace, Name: o.Name})
 	}
 	return handler.Result{}, nil
 }
@@ -118,259 +305,3 @@ func (c *Controller) OnDelete(e event.DeleteEvent) (handler.Result, error) {
 func (c *Controller) OnGeneric(e event.GenericEvent) (handler.Result, error) {
 	return handler.Result{}, nil
 }
-
-func (c *Controller) getService(name, namespace string) (*corev1.Service, error) {
-	var service corev1.Service
-	err := c.cache.Get(context.TODO(), types.NamespacedName{namespace, name}, &service)
-	if err == nil {
-		return &service, nil
-	} else {
-		return nil, err
-	}
-}
-
-func (c *Controller) handleServiceCreate(svc *corev1.Service) {
-	if isNormalService(svc) {
-		c.addServiceRecord(svc)
-	} else if isExternalService(svc) {
-		c.addExternalServiceRecord(svc)
-	}
-}
-
-func (c *Controller) handleServiceDelete(svc *corev1.Service) {
-	if isNormalService(svc) {
-		c.deleteServiceRecord(svc)
-	} else if isHeaderlessService(svc) {
-		c.deleteHeadlessServiceRecord(svc)
-	} else if isExternalService(svc) {
-		c.deleteExternalServiceRecord(svc)
-	}
-}
-
-func (c *Controller) handleServiceUpdate(old, new *corev1.Service) {
-	if isNormalService(old) {
-		if old.Spec.ClusterIP != new.Spec.ClusterIP {
-			c.deleteServiceRecord(old)
-			c.addServiceRecord(new)
-		}
-	} else if isExternalService(new) {
-		if old.Spec.ExternalName != new.Spec.ExternalName {
-			c.addServiceRecord(new)
-		}
-	}
-}
-
-func (c *Controller) handleEndPointCreate(o *corev1.Endpoints) {
-	svc, err := c.getService(o.Name, o.Namespace)
-	if err == nil {
-		c.addPodRecord(svc, o)
-		if isHeaderlessService(svc) {
-			c.addHeadlessServiceRecord(svc, o)
-		}
-	}
-}
-
-func (c *Controller) handleEndPointUpdate(svc *corev1.Service, old, new *corev1.Endpoints) {
-	if isSubsetsEqual(old, new) {
-		return
-	}
-
-	//header less service rrset is a list of pods
-	if isHeaderlessService(svc) {
-		c.addHeadlessServiceRecord(svc, new)
-	}
-
-	c.deletePodRecord(old)
-	c.addPodRecord(svc, new)
-}
-
-func (c *Controller) handleEndPointDelete(o *corev1.Endpoints) {
-	c.deletePodRecord(o)
-}
-
-func (c *Controller) addPodRecord(svc *corev1.Service, o *corev1.Endpoints) {
-	for _, subset := range o.Subsets {
-		var podNames []*g53.Name
-		var addrs [][]string
-		//pod may has same name when hostname and subdomain is same :(
-		for _, addr := range subset.Addresses {
-			n := c.client.getEndpointsAddrName(&addr, o.Name, o.Namespace)
-			duplicateName := false
-			duplicateNameIndex := 0
-			for i, n_ := range podNames {
-				if n_.Equals(n) {
-					duplicateNameIndex = i
-					duplicateName = true
-					break
-				}
-			}
-			if duplicateName {
-				addrs[duplicateNameIndex] = append(addrs[duplicateNameIndex], addr.IP)
-			} else {
-				podNames = append(podNames, n)
-				addrs = append(addrs, []string{addr.IP})
-			}
-		}
-
-		for i, n := range podNames {
-			a := &g53.RRset{
-				Name:  n,
-				Type:  g53.RR_A,
-				Class: g53.CLASS_IN,
-				Ttl:   DefaultTTL,
-			}
-			var rdatas []g53.Rdata
-			for _, ip := range addrs[i] {
-				rdata, _ := g53.AFromString(ip)
-				rdatas = append(rdatas, rdata)
-				if rn, err := util.ReverseIPName(ip); err == nil {
-					ptr := &g53.RRset{
-						Name:   rn,
-						Type:   g53.RR_PTR,
-						Class:  g53.CLASS_IN,
-						Ttl:    DefaultTTL,
-						Rdatas: []g53.Rdata{&g53.PTR{Name: n}},
-					}
-					c.client.replacePodReverseRRset(ptr)
-				}
-			}
-			a.Rdatas = rdatas
-			c.client.replaceServiceRRset(a)
-		}
-
-		for _, port := range subset.Ports {
-			if port.Name == "" {
-				continue
-			}
-
-			n := c.client.getPortName(port.Name, string(port.Protocol), o.Name, o.Namespace)
-			srv := &g53.RRset{
-				Name:  n,
-				Type:  g53.RR_SRV,
-				Class: g53.CLASS_IN,
-				Ttl:   DefaultTTL,
-			}
-			var rdatas []g53.Rdata
-			if isHeaderlessService(svc) {
-				for _, podName := range podNames {
-					rdatas = append(rdatas, &g53.SRV{
-						Priority: DefaultSRVPriority,
-						Weight:   DefaultSRVWeight,
-						Port:     uint16(port.Port),
-						Target:   podName,
-					})
-				}
-			} else {
-				rdatas = append(rdatas, &g53.SRV{
-					Priority: DefaultSRVPriority,
-					Weight:   DefaultSRVWeight,
-					Port:     uint16(port.Port),
-					Target:   c.client.getServiceName(svc),
-				})
-			}
-			srv.Rdatas = rdatas
-			c.client.replaceServiceRRset(srv)
-		}
-	}
-}
-
-func (c *Controller) deletePodRecord(o *corev1.Endpoints) {
-	for _, subset := range o.Subsets {
-		for _, addr := range subset.Addresses {
-			n := c.client.getEndpointsAddrName(&addr, o.Name, o.Namespace)
-			c.client.deleteServiceRRset(n, g53.RR_A)
-			if rn, err := util.ReverseIPName(addr.IP); err == nil {
-				c.client.deletePodReverseRRset(rn)
-			}
-		}
-
-		for _, port := range subset.Ports {
-			if port.Name != "" {
-				n := c.client.getPortName(port.Name, string(port.Protocol), o.Name, o.Namespace)
-				c.client.deleteServiceRRset(n, g53.RR_SRV)
-			}
-		}
-	}
-}
-
-func (c *Controller) addHeadlessServiceRecord(svc *corev1.Service, ep *corev1.Endpoints) {
-	//handle a rrset for service domain
-	rdatas := []g53.Rdata{}
-	for _, subset := range ep.Subsets {
-		for _, addr := range subset.Addresses {
-			if addr.IP != "" {
-				rdata, _ := g53.AFromString(addr.IP)
-				rdatas = append(rdatas, rdata)
-			}
-		}
-	}
-	if len(rdatas) != 0 {
-		n := c.client.getServiceName(svc)
-		a := &g53.RRset{
-			Name:   n,
-			Type:   g53.RR_A,
-			Class:  g53.CLASS_IN,
-			Ttl:    DefaultTTL,
-			Rdatas: rdatas,
-		}
-		c.client.replaceServiceRRset(a)
-	}
-}
-
-func (c *Controller) addExternalServiceRecord(svc *corev1.Service) {
-	n := c.client.getServiceName(svc)
-	en, err := g53.NameFromString(svc.Spec.ExternalName)
-	if err == nil {
-		cname := &g53.RRset{
-			Name:   n,
-			Type:   g53.RR_CNAME,
-			Class:  g53.CLASS_IN,
-			Ttl:    DefaultTTL,
-			Rdatas: []g53.Rdata{&g53.CName{Name: en}},
-		}
-		c.client.replaceServiceRRset(cname)
-	}
-}
-
-func (c *Controller) addServiceRecord(svc *corev1.Service) {
-	n := c.client.getServiceName(svc)
-	rdata, _ := g53.AFromString(svc.Spec.ClusterIP)
-	a := &g53.RRset{
-		Name:   n,
-		Type:   g53.RR_A,
-		Class:  g53.CLASS_IN,
-		Ttl:    DefaultTTL,
-		Rdatas: []g53.Rdata{rdata},
-	}
-	c.client.replaceServiceRRset(a)
-
-	rn, err := util.ReverseIPName(svc.Spec.ClusterIP)
-	if err == nil {
-		ptr := &g53.RRset{
-			Name:   rn,
-			Type:   g53.RR_PTR,
-			Class:  g53.CLASS_IN,
-			Ttl:    DefaultTTL,
-			Rdatas: []g53.Rdata{&g53.PTR{Name: n}},
-		}
-		c.client.replaceServiceReverseRRset(ptr)
-	}
-}
-
-func (c *Controller) deleteServiceRecord(svc *corev1.Service) {
-	n := c.client.getServiceName(svc)
-	c.client.deleteServiceRRset(n, g53.RR_A)
-	if rn, err := util.ReverseIPName(svc.Spec.ClusterIP); err == nil {
-		c.client.deleteServiceReverseRRset(rn)
-	}
-}
-
-func (c *Controller) deleteExternalServiceRecord(svc *corev1.Service) {
-	n := c.client.getServiceName(svc)
-	c.client.deleteServiceRRset(n, g53.RR_CNAME)
-}
-
-func (c *Controller) deleteHeadlessServiceRecord(svc *corev1.Service) {
-	n := c.client.getServiceName(svc)
-	c.client.deleteServiceRRset(n, g53.RR_A)
-}
@@ -0,0 +1,449 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/gok8s/event"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/fakeserver"
+)
+
+const (
+	testClusterDomain  = "cluster.local"
+	testServiceIPRange = "10.43.0.0/16"
+	testPodIPRange     = "10.42.0.0/16"
+	testDNSServer      = "10.43.0.10"
+)
+
+type eventType int
+
+const (
+	createEvent eventType = iota
+	updateEvent
+	deleteEvent
+)
+
+type step struct {
+	typ eventType
+	obj runtime.Object
+}
+
+// testEnv drives controller with a fake vanguard2 server through grpc, the
+// objects visible in cache follow the events
+type testEnv struct {
+	t        *testing.T
+	server   *fakeserver.Server
+	addr     string
+	client   *VgClient
+	ctl      *Controller
+	objs     map[string]runtime.Object
+	baseline map[string]struct{}
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	return newTestEnvWithOptions(t, Options{})
+}
+
+func newTestEnvWithOptions(t *testing.T, opts Options) *testEnv {
+	server := fakeserver.New()
+	addr, err := server.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start fake server failed:%s", err.Error())
+	}
+
+	client, err := NewVgClient(addr, testClusterDomain, testServiceIPRange, testPodIPRange, testDNSServer, "", "")
+	if err != nil {
+		server.Stop()
+		t.Fatalf("create client failed:%s", err.Error())
+	}
+
+	ctl, err := newController(client, opts, "")
+	if err != nil {
+		t.Fatalf("create controller failed:%s", err.Error())
+	}
+
+	env := &testEnv{
+		t:      t,
+		server: server,
+		addr:   addr,
+		client: client,
+		ctl:    ctl,
+		objs:   make(map[string]runtime.Object),
+	}
+	env.syncCache()
+	env.baseline = make(map[string]struct{})
+	for _, r := range env.allRecords() {
+		env.baseline[r] = struct{}{}
+	}
+	return env
+}
+
+func (env *testEnv) close() {
+	env.client.Close()
+	env.server.Stop()
+}
+
+func (env *testEnv) run(s step) {
+	key := objectKey(s.obj)
+	old := env.objs[key]
+	if s.typ == deleteEvent {
+		delete(env.objs, key)
+	} else {
+		env.objs[key] = s.obj
+	}
+	env.syncCache()
+
+	switch s.typ {
+	case createEvent:
+		env.ctl.OnCreate(event.CreateEvent{Object: s.obj})
+	case updateEvent:
+		if old == nil {
+			env.t.Fatalf("update unknown object %s", key)
+		}
+		env.ctl.OnUpdate(event.UpdateEvent{ObjectOld: old, ObjectNew: s.obj})
+	case deleteEvent:
+		env.ctl.OnDelete(event.DeleteEvent{Object: s.obj})
+	}
+	env.ctl.processQueue()
+}
+
+func (env *testEnv) syncCache() {
+	var objs []runtime.Object
+	for _, obj := range env.objs {
+		objs = append(objs, obj)
+	}
+	env.ctl.cache = newObjectStore(objs)
+}
+
+// records generated by controller, records created with zones are excluded
+func (env *testEnv) records() []string {
+	var records []string
+	for _, r := range env.allRecords() {
+		if _, ok := env.baseline[r]; ok == false {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func (env *testEnv) allRecords() []string {
+	store := env.server.Store()
+	var records []string
+	for _, zone := range store.Zones(DefaultView) {
+		rrsets, err := store.RRsets(DefaultView, zone)
+		if err != nil {
+			env.t.Fatalf("get rrsets of zone %s failed:%s", zone, err.Error())
+		}
+		for _, rrset := range rrsets {
+			for _, rdata := range rrset.Rdatas {
+				records = append(records, fmt.Sprintf("%s %s %s", rrset.Name.String(false), rrset.Type.String(), rdata.String()))
+			}
+		}
+	}
+	sort.Strings(records)
+	return records
+}
+
+func objectKey(obj runtime.Object) string {
+	meta := obj.(metav1.Object)
+	return fmt.Sprintf("%T/%s/%s", obj, meta.GetNamespace(), meta.GetName())
+}
+
+func clusterIPService(namespace, name, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: clusterIP,
+		},
+	}
+}
+
+func headlessService(namespace, name string) *corev1.Service {
+	return clusterIPService(namespace, name, corev1.ClusterIPNone)
+}
+
+func externalNameService(namespace, name, externalName string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.ServiceSpec{
+			Type:         corev1.ServiceTypeExternalName,
+			ExternalName: externalName,
+		},
+	}
+}
+
+// address is ip or hostname=ip
+func endpoints(namespace, name string, addrs []string, ports ...corev1.EndpointPort) *corev1.Endpoints {
+	var addresses []corev1.EndpointAddress
+	for _, addr := range addrs {
+		address := corev1.EndpointAddress{IP: addr}
+		if fields := strings.SplitN(addr, "=", 2); len(fields) == 2 {
+			address.Hostname, address.IP = fields[0], fields[1]
+		}
+		addresses = append(addresses, address)
+	}
+
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: addresses,
+				Ports:     ports,
+			},
+		},
+	}
+}
+
+func tcpPort(name string, port int32) corev1.EndpointPort {
+	return corev1.EndpointPort{Name: name, Port: port, Protocol: corev1.ProtocolTCP}
+}
+
+func TestServiceRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		steps   []step
+		records []string
+	}{
+		{
+			name: "cluster ip",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5", "10.42.1.6"}, tcpPort("http", 80))},
+			},
+			records: []string{
+				"10-42-1-5.web.default.svc.cluster.local. A 10.42.1.5",
+				"10-42-1-6.web.default.svc.cluster.local. A 10.42.1.6",
+				"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+				"5.1.42.10.in-addr.arpa. PTR 10-42-1-5.web.default.svc.cluster.local.",
+				"6.1.42.10.in-addr.arpa. PTR 10-42-1-6.web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.43.0.20",
+			},
+		},
+		{
+			name: "headless",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"db-0=10.42.2.7", "db-1=10.42.2.8"}, tcpPort("pg", 5432))},
+			},
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"8.2.42.10.in-addr.arpa. PTR db-1.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-1.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db-1.db.prod.svc.cluster.local. A 10.42.2.8",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.8",
+			},
+		},
+		{
+			name: "external name",
+			steps: []step{
+				{createEvent, externalNameService("prod", "ext", "example.com")},
+			},
+			records: []string{
+				"ext.prod.svc.cluster.local. CNAME example.com.",
+			},
+		},
+		{
+			name: "named ports",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80), tcpPort("", 8080),
+					corev1.EndpointPort{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP})},
+			},
+			records: []string{
+				"10-42-1-5.web.default.svc.cluster.local. A 10.42.1.5",
+				"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+				"5.1.42.10.in-addr.arpa. PTR 10-42-1-5.web.default.svc.cluster.local.",
+				"_dns._udp.web.default.svc.cluster.local. SRV 10 100 53 web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.43.0.20",
+			},
+		},
+		{
+			name: "hostname collision",
+			steps: []step{
+				{createEvent, headlessService("default", "web")},
+				{createEvent, endpoints("default", "web", []string{"web=10.42.1.5", "web=10.42.1.6"}, tcpPort("http", 80))},
+			},
+			records: []string{
+				"5.1.42.10.in-addr.arpa. PTR web.web.default.svc.cluster.local.",
+				"6.1.42.10.in-addr.arpa. PTR web.web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 web.web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.42.1.5",
+				"web.default.svc.cluster.local. A 10.42.1.6",
+				"web.web.default.svc.cluster.local. A 10.42.1.5",
+				"web.web.default.svc.cluster.local. A 10.42.1.6",
+			},
+		},
+		{
+			name: "cluster ip to external name",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{updateEvent, externalNameService("default", "web", "example.com")},
+			},
+			records: []string{
+				"web.default.svc.cluster.local. CNAME example.com.",
+			},
+		},
+		{
+			name: "external name to cluster ip",
+			steps: []step{
+				{createEvent, externalNameService("default", "web", "example.com")},
+				{updateEvent, clusterIPService("default", "web", "10.43.0.20")},
+			},
+			records: []string{
+				"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.43.0.20",
+			},
+		},
+		{
+			name: "external name changed",
+			steps: []step{
+				{createEvent, externalNameService("default", "web", "example.com")},
+				{updateEvent, externalNameService("default", "web", "example.org")},
+			},
+			records: []string{
+				"web.default.svc.cluster.local. CNAME example.org.",
+			},
+		},
+		{
+			name: "cluster ip to headless",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{updateEvent, headlessService("default", "web")},
+			},
+			records: []string{
+				"10-42-1-5.web.default.svc.cluster.local. A 10.42.1.5",
+				"5.1.42.10.in-addr.arpa. PTR 10-42-1-5.web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 10-42-1-5.web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.42.1.5",
+			},
+		},
+		{
+			name: "endpoints changed",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{updateEvent, endpoints("default", "web", []string{"10.42.1.6"}, tcpPort("http", 8080))},
+			},
+			records: []string{
+				"10-42-1-6.web.default.svc.cluster.local. A 10.42.1.6",
+				"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+				"6.1.42.10.in-addr.arpa. PTR 10-42-1-6.web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 8080 web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.43.0.20",
+			},
+		},
+		{
+			name: "endpoints before service",
+			steps: []step{
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+			},
+			records: []string{
+				"10-42-1-5.web.default.svc.cluster.local. A 10.42.1.5",
+				"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+				"5.1.42.10.in-addr.arpa. PTR 10-42-1-5.web.default.svc.cluster.local.",
+				"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 web.default.svc.cluster.local.",
+				"web.default.svc.cluster.local. A 10.43.0.20",
+			},
+		},
+		{
+			name: "service deleted before endpoints",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{deleteEvent, clusterIPService("default", "web", "10.43.0.20")},
+			},
+			records: nil,
+		},
+		{
+			name: "deleted",
+			steps: []step{
+				{createEvent, clusterIPService("default", "web", "10.43.0.20")},
+				{createEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{deleteEvent, endpoints("default", "web", []string{"10.42.1.5"}, tcpPort("http", 80))},
+				{deleteEvent, clusterIPService("default", "web", "10.43.0.20")},
+			},
+			records: nil,
+		},
+		{
+			name: "ip shared by services",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"db-0=10.42.2.7"})},
+				{createEvent, headlessService("prod", "primary")},
+				{createEvent, endpoints("prod", "primary", []string{"db-0=10.42.2.7"})},
+			},
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"7.2.42.10.in-addr.arpa. PTR db-0.primary.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db-0.primary.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+				"primary.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+		{
+			name: "ip shared by services one deleted",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"db-0=10.42.2.7"})},
+				{createEvent, headlessService("prod", "primary")},
+				{createEvent, endpoints("prod", "primary", []string{"db-0=10.42.2.7"})},
+				{deleteEvent, headlessService("prod", "db")},
+			},
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.primary.prod.svc.cluster.local.",
+				"db-0.primary.prod.svc.cluster.local. A 10.42.2.7",
+				"primary.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			defer env.close()
+
+			for _, s := range tc.steps {
+				env.run(s)
+			}
+
+			if records := env.records(); reflect.DeepEqual(records, tc.records) == false {
+				t.Errorf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(tc.records), joinLines(records))
+			}
+		})
+	}
+}
+
+func TestServiceZoneTemplate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+
+	soa := env.server.Store().GetRRset(DefaultView, testClusterDomain, g53.NameFromStringUnsafe(testClusterDomain), g53.RR_SOA)
+	if soa == nil {
+		t.Fatalf("service zone has no soa")
+	}
+	ns := env.server.Store().GetRRset(DefaultView, testClusterDomain, g53.NameFromStringUnsafe("ns.dns."+testClusterDomain), g53.RR_A)
+	if ns == nil || ns.Rdatas[0].String() != testDNSServer {
+		t.Errorf("name server address should be %s", testDNSServer)
+	}
+}
+
+func joinLines(lines []string) string {
+	return "  " + strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+
+	"github.com/zdnscloud/gok8s/cache"
+	"github.com/zdnscloud/gok8s/client"
+	"github.com/zdnscloud/gok8s/client/config"
+	"github.com/zdnscloud/gok8s/controller"
+	"github.com/zdnscloud/gok8s/event"
+	"github.com/zdnscloud/gok8s/handler"
+	"github.com/zdnscloud/gok8s/predicate"
+)
+
+const (
+	ServiceExportAnnotation = "vanguard2.zdns.cn/export"
+)
+
+type memberCluster struct {
+	name       string
+	cache      client.Reader
+	controller controller.Controller
+}
+
+// MultiClusterController watches services exported by any member cluster,
+// and hands them to the local controller, which publishes them under the
+// clusterset zone with its ttl, naming schemes and views. The records of a
+// service aggregate the cluster ips or the headless endpoints of the service
+// in all member clusters. Only the a rrset of the service is published, pod
+// names and srv records of headless services stay in the zone of each cluster
+type MultiClusterController struct {
+	ctl     *Controller
+	members []*memberCluster
+	stopCh  chan struct{}
+}
+
+// clustersetKey shares the queue with services, it's the namespace and name
+// of the service in all member clusters
+type clustersetKey types.NamespacedName
+
+// each kubeconfig is a file path optionally prefixed with the cluster name,
+// like "east=/etc/kubeconfig/east", the local cluster is always a member.
+// Clusterset zone is managed like service zone, records of services which
+// are no longer exported are dropped with the zone on start, or collected as
+// garbage if zones are shared with other writers
+func NewMultiClusterController(ctl *Controller, clustersetDomain string, kubeconfigs []string) (*MultiClusterController, error) {
+	mc := &MultiClusterController{
+		ctl:    ctl,
+		stopCh: make(chan struct{}),
+	}
+
+	localCfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := mc.addMember("local", localCfg); err != nil {
+		return nil, err
+	}
+
+	for _, kubeconfig := range kubeconfigs {
+		name, path := kubeconfig, kubeconfig
+		if i := strings.Index(kubeconfig, "="); i != -1 {
+			name, path = kubeconfig[:i], kubeconfig[i+1:]
+		}
+		cfg, err := config.GetConfigFromFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("load kubeconfig of cluster %s failed:%s", name, err.Error())
+		}
+		if err := mc.addMember(name, cfg); err != nil {
+			return nil, fmt.Errorf("connect cluster %s failed:%s", name, err.Error())
+		}
+	}
+
+	ctl.reloadLock.Lock()
+	defer ctl.reloadLock.Unlock()
+	if err := ctl.client.SetClustersetDomain(clustersetDomain); err != nil {
+		return nil, err
+	}
+	ctl.clusterset = mc
+	return mc, nil
+}
+
+func (mc *MultiClusterController) addMember(name string, cfg *rest.Config) error {
+	c, err := cache.New(cfg, cache.Options{})
+	if err != nil {
+		return err
+	}
+
+	go c.Start(mc.stopCh)
+	c.WaitForCacheSync(mc.stopCh)
+
+	ctrl := controller.New("vanguard_multi_cluster_controller_"+name, c, scheme.Scheme)
+	ctrl.Watch(&corev1.Endpoints{})
+	ctrl.Watch(&corev1.Service{})
+	mc.members = append(mc.members, &memberCluster{
+		name:       name,
+		cache:      c,
+		controller: ctrl,
+	})
+	return nil
+}
+
+// Run starts watching member clusters, it should be stopped before the local
+// controller is shut down
+func (mc *MultiClusterController) Run() {
+	var wg sync.WaitGroup
+	for _, m := range mc.members {
+		wg.Add(1)
+		go func(m *memberCluster) {
+			defer wg.Done()
+			m.controller.Start(mc.stopCh, mc, predicate.NewIgnoreUnchangedUpdate())
+		}(m)
+	}
+	wg.Wait()
+}
+
+// Stop stops watching member clusters, Run returns after handlers finish
+func (mc *MultiClusterController) Stop() {
+	close(mc.stopCh)
+}
+
+func (mc *MultiClusterController) OnCreate(e event.CreateEvent) (handler.Result, error) {
+	mc.enqueue(e.Meta.GetNamespace(), e.Meta.GetName())
+	return handler.Result{}, nil
+}
+
+func (mc *MultiClusterController) OnUpdate(e event.UpdateEvent) (handler.Result, error) {
+	mc.enqueue(e.MetaNew.GetNamespace(), e.MetaNew.GetName())
+	return handler.Result{}, nil
+}
+
+func (mc *MultiClusterController) OnDelete(e event.DeleteEvent) (handler.Result, error) {
+	mc.enqueue(e.Meta.GetNamespace(), e.Meta.GetName())
+	return handler.Result{}, nil
+}
+
+func (mc *MultiClusterController) OnGeneric(e event.GenericEvent) (handler.Result, error) {
+	return handler.Result{}, nil
+}
+
+// service and endpoints share the same name, so both trigger the aggregation
+// of the service
+func (mc *MultiClusterController) enqueue(namespace, name string) {
+	mc.ctl.reloadLock.RLock()
+	defer mc.ctl.reloadLock.RUnlock()
+	mc.ctl.queue.Add(clustersetKey{Namespace: namespace, Name: name})
+}
+
+// exportedServices returns the keys of services exported by any member
+func (mc *MultiClusterController) exportedServices() ([]clustersetKey, error) {
+	var keys []clustersetKey
+	for _, m := range mc.members {
+		var services corev1.ServiceList
+		if err := m.cache.List(context.TODO(), nil, &services); err != nil {
+			return nil, fmt.Errorf("list services in cluster %s failed:%s", m.name, err.Error())
+		}
+		for _, svc := range services.Items {
+			key := clustersetKey{Namespace: svc.Namespace, Name: svc.Name}
+			if isServiceExported(&svc) && hasClustersetKey(keys, key) == false {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func hasClustersetKey(keys []clustersetKey, key clustersetKey) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// exportedServiceIPs aggregates the addresses of service in all members
+func (mc *MultiClusterController) exportedServiceIPs(key types.NamespacedName) ([]g53.Rdata, error) {
+	var rdatas []g53.Rdata
+	for _, m := range mc.members {
+		ips, err := m.exportedServiceIPs(key)
+		if err != nil {
+			return nil, fmt.Errorf("get service in cluster %s failed:%s", m.name, err.Error())
+		}
+		for _, ip := range ips {
+			rdata, err := g53.AFromString(ip)
+			if err != nil || hasRdata(rdatas, rdata) {
+				continue
+			}
+			rdatas = append(rdatas, rdata)
+		}
+	}
+	return rdatas, nil
+}
+
+func (m *memberCluster) exportedServiceIPs(key types.NamespacedName) ([]string, error) {
+	var svc corev1.Service
+	if err := m.cache.Get(context.TODO(), key, &svc); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	} else if isServiceExported(&svc) == false {
+		return nil, nil
+	}
+
+	if isNormalService(&svc) {
+		return []string{svc.Spec.ClusterIP}, nil
+	} else if isHeaderlessService(&svc) == false {
+		return nil, nil
+	}
+
+	var ep corev1.Endpoints
+	if err := m.cache.Get(context.TODO(), key, &ep); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ips []string
+	for _, subset := range ep.Subsets {
+		for _, addr := range subset.Addresses {
+			if addr.IP != "" {
+				ips = append(ips, addr.IP)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// each clusterset name has only one owner
+func newClustersetRegistry() *nameRegistry {
+	return newNameRegistry(func(owners map[types.NamespacedName][]*g53.RRset) []*g53.RRset {
+		if sorted := sortedOwners(owners); len(sorted) != 0 {
+			return owners[sorted[0]]
+		}
+		return nil
+	})
+}
+
+// reconcileClustersetService publishes the aggregated addresses of the
+// service under clusterset zone, in the views of its namespace in local
+// cluster
+func (c *Controller) reconcileClustersetService(key types.NamespacedName) error {
+	if c.clusterset == nil {
+		return nil
+	}
+
+	rdatas, err := c.clusterset.exportedServiceIPs(key)
+	if err != nil {
+		return err
+	}
+
+	var records []serviceRecord
+	if len(rdatas) != 0 {
+		views, err := c.getViews(key.Namespace)
+		if err != nil {
+			return err
+		}
+		for _, scheme := range c.client.clustersetSchemes() {
+			name, err := scheme.serviceName(key.Name, key.Namespace)
+			if err != nil {
+				return err
+			}
+			for _, view := range views {
+				records = append(records, serviceRecord{view, scheme.zone, newRRset(name, g53.RR_A, c.ttl(), rdatas...)})
+			}
+		}
+	}
+	return c.publishShared(c.clustersetRecords, key, records, "clusterset rrsets")
+}
+
+// enqueueClustersetServices enqueues the services exported by any member and
+// the ones published before, so unexported ones are withdrawn
+func (c *Controller) enqueueClustersetServices() error {
+	if c.clusterset == nil {
+		return nil
+	}
+
+	keys, err := c.clusterset.exportedServices()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.queue.Add(key)
+	}
+	for _, owner := range c.clustersetRecords.owners() {
+		c.queue.Add(clustersetKey(owner))
+	}
+	return nil
+}
+
+func isServiceExported(svc *corev1.Service) bool {
+	return svc.Annotations[ServiceExportAnnotation] == "true"
+}
+
+func hasRdata(rdatas []g53.Rdata, rdata g53.Rdata) bool {
+	for _, r := range rdatas {
+		if r.Compare(rdata) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+)
+
+func exportedService(svc *corev1.Service) *corev1.Service {
+	svc.Annotations = map[string]string{ServiceExportAnnotation: "true"}
+	return svc
+}
+
+// exported services of all members are published with the ttl and naming
+// schemes of local controller, unexported ones are withdrawn
+func TestClustersetServices(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{TTL: 30})
+	defer env.close()
+	err := env.client.SetNamingSchemes([]config.NamingScheme{
+		{Service: "{{.Service}}-{{.Namespace}}.{{.Zone}}"},
+	})
+	if err != nil {
+		t.Fatalf("set naming schemes failed:%s", err.Error())
+	}
+	if err := env.client.SetClustersetDomain("clusterset.local"); err != nil {
+		t.Fatalf("set clusterset domain failed:%s", err.Error())
+	}
+	if err := env.client.SetClusterDomainAliases([]string{"clusterset.local"}); err == nil {
+		t.Fatalf("alias shouldn't reuse clusterset zone")
+	}
+	for _, r := range env.allRecords() {
+		env.baseline[r] = struct{}{}
+	}
+
+	east := &memberCluster{name: "east", cache: newObjectStore(nil)}
+	west := &memberCluster{name: "west", cache: newObjectStore(nil)}
+	env.ctl.clusterset = &MultiClusterController{ctl: env.ctl, members: []*memberCluster{east, west}}
+	sync := func(m *memberCluster, objs ...runtime.Object) {
+		m.cache = newObjectStore(objs)
+		if err := env.ctl.enqueueClustersetServices(); err != nil {
+			t.Fatalf("enqueue clusterset services failed:%s", err.Error())
+		}
+		env.ctl.processQueue()
+	}
+
+	sync(east, exportedService(clusterIPService("default", "web", "10.43.0.5")),
+		exportedService(headlessService("default", "db")),
+		endpoints("default", "db", []string{"10.42.0.7"}),
+		clusterIPService("default", "api", "10.43.0.6"))
+	sync(west, exportedService(clusterIPService("default", "web", "10.44.0.5")))
+	want := []string{
+		"db-default.clusterset.local. A 10.42.0.7",
+		"web-default.clusterset.local. A 10.43.0.5",
+		"web-default.clusterset.local. A 10.44.0.5",
+	}
+	if got := env.recordsWithSuffix("clusterset.local."); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("clusterset records:\n%v\nwant:\n%v", got, want)
+	}
+	name := g53.NameFromStringUnsafe("web-default.clusterset.local")
+	if rrset := env.server.Store().GetRRset(DefaultView, "clusterset.local.", name, g53.RR_A); rrset == nil || rrset.Ttl != 30 {
+		t.Errorf("clusterset rrset should use configured ttl:%v", rrset)
+	}
+
+	sync(west, clusterIPService("default", "web", "10.44.0.5"))
+	sync(east)
+	if got := env.recordsWithSuffix("clusterset.local."); len(got) != 0 {
+		t.Errorf("unexported services should be withdrawn:%v", got)
+	}
+}
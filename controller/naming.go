@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const (
+	DefaultServiceNameTemplate   = "{{.Service}}.{{.Namespace}}.svc.{{.Zone}}"
+	DefaultEndpointsNameTemplate = "{{.Hostname}}.{{.Service}}.{{.Namespace}}.svc.{{.Zone}}"
+	DefaultPortNameTemplate      = "_{{.Port}}._{{.Protocol}}.{{.Service}}.{{.Namespace}}.svc.{{.Zone}}"
+)
+
+type namingScheme struct {
+	zone      *g53.Name
+	service   string
+	endpoints string
+	port      string
+}
+
+type nameParameter struct {
+	Service   string
+	Namespace string
+	Hostname  string
+	Port      string
+	Protocol  string
+	Zone      string
+}
+
+func defaultNamingScheme(zone *g53.Name) *namingScheme {
+	return &namingScheme{
+		zone:      zone,
+		service:   DefaultServiceNameTemplate,
+		endpoints: DefaultEndpointsNameTemplate,
+		port:      DefaultPortNameTemplate,
+	}
+}
+
+func newNamingScheme(s config.NamingScheme, clusterDomain *g53.Name) (*namingScheme, error) {
+	scheme := defaultNamingScheme(clusterDomain)
+	if s.Zone != "" {
+		zone, err := g53.NameFromString(s.Zone)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s is invalid:%s", s.Zone, err.Error())
+		}
+		scheme.zone = zone
+	}
+	for _, t := range []struct {
+		value string
+		field *string
+	}{
+		{s.Service, &scheme.service},
+		{s.Endpoints, &scheme.endpoints},
+		{s.Port, &scheme.port},
+	} {
+		if t.value == "" {
+			continue
+		}
+		//CompileTemplateFromMap panics with invalid template
+		if _, err := template.New("name").Parse(t.value); err != nil {
+			return nil, fmt.Errorf("template %q is invalid:%s", t.value, err.Error())
+		}
+		*t.field = t.value
+	}
+
+	if err := scheme.validate(); err != nil {
+		return nil, err
+	}
+	//schemes are copied into alias zones, so names should be rendered
+	//from Zone instead of hard-coding it
+	probe := *scheme
+	probe.zone, _ = g53.NameFromString("zone-probe." + scheme.zone.String(false))
+	for _, tmpl := range []string{scheme.service, scheme.endpoints, scheme.port} {
+		if _, err := probe.render(tmpl, sampleNameParameter); err != nil {
+			return nil, fmt.Errorf("template %q should use {{.Zone}} instead of zone %s", tmpl, scheme.zone.String(false))
+		}
+	}
+	return scheme, nil
+}
+
+var sampleNameParameter = nameParameter{Service: "svc", Namespace: "ns", Hostname: "host", Port: "http", Protocol: "tcp"}
+
+// validate checks the names rendered from templates are in zone
+func (s *namingScheme) validate() error {
+	for _, tmpl := range []string{s.service, s.endpoints, s.port} {
+		if _, err := s.render(tmpl, sampleNameParameter); err != nil {
+			return err
+		}
+	}
+	//addresses of endpoints are distinguished by hostname
+	other := sampleNameParameter
+	other.Hostname = "other"
+	n1, _ := s.render(s.endpoints, sampleNameParameter)
+	n2, _ := s.render(s.endpoints, other)
+	if n1.Equals(n2) {
+		return fmt.Errorf("endpoints template %q doesn't use hostname", s.endpoints)
+	}
+	return nil
+}
+
+// parseNamingSchemes returns the schemes and their zones other than cluster
+// domain
+func parseNamingSchemes(schemes []config.NamingScheme, clusterDomain *g53.Name) ([]*namingScheme, []*g53.Name, error) {
+	var parsed []*namingScheme
+	var zones []*g53.Name
+	for _, s := range schemes {
+		scheme, err := newNamingScheme(s, clusterDomain)
+		if err != nil {
+			return nil, nil, err
+		}
+		parsed = append(parsed, scheme)
+		if scheme.zone.Equals(clusterDomain) == false && hasName(zones, scheme.zone) == false {
+			zones = append(zones, scheme.zone)
+		}
+	}
+	return parsed, zones, nil
+}
+
+func parseAliases(aliases []string, clusterDomain *g53.Name) ([]*g53.Name, error) {
+	var zones []*g53.Name
+	for _, alias := range aliases {
+		zone, err := g53.NameFromString(alias)
+		if err != nil {
+			return nil, fmt.Errorf("cluster domain alias %s is invalid:%s", alias, err.Error())
+		}
+		if zone.Equals(clusterDomain) == false && hasName(zones, zone) == false {
+			zones = append(zones, zone)
+		}
+	}
+	return zones, nil
+}
+
+// validateAliasSchemes checks the names of schemes copied into alias zones
+func validateAliasSchemes(schemes []*namingScheme, clusterDomain *g53.Name, aliasZones []*g53.Name) error {
+	for _, scheme := range aliasSchemes(schemes, clusterDomain, aliasZones)[len(schemes):] {
+		if err := scheme.validate(); err != nil {
+			return fmt.Errorf("naming scheme in alias zone %s is invalid:%s", scheme.zone.String(false), err.Error())
+		}
+	}
+	return nil
+}
+
+// aliasSchemes appends copies of schemes in cluster domain into each alias
+// zone
+func aliasSchemes(schemes []*namingScheme, clusterDomain *g53.Name, aliasZones []*g53.Name) []*namingScheme {
+	result := append([]*namingScheme(nil), schemes...)
+	for _, zone := range aliasZones {
+		for _, scheme := range schemes {
+			if scheme.zone.Equals(clusterDomain) {
+				alias := *scheme
+				alias.zone = zone
+				result = append(result, &alias)
+			}
+		}
+	}
+	return result
+}
+
+// render returns the name from template, it should be in the zone
+func (s *namingScheme) render(tmpl string, p nameParameter) (*g53.Name, error) {
+	p.Zone = strings.TrimSuffix(s.zone.String(false), ".")
+	out, err := util.CompileTemplateFromMap(tmpl, p)
+	if err != nil {
+		return nil, fmt.Errorf("render template %q failed:%s", tmpl, err.Error())
+	}
+	name, err := g53.NameFromString(out)
+	if err != nil {
+		return nil, fmt.Errorf("name %q from template %q is invalid:%s", out, tmpl, err.Error())
+	}
+	if isNameInZone(name, s.zone) == false {
+		return nil, fmt.Errorf("name %s from template %q isn't in zone %s", out, tmpl, s.zone.String(false))
+	}
+	return name, nil
+}
+
+func (s *namingScheme) isDefault() bool {
+	return s.service == DefaultServiceNameTemplate &&
+		s.endpoints == DefaultEndpointsNameTemplate &&
+		s.port == DefaultPortNameTemplate
+}
+
+func (s *namingScheme) serviceName(name, namespace string) (*g53.Name, error) {
+	return s.render(s.service, nameParameter{Service: name, Namespace: namespace})
+}
+
+func (s *namingScheme) endpointsAddrName(addr *corev1.EndpointAddress, svc, namespace string) (*g53.Name, error) {
+	hostname := addr.Hostname
+	if hostname == "" {
+		hostname = strings.Replace(addr.IP, ".", "-", 3)
+	}
+	return s.render(s.endpoints, nameParameter{Service: svc, Namespace: namespace, Hostname: hostname})
+}
+
+func (s *namingScheme) portName(port, protocol, svc, namespace string) (*g53.Name, error) {
+	return s.render(s.port, nameParameter{Service: svc, Namespace: namespace, Port: port, Protocol: protocol})
+}
+
+// Namer generates the names of a naming scheme, it's used to check the
+// published records
+type Namer struct {
+	scheme *namingScheme
+}
+
+// NewNamers returns namers of the schemes and their copies in alias zones
+// like VgClient publishes, the default scheme is used if schemes is empty
+func NewNamers(clusterDomain string, schemes []config.NamingScheme, aliases []string) ([]Namer, error) {
+	zone, err := g53.NameFromString(clusterDomain)
+	if err != nil {
+		return nil, err
+	}
+	parsed := []*namingScheme{defaultNamingScheme(zone)}
+	if len(schemes) != 0 {
+		if parsed, _, err = parseNamingSchemes(schemes, zone); err != nil {
+			return nil, err
+		}
+	}
+	aliasZones, err := parseAliases(aliases, zone)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAliasSchemes(parsed, zone, aliasZones); err != nil {
+		return nil, err
+	}
+
+	var namers []Namer
+	for _, scheme := range aliasSchemes(parsed, zone, aliasZones) {
+		namers = append(namers, Namer{scheme})
+	}
+	return namers, nil
+}
+
+func (n Namer) Zone() *g53.Name {
+	return n.scheme.zone
+}
+
+func (n Namer) ServiceName(service, namespace string) (*g53.Name, error) {
+	return n.scheme.serviceName(service, namespace)
+}
+
+func (n Namer) EndpointsName(hostname, service, namespace string) (*g53.Name, error) {
+	return n.scheme.endpointsAddrName(&corev1.EndpointAddress{Hostname: hostname}, service, namespace)
+}
+
+func (n Namer) PortName(port, protocol, service, namespace string) (*g53.Name, error) {
+	return n.scheme.portName(port, protocol, service, namespace)
+}
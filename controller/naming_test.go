@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+)
+
+func TestNamingSchemes(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	err := env.client.SetNamingSchemes([]config.NamingScheme{
+		{},
+		{
+			Zone:      "prod.example",
+			Service:   "{{.Service}}.{{.Namespace}}.{{.Zone}}",
+			Endpoints: "{{.Hostname}}.{{.Service}}.{{.Namespace}}.{{.Zone}}",
+			Port:      "_{{.Port}}._{{.Protocol}}.{{.Service}}.{{.Namespace}}.{{.Zone}}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("set naming schemes failed:%s", err.Error())
+	}
+	for _, r := range env.allRecords() {
+		env.baseline[r] = struct{}{}
+	}
+
+	env.run(step{createEvent, clusterIPService("default", "web", "10.43.0.20")})
+	env.run(step{createEvent, endpoints("default", "web", []string{"10.42.0.5"}, tcpPort("http", 80))})
+	want := []string{
+		"10-42-0-5.web.default.prod.example. A 10.42.0.5",
+		"10-42-0-5.web.default.svc.cluster.local. A 10.42.0.5",
+		"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+		"5.0.42.10.in-addr.arpa. PTR 10-42-0-5.web.default.svc.cluster.local.",
+		"_http._tcp.web.default.prod.example. SRV 10 100 80 web.default.prod.example.",
+		"_http._tcp.web.default.svc.cluster.local. SRV 10 100 80 web.default.svc.cluster.local.",
+		"web.default.prod.example. A 10.43.0.20",
+		"web.default.svc.cluster.local. A 10.43.0.20",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	invalid := []config.NamingScheme{
+		{Service: "{{.Service}"},
+		{Service: "{{.Service}}.{{.Namespace}}.other.zone"},
+		//zone is hard-coded, names would be out of alias zones
+		{Service: "{{.Service}}.{{.Namespace}}.cluster.local"},
+		{Endpoints: "{{.Service}}.{{.Namespace}}.{{.Zone}}"},
+	}
+	for _, scheme := range invalid {
+		if err := env.client.SetNamingSchemes([]config.NamingScheme{scheme}); err == nil {
+			t.Errorf("naming scheme %v should be rejected", scheme)
+		}
+	}
+}
+
+func TestClusterDomainAliases(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	if err := env.client.SetClusterDomainAliases([]string{"cluster-a.example"}); err != nil {
+		t.Fatalf("set cluster domain aliases failed:%s", err.Error())
+	}
+	for _, r := range env.allRecords() {
+		env.baseline[r] = struct{}{}
+	}
+
+	env.run(step{createEvent, headlessService("default", "db")})
+	env.run(step{createEvent, endpoints("default", "db", []string{"db-0=10.42.0.5"})})
+	env.run(step{updateEvent, endpoints("default", "db", []string{"db-0=10.42.0.6"})})
+	want := []string{
+		"6.0.42.10.in-addr.arpa. PTR db-0.db.default.svc.cluster.local.",
+		"db-0.db.default.svc.cluster-a.example. A 10.42.0.6",
+		"db-0.db.default.svc.cluster.local. A 10.42.0.6",
+		"db.default.svc.cluster-a.example. A 10.42.0.6",
+		"db.default.svc.cluster.local. A 10.42.0.6",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+}
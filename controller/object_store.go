@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+// objectStore is a read only client.Reader on a fixed set of objects, it
+// replaces the informer cache when there is no k8s cluster
+type objectStore struct {
+	objs []runtime.Object
+}
+
+var _ client.Reader = &objectStore{}
+
+func newObjectStore(objs []runtime.Object) *objectStore {
+	return &objectStore{
+		objs: objs,
+	}
+}
+
+func (s *objectStore) Get(ctx context.Context, key client.ObjectKey, out runtime.Object) error {
+	for _, obj := range s.objs {
+		if reflect.TypeOf(obj) != reflect.TypeOf(out) {
+			continue
+		}
+
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		if accessor.GetNamespace() == key.Namespace && accessor.GetName() == key.Name {
+			reflect.ValueOf(out).Elem().Set(reflect.ValueOf(obj.DeepCopyObject()).Elem())
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{Resource: reflect.TypeOf(out).Elem().Name()}, key.String())
+}
+
+func (s *objectStore) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	itemsPtr, err := meta.GetItemsPtr(list)
+	if err != nil {
+		return err
+	}
+	itemType := reflect.PtrTo(reflect.Indirect(reflect.ValueOf(itemsPtr)).Type().Elem())
+
+	var items []runtime.Object
+	for _, obj := range s.objs {
+		if reflect.TypeOf(obj) != itemType {
+			continue
+		}
+
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		if opts != nil {
+			if opts.Namespace != "" && accessor.GetNamespace() != opts.Namespace {
+				continue
+			}
+			if opts.LabelSelector != nil && opts.LabelSelector.Matches(labels.Set(accessor.GetLabels())) == false {
+				continue
+			}
+		}
+		items = append(items, obj.DeepCopyObject())
+	}
+	return meta.SetList(list, items)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/zdnscloud/vanguard2-controller/crd"
+)
+
+// NewOfflineController generates records for objs without k8s cluster, the
+// records are pushed to vgClient before it returns
+func NewOfflineController(vgClient *VgClient, objs []runtime.Object, opts Options) (*Controller, error) {
+	c, err := newController(vgClient, opts, "")
+	if err != nil {
+		return nil, err
+	}
+	c.cache = newObjectStore(objs)
+
+	//zones should exist before records in them
+	for _, obj := range objs {
+		if zone, ok := obj.(*crd.DNSZone); ok && opts.WatchDNSResource {
+			c.queue.Add(dnsZoneKey(zone.Name))
+		}
+	}
+	c.processQueue()
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *corev1.Service:
+			c.enqueueService(o.Namespace, o.Name)
+		case *corev1.Endpoints:
+			c.enqueueService(o.Namespace, o.Name)
+		}
+	}
+	c.processQueue()
+
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *extv1beta1.Ingress:
+			if opts.WatchIngress {
+				c.enqueueIngress(o.Namespace, o.Name)
+			}
+		case *crd.DNSRecord:
+			if opts.WatchDNSResource {
+				c.queue.Add(dnsRecordKey{Namespace: o.Namespace, Name: o.Name})
+			}
+		}
+	}
+	c.processQueue()
+	return c, nil
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+// pod with hostname and subdomain belongs to the service named by subdomain
+func (c *Controller) enqueuePodService(pod *corev1.Pod) {
+	if pod.Spec.Hostname != "" && pod.Spec.Subdomain != "" {
+		c.enqueueService(pod.Namespace, pod.Spec.Subdomain)
+	}
+}
+
+func isPodNameChanged(old, new *corev1.Pod) bool {
+	return old.Spec.Hostname != new.Spec.Hostname ||
+		old.Spec.Subdomain != new.Spec.Subdomain ||
+		old.Status.PodIP != new.Status.PodIP ||
+		(old.DeletionTimestamp == nil) != (new.DeletionTimestamp == nil)
+}
+
+// podHostnameRRsets returns a rrsets of pods whose subdomain is the headless
+// service, pods don't need to be ready. Names already generated from
+// endpoints win, then the oldest pod, others are reported by events
+func (c *Controller) podHostnameRRsets(scheme *namingScheme, svc *corev1.Service, rrsets []*g53.RRset) ([]*g53.RRset, error) {
+	var pods corev1.PodList
+	if err := c.cache.List(context.TODO(), &client.ListOptions{Namespace: svc.Namespace}, &pods); err != nil {
+		return nil, err
+	}
+
+	var candidates []*corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.Subdomain == svc.Name && pod.Spec.Hostname != "" &&
+			pod.Status.PodIP != "" && pod.DeletionTimestamp == nil {
+			candidates = append(candidates, pod)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ti, tj := candidates[i].CreationTimestamp, candidates[j].CreationTimestamp
+		if ti.Equal(&tj) == false {
+			return ti.Before(&tj)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	endpointsNames := make(map[string]*g53.RRset)
+	for _, rrset := range rrsets {
+		if rrset.Type == g53.RR_A {
+			endpointsNames[rrset.Name.String(false)] = rrset
+		}
+	}
+
+	var result []*g53.RRset
+	claimed := make(map[string]*corev1.Pod)
+	for _, pod := range candidates {
+		rdata, err := g53.AFromString(pod.Status.PodIP)
+		if err != nil {
+			continue
+		}
+
+		n, err := scheme.endpointsAddrName(&corev1.EndpointAddress{Hostname: pod.Spec.Hostname, IP: pod.Status.PodIP}, svc.Name, svc.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		key := n.String(false)
+		if rrset, ok := endpointsNames[key]; ok {
+			if hasRdataString(rrset, rdata.String()) == false {
+				c.recordEvent(pod, corev1.EventTypeWarning, EventReasonHostnameInUse,
+					fmt.Sprintf("%s is used by endpoints address %s", key, strings.Join(rdataStrings(rrset), ",")))
+			}
+			continue
+		}
+		if owner, ok := claimed[key]; ok {
+			c.recordEvent(pod, corev1.EventTypeWarning, EventReasonHostnameInUse,
+				fmt.Sprintf("%s is used by pod %s", key, owner.Name))
+			continue
+		}
+
+		claimed[key] = pod
+		result = append(result, newRRset(n, g53.RR_A, c.ttl(), rdata))
+	}
+	return result, nil
+}
+
+func hasRdataString(rrset *g53.RRset, s string) bool {
+	for _, rdata := range rrset.Rdatas {
+		if rdata.String() == s {
+			return true
+		}
+	}
+	return false
+}
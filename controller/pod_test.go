@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func pod(namespace, name, hostname, subdomain, ip string, created int) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(time.Unix(int64(created), 0)),
+		},
+		Spec:   corev1.PodSpec{Hostname: hostname, Subdomain: subdomain},
+		Status: corev1.PodStatus{PodIP: ip},
+	}
+}
+
+func TestPodHostnameRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		steps   []step
+		records []string
+		events  []string
+	}{
+		{
+			name: "pod before ready",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+				{createEvent, pod("prod", "web", "web", "", "10.42.2.9", 1)},
+			},
+			records: []string{
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+		{
+			name: "pod before service",
+			steps: []step{
+				{createEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+				{createEvent, headlessService("prod", "db")},
+			},
+			records: []string{
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+		{
+			name: "not headless service",
+			steps: []step{
+				{createEvent, clusterIPService("prod", "db", "10.43.0.30")},
+				{createEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+			},
+			records: []string{
+				"30.0.43.10.in-addr.arpa. PTR db.prod.svc.cluster.local.",
+				"db.prod.svc.cluster.local. A 10.43.0.30",
+			},
+		},
+		{
+			name: "pod ready",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+				{createEvent, endpoints("prod", "db", []string{"db-0=10.42.2.7"})},
+			},
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+		{
+			name: "pod deleted",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+				{deleteEvent, pod("prod", "db-0", "db-0", "db", "10.42.2.7", 1)},
+			},
+			records: nil,
+		},
+		{
+			name: "hostname conflicts with pod",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, pod("prod", "db-b", "db-0", "db", "10.42.2.8", 2)},
+				{createEvent, pod("prod", "db-a", "db-0", "db", "10.42.2.7", 1)},
+			},
+			records: []string{
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+			events: []string{
+				"Warning prod/db-b HostnameConflict db-0.db.prod.svc.cluster.local. is used by pod db-a",
+			},
+		},
+		{
+			name: "hostname conflicts with endpoints",
+			steps: []step{
+				{createEvent, headlessService("prod", "db")},
+				{createEvent, endpoints("prod", "db", []string{"10.42.2.7"})},
+				{createEvent, pod("prod", "db-0", "10-42-2-7", "db", "10.42.2.8", 1)},
+			},
+			records: []string{
+				"10-42-2-7.db.prod.svc.cluster.local. A 10.42.2.7",
+				"7.2.42.10.in-addr.arpa. PTR 10-42-2-7.db.prod.svc.cluster.local.",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+			events: []string{
+				"Warning prod/db-0 HostnameConflict 10-42-2-7.db.prod.svc.cluster.local. is used by endpoints address 10.42.2.7",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnvWithOptions(t, Options{WatchPods: true})
+			defer env.close()
+			var events []string
+			env.ctl.events = newEventRecorder(func(e *corev1.Event) error {
+				if e.Reason == EventReasonHostnameInUse {
+					events = append(events, formatEvent(e))
+				}
+				return nil
+			})
+
+			for _, s := range tc.steps {
+				env.run(s)
+			}
+
+			if records := env.records(); reflect.DeepEqual(records, tc.records) == false {
+				t.Errorf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(tc.records), joinLines(records))
+			}
+			if reflect.DeepEqual(events, tc.events) == false {
+				t.Errorf("events mismatch\nwant:\n%s\ngot:\n%s", joinLines(tc.events), joinLines(events))
+			}
+		})
+	}
+}
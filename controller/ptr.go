@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ptrRegistry tracks the names of every service which maps to an ip in each
+// view, the ptr rrset of the ip is generated from all of them, and deleted
+// after the last service goes away
+type ptrRegistry struct {
+	*nameRegistry
+	// canonical is guarded by the lock of nameRegistry, which is held when
+	// records are merged
+	canonical bool
+}
+
+func newPTRRegistry(canonical bool) *ptrRegistry {
+	r := &ptrRegistry{canonical: canonical}
+	r.nameRegistry = newNameRegistry(r.merge)
+	return r
+}
+
+func (r *ptrRegistry) setCanonical(canonical bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.canonical = canonical
+}
+
+// names of all owners are sorted, so the rrset doesn't depend on the order
+// services are handled, with canonical only the first one is used
+func (r *ptrRegistry) merge(owners map[types.NamespacedName][]*g53.RRset) []*g53.RRset {
+	var name *g53.Name
+	var ttl g53.RRTTL
+	targets := make(map[string]g53.Rdata)
+	for _, rrsets := range owners {
+		for _, rrset := range rrsets {
+			if name == nil || rrset.Ttl < ttl {
+				name, ttl = rrset.Name, rrset.Ttl
+			}
+			for _, rdata := range rrset.Rdatas {
+				targets[rdata.String()] = rdata
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if r.canonical {
+		keys = keys[:1]
+	}
+
+	rdatas := make([]g53.Rdata, 0, len(keys))
+	for _, key := range keys {
+		rdatas = append(rdatas, targets[key])
+	}
+	return []*g53.RRset{newRRset(name, g53.RR_PTR, ttl, rdatas...)}
+}
+
+// publishPTRs replaces the ptr records of the service, ptrs failed to push
+// are retried when the service is reconciled again
+func (c *Controller) publishPTRs(owner types.NamespacedName, records []serviceRecord) error {
+	return c.publishShared(c.ptrs.nameRegistry, owner, records, "ptr rrsets")
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zdnscloud/g53"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/types"
+
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+)
+
+// ptrRejector fails the pushes of one name
+type ptrRejector struct {
+	pb.DynamicUpdateInterfaceClient
+	name string
+}
+
+func (r *ptrRejector) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (*pb.AddRRsetResponse, error) {
+	for _, rrset := range in.Rrsets {
+		if rrset.Name == r.name {
+			return nil, fmt.Errorf("add %s rejected", r.name)
+		}
+	}
+	return r.DynamicUpdateInterfaceClient.AddRRset(ctx, in, opts...)
+}
+
+func TestPTRFailureIsolated(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	backend := env.client.state.backend
+	env.client.state.backend = &ptrRejector{backend, "5.0.42.10.in-addr.arpa."}
+
+	env.run(step{createEvent, headlessService("default", "a")})
+	env.run(step{createEvent, headlessService("default", "b")})
+	env.run(step{createEvent, endpoints("default", "a", []string{"10.42.0.5"})})
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	if err := env.ctl.reconcileService(a); err == nil {
+		t.Errorf("reconcile should fail when ptr can't be pushed")
+	}
+	if n := env.ctl.ptrs.pendingCount(); n != 1 {
+		t.Errorf("1 ptr should be pending but got %d", n)
+	}
+
+	//pending ptr of a doesn't fail b
+	env.run(step{createEvent, endpoints("default", "b", []string{"10.42.0.6"})})
+	if err := env.ctl.reconcileService(types.NamespacedName{Namespace: "default", Name: "b"}); err != nil {
+		t.Errorf("reconcile of other service shouldn't fail:%s", err.Error())
+	}
+
+	env.client.state.backend = backend
+	if err := env.ctl.reconcileService(a); err != nil {
+		t.Errorf("reconcile should succeed after server recovers:%s", err.Error())
+	}
+	if n := env.ctl.ptrs.pendingCount(); n != 0 {
+		t.Errorf("no ptr should be pending but got %d", n)
+	}
+	want := []string{
+		"10-42-0-5.a.default.svc.cluster.local. A 10.42.0.5",
+		"10-42-0-6.b.default.svc.cluster.local. A 10.42.0.6",
+		"5.0.42.10.in-addr.arpa. PTR 10-42-0-5.a.default.svc.cluster.local.",
+		"6.0.42.10.in-addr.arpa. PTR 10-42-0-6.b.default.svc.cluster.local.",
+		"a.default.svc.cluster.local. A 10.42.0.5",
+		"b.default.svc.cluster.local. A 10.42.0.6",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Errorf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+}
+
+// each /16 network of a wide range has its own reverse zone
+func TestReverseZonesOfSplitRange(t *testing.T) {
+	client, err := newVgClient(nil, testClusterDomain, "10.96.0.0/16,10.97.0.0/16", testPodIPRange, testDNSServer, "", "")
+	if err != nil {
+		t.Fatalf("create client failed:%s", err.Error())
+	}
+
+	cases := []struct {
+		name string
+		zone string
+	}{
+		{"1.0.96.10.in-addr.arpa", "96.10.in-addr.arpa."},
+		{"10.0.97.10.in-addr.arpa", "97.10.in-addr.arpa."},
+		//out of range ptr goes to the first zone and is rejected by server
+		{"1.0.98.10.in-addr.arpa", "96.10.in-addr.arpa."},
+	}
+	for _, c := range cases {
+		zone := client.serviceReverseZone(g53.NameFromStringUnsafe(c.name))
+		if zone.String(false) != c.zone {
+			t.Errorf("zone of %s should be %s but get %s", c.name, c.zone, zone.String(false))
+		}
+	}
+
+	var zones []string
+	for _, zone := range client.fixedZones() {
+		zones = append(zones, zone.name.String(false)+" "+zone.template)
+	}
+	want := []string{
+		"96.10.in-addr.arpa. " + ServiceReverseZoneTemplate,
+		"97.10.in-addr.arpa. " + ServiceReverseZoneTemplate,
+		"42.10.in-addr.arpa. " + PodReverseZoneTemplate,
+		testClusterDomain + ". " + ServiceZoneTemplate,
+	}
+	if reflect.DeepEqual(zones, want) == false {
+		t.Errorf("fixed zones:\n%v\nwant:\n%v", zones, want)
+	}
+}
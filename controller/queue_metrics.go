@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+const ServiceQueueName = "vanguard_service"
+
+// queue metrics are kept in memory and served by debug api, only named
+// queues have metrics
+var queueMetrics = &queueMetricsProvider{
+	queues: make(map[string]*QueueMetrics),
+}
+
+// workqueue only takes the first provider, it should be registered before
+// the named queue is created
+func registerQueueMetrics() {
+	workqueue.SetProvider(queueMetrics)
+}
+
+// QueueMetrics is used to size worker pool, durations are in seconds.
+// Workers keep busy with a growing depth means more workers are needed
+type QueueMetrics struct {
+	Depth                   int64   `json:"depth"`
+	Adds                    int64   `json:"adds"`
+	Retries                 int64   `json:"retries"`
+	Latency                 Summary `json:"latency"`
+	WorkDuration            Summary `json:"workDuration"`
+	UnfinishedWorkSeconds   float64 `json:"unfinishedWorkSeconds"`
+	LongestRunningProcessor float64 `json:"longestRunningProcessor"`
+	Workers                 int     `json:"workers"`
+	BusyWorkers             int64   `json:"busyWorkers"`
+}
+
+type Summary struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Max   float64 `json:"max"`
+}
+
+type queueMetricsProvider struct {
+	lock   sync.Mutex
+	queues map[string]*QueueMetrics
+}
+
+func (p *queueMetricsProvider) get(name string) *QueueMetrics {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m, ok := p.queues[name]
+	if ok == false {
+		m = &QueueMetrics{}
+		p.queues[name] = m
+	}
+	return m
+}
+
+// snapshot returns a copy of metrics of the queue
+func (p *queueMetricsProvider) snapshot(name string) QueueMetrics {
+	m := p.get(name)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return QueueMetrics{
+		Depth:                   atomic.LoadInt64(&m.Depth),
+		Adds:                    atomic.LoadInt64(&m.Adds),
+		Retries:                 atomic.LoadInt64(&m.Retries),
+		Latency:                 m.Latency,
+		WorkDuration:            m.WorkDuration,
+		UnfinishedWorkSeconds:   m.UnfinishedWorkSeconds,
+		LongestRunningProcessor: m.LongestRunningProcessor,
+	}
+}
+
+func (p *queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return &gauge{&p.get(name).Depth}
+}
+
+func (p *queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return &gauge{&p.get(name).Adds}
+}
+
+func (p *queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return &gauge{&p.get(name).Retries}
+}
+
+// latency and work duration are observed in microseconds
+func (p *queueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return &summary{p, &p.get(name).Latency, 1e-6}
+}
+
+func (p *queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return &summary{p, &p.get(name).WorkDuration, 1e-6}
+}
+
+func (p *queueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return &settable{p, &p.get(name).UnfinishedWorkSeconds, 1}
+}
+
+func (p *queueMetricsProvider) NewLongestRunningProcessorMicrosecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return &settable{p, &p.get(name).LongestRunningProcessor, 1e-6}
+}
+
+type gauge struct {
+	v *int64
+}
+
+func (g *gauge) Inc() { atomic.AddInt64(g.v, 1) }
+func (g *gauge) Dec() { atomic.AddInt64(g.v, -1) }
+
+type summary struct {
+	p     *queueMetricsProvider
+	s     *Summary
+	scale float64
+}
+
+func (s *summary) Observe(v float64) {
+	v *= s.scale
+	s.p.lock.Lock()
+	defer s.p.lock.Unlock()
+	s.s.Count += 1
+	s.s.Sum += v
+	s.s.Max = math.Max(s.s.Max, v)
+}
+
+type settable struct {
+	p     *queueMetricsProvider
+	v     *float64
+	scale float64
+}
+
+func (s *settable) Set(v float64) {
+	s.p.lock.Lock()
+	defer s.p.lock.Unlock()
+	*s.v = v * s.scale
+}
@@ -0,0 +1,483 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// serviceRecord is a rrset generated for a service, records of a service
+// are published as a whole, keyed by service namespace and name
+type serviceRecord struct {
+	view  string
+	zone  *g53.Name
+	rrset *g53.RRset
+}
+
+func (r serviceRecord) key() string {
+	return r.view + "/" + rrsetKey(r.rrset.Name, r.rrset.Type)
+}
+
+// service and endpoints share the key, events of the same key which
+// haven't been processed are merged by the queue, pending endpoints update
+// is covered since reconcile reads the latest state
+func (c *Controller) enqueueService(namespace, name string) {
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	c.endpoints.cancel(key)
+	c.queue.Add(key)
+}
+
+func (c *Controller) workers() int {
+	if c.opts.Workers < 1 {
+		return 1
+	}
+	return c.opts.Workers
+}
+
+// the queue never hands out a key which is being processed, so services
+// are reconciled concurrently while each one is serialized
+func (c *Controller) runWorker() {
+	for c.processNextKey() {
+	}
+}
+
+func (c *Controller) processNextKey() bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+	atomic.AddInt64(&c.busyWorkers, 1)
+	defer atomic.AddInt64(&c.busyWorkers, -1)
+
+	err := c.reconcileKey(obj)
+	c.setFailed(obj, err != nil)
+	if err != nil {
+		log.Printf("reconcile %s failed and will retry:%s", keyString(obj), err.Error())
+		c.queue.AddRateLimited(obj)
+	} else {
+		c.queue.Forget(obj)
+	}
+	return true
+}
+
+// processQueue handles all the keys in queue and returns, failed keys
+// aren't retried
+func (c *Controller) processQueue() {
+	for c.queue.Len() > 0 {
+		obj, _ := c.queue.Get()
+		if err := c.reconcileKey(obj); err != nil {
+			log.Printf("reconcile %s failed:%s", keyString(obj), err.Error())
+		}
+		c.queue.Forget(obj)
+		c.queue.Done(obj)
+	}
+}
+
+// key of service is namespace and name, other kinds have their own key type
+func (c *Controller) reconcileKey(obj interface{}) error {
+	c.reloadLock.RLock()
+	defer c.reloadLock.RUnlock()
+	switch key := obj.(type) {
+	case types.NamespacedName:
+		return c.reconcileService(key)
+	case ingressKey:
+		return c.reconcileIngress(types.NamespacedName(key))
+	case dnsZoneKey:
+		return c.reconcileDNSZone(string(key))
+	case dnsRecordKey:
+		return c.reconcileDNSRecord(types.NamespacedName(key))
+	case clustersetKey:
+		return c.reconcileClustersetService(types.NamespacedName(key))
+	default:
+		return fmt.Errorf("unknown key %v", obj)
+	}
+}
+
+func keyString(obj interface{}) string {
+	switch key := obj.(type) {
+	case types.NamespacedName:
+		return "service " + key.String()
+	case ingressKey:
+		return "ingress " + types.NamespacedName(key).String()
+	case dnsZoneKey:
+		return "dns zone " + string(key)
+	case dnsRecordKey:
+		return "dns record " + types.NamespacedName(key).String()
+	case clustersetKey:
+		return "clusterset service " + types.NamespacedName(key).String()
+	default:
+		return fmt.Sprintf("%v", obj)
+	}
+}
+
+// reconcileService makes the published records of the service match the
+// service and endpoints in cache, so it's idempotent and doesn't depend
+// on the order of events
+func (c *Controller) reconcileService(key types.NamespacedName) error {
+	var records []serviceRecord
+	var svc corev1.Service
+	selected := false
+	if err := c.cache.Get(context.TODO(), key, &svc); err != nil {
+		if apierrors.IsNotFound(err) == false {
+			return err
+		}
+	} else if selected = c.isServiceSelected(&svc); selected {
+		var ep corev1.Endpoints
+		epp := &ep
+		if err := c.cache.Get(context.TODO(), key, epp); err != nil {
+			if apierrors.IsNotFound(err) == false {
+				return err
+			}
+			epp = nil
+		}
+
+		if records, err = c.serviceRecords(&svc, epp); err != nil {
+			c.reportServiceStatus(&svc, err)
+			return err
+		}
+	}
+
+	if selected == false || isExternalService(&svc) == false {
+		c.externalNames.set(key, nil)
+	}
+
+	//ptr may be shared with other services
+	var forward, ptrs []serviceRecord
+	for _, r := range records {
+		if r.rrset.Type == g53.RR_PTR {
+			ptrs = append(ptrs, r)
+		} else {
+			forward = append(forward, r)
+		}
+	}
+	err := c.publish(key, forward)
+	if ptrErr := c.publishPTRs(key, ptrs); ptrErr != nil && err == nil {
+		err = ptrErr
+	}
+	if selected {
+		c.reportServiceStatus(&svc, err)
+	}
+	return err
+}
+
+// publishError collects the errors of rrsets failed to push
+type publishError struct {
+	kind string
+	errs []error
+}
+
+func (e *publishError) Error() string {
+	return fmt.Sprintf("%d %s failed, last error:%s", len(e.errs), e.kind, e.errs[len(e.errs)-1].Error())
+}
+
+// publish deletes the records which aren't desired first, so cname could
+// replace other records with same name, failed changes are retried in next
+// reconcile
+func (c *Controller) publish(key types.NamespacedName, records []serviceRecord) error {
+	desired := make(map[string]serviceRecord)
+	for _, r := range records {
+		desired[r.key()] = r
+	}
+
+	c.publishedLock.Lock()
+	old := c.published[key]
+	c.publishedLock.Unlock()
+
+	current := make(map[string]serviceRecord)
+	var errs []error
+	for k, r := range old {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+		if err := c.pushRRset(r.view, r.zone, r.rrset, nil); err != nil {
+			errs = append(errs, err)
+			current[k] = r
+		}
+	}
+
+	for k, r := range desired {
+		var oldRRset *g53.RRset
+		o, ok := old[k]
+		if ok {
+			oldRRset = o.rrset
+		}
+		if err := c.pushRRset(r.view, r.zone, oldRRset, r.rrset); err != nil {
+			errs = append(errs, err)
+			if ok {
+				current[k] = o
+			}
+			continue
+		}
+		current[k] = r
+	}
+
+	c.publishedLock.Lock()
+	if len(current) == 0 {
+		delete(c.published, key)
+	} else {
+		c.published[key] = current
+	}
+	c.publishedLock.Unlock()
+	if c.opts.FlattenExternalNames {
+		c.enqueueExternalNameDependents(key, old, current)
+	}
+
+	if len(errs) != 0 {
+		return &publishError{"rrsets", errs}
+	}
+	return nil
+}
+
+// pushRRset changes the published rrset old to new, either of them could be
+// nil. Changed rrsets are updated by rdata so unchanged addresses are kept
+func (c *Controller) pushRRset(view string, zone *g53.Name, old, new *g53.RRset) error {
+	switch {
+	case new == nil && old == nil:
+		return nil
+	case new == nil:
+		return c.client.deleteRRsetInView(view, zone, old.Name, old.Type)
+	case old != nil && isRRsetEqual(old, new):
+		return nil
+	case old != nil && c.client.updateRdataInView(view, zone, old, new) == nil:
+		return nil
+	default:
+		//rrset on server may differ from what we published, replace it
+		return c.client.replaceRRsetInView(view, zone, new)
+	}
+}
+
+// serviceRecords generates all the records of service, ep could be nil
+func (c *Controller) serviceRecords(svc *corev1.Service, ep *corev1.Endpoints) ([]serviceRecord, error) {
+	views, err := c.getViews(svc.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []serviceRecord
+	var externalNameTargets []string
+	for i, scheme := range c.client.namingSchemes() {
+		rrsets, reverseRRsets, podReverseRRsets, err := c.schemeRRsets(scheme, svc, ep)
+		if err != nil {
+			return nil, err
+		}
+		//external name may be flattened to different addresses in each view
+		var viewRRsets map[string][]*g53.RRset
+		if isExternalService(svc) {
+			n, err := scheme.serviceName(svc.Name, svc.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			var targets []string
+			viewRRsets, targets = c.externalNameRRsets(svc, n, views)
+			externalNameTargets = append(externalNameTargets, targets...)
+		}
+		for _, view := range views {
+			for _, rrset := range rrsets {
+				records = addServiceRecord(records, serviceRecord{view, scheme.zone, rrset})
+			}
+			for _, rrset := range viewRRsets[view] {
+				records = addServiceRecord(records, serviceRecord{view, scheme.zone, rrset})
+			}
+		}
+		//ptr records only point to names of the first scheme, and are only
+		//visible in the views of the names
+		if i != 0 {
+			continue
+		}
+		for _, view := range views {
+			for _, rrset := range reverseRRsets {
+				records = addServiceRecord(records, serviceRecord{view, c.client.serviceReverseZone(rrset.Name), rrset})
+			}
+			for _, rrset := range podReverseRRsets {
+				records = addServiceRecord(records, serviceRecord{view, c.client.podReverseZone(rrset.Name), rrset})
+			}
+		}
+	}
+	if isExternalService(svc) {
+		c.externalNames.set(types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}, externalNameTargets)
+	}
+	return records, nil
+}
+
+// schemeRRsets returns rrsets of service with names from the scheme, ptr
+// rrsets of service ip and pod ips are returned separately, rrsets of
+// external name service are generated in each view by externalNameRRsets
+func (c *Controller) schemeRRsets(scheme *namingScheme, svc *corev1.Service, ep *corev1.Endpoints) ([]*g53.RRset, []*g53.RRset, []*g53.RRset, error) {
+	var rrsets, reverseRRsets []*g53.RRset
+	n, err := scheme.serviceName(svc.Name, svc.Namespace)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if isNormalService(svc) {
+		if rdata, err := g53.AFromString(svc.Spec.ClusterIP); err == nil {
+			rrsets = append(rrsets, newRRset(n, g53.RR_A, c.ttl(), rdata))
+			if rn, err := util.ReverseIPName(svc.Spec.ClusterIP); err == nil {
+				reverseRRsets = append(reverseRRsets, newRRset(rn, g53.RR_PTR, c.ttl(), &g53.PTR{Name: n}))
+			}
+		}
+	} else if isHeaderlessService(svc) && ep != nil {
+		//header less service rrset is a list of pods
+		var rdatas []g53.Rdata
+		for _, subset := range ep.Subsets {
+			for _, addr := range subset.Addresses {
+				if rdata, err := g53.AFromString(addr.IP); err == nil {
+					rdatas = append(rdatas, rdata)
+				}
+			}
+		}
+		if len(rdatas) != 0 {
+			rrsets = append(rrsets, newRRset(n, g53.RR_A, c.ttl(), rdatas...))
+		}
+	}
+
+	var podReverseRRsets []*g53.RRset
+	if ep != nil {
+		podRRsets, podPTRs, err := c.podRRsets(scheme, n, svc, ep)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rrsets = append(rrsets, podRRsets...)
+		podReverseRRsets = podPTRs
+	}
+	if c.opts.WatchPods && isHeaderlessService(svc) {
+		podRRsets, err := c.podHostnameRRsets(scheme, svc, rrsets)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rrsets = append(rrsets, podRRsets...)
+	}
+	return rrsets, reverseRRsets, podReverseRRsets, nil
+}
+
+// podRRsets returns a and srv rrsets of pods in service zone and ptr rrsets
+// of pod ips, serviceName is the target of srv records of normal service
+func (c *Controller) podRRsets(scheme *namingScheme, serviceName *g53.Name, svc *corev1.Service, ep *corev1.Endpoints) ([]*g53.RRset, []*g53.RRset, error) {
+	var rrsets, ptrs []*g53.RRset
+	for _, subset := range ep.Subsets {
+		var podNames []*g53.Name
+		var addrs [][]string
+		//pod may has same name when hostname and subdomain is same :(
+		for _, addr := range subset.Addresses {
+			n, err := scheme.endpointsAddrName(&addr, ep.Name, ep.Namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			duplicateName := false
+			duplicateNameIndex := 0
+			for i, n_ := range podNames {
+				if n_.Equals(n) {
+					duplicateNameIndex = i
+					duplicateName = true
+					break
+				}
+			}
+			if duplicateName {
+				addrs[duplicateNameIndex] = append(addrs[duplicateNameIndex], addr.IP)
+			} else {
+				podNames = append(podNames, n)
+				addrs = append(addrs, []string{addr.IP})
+			}
+		}
+
+		for i, n := range podNames {
+			var rdatas []g53.Rdata
+			for _, ip := range addrs[i] {
+				rdata, err := g53.AFromString(ip)
+				if err != nil {
+					continue
+				}
+				rdatas = append(rdatas, rdata)
+				if rn, err := util.ReverseIPName(ip); err == nil {
+					ptrs = append(ptrs, newRRset(rn, g53.RR_PTR, c.ttl(), &g53.PTR{Name: n}))
+				}
+			}
+			if len(rdatas) != 0 {
+				rrsets = append(rrsets, newRRset(n, g53.RR_A, c.ttl(), rdatas...))
+			}
+		}
+
+		for _, port := range subset.Ports {
+			if port.Name == "" {
+				continue
+			}
+
+			n, err := scheme.portName(port.Name, string(port.Protocol), ep.Name, ep.Namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			var rdatas []g53.Rdata
+			if isHeaderlessService(svc) {
+				for _, podName := range podNames {
+					rdatas = append(rdatas, &g53.SRV{
+						Priority: DefaultSRVPriority,
+						Weight:   DefaultSRVWeight,
+						Port:     uint16(port.Port),
+						Target:   podName,
+					})
+				}
+			} else {
+				rdatas = append(rdatas, &g53.SRV{
+					Priority: DefaultSRVPriority,
+					Weight:   DefaultSRVWeight,
+					Port:     uint16(port.Port),
+					Target:   serviceName,
+				})
+			}
+			if len(rdatas) != 0 {
+				rrsets = append(rrsets, newRRset(n, g53.RR_SRV, c.ttl(), rdatas...))
+			}
+		}
+	}
+	return rrsets, ptrs, nil
+}
+
+// rrsets with same name and type from different subsets are merged
+func addServiceRecord(records []serviceRecord, r serviceRecord) []serviceRecord {
+	for _, old := range records {
+		if old.key() == r.key() {
+			for _, rdata := range r.rrset.Rdatas {
+				old.rrset.AddRdata(rdata)
+			}
+			return records
+		}
+	}
+	r.rrset = r.rrset.Clone()
+	return append(records, r)
+}
+
+func newRRset(name *g53.Name, typ g53.RRType, ttl g53.RRTTL, rdatas ...g53.Rdata) *g53.RRset {
+	return &g53.RRset{
+		Name:   name,
+		Type:   typ,
+		Class:  g53.CLASS_IN,
+		Ttl:    ttl,
+		Rdatas: rdatas,
+	}
+}
+
+// compare rdata in text, since cname rdatas in g53 always equal
+func isRRsetEqual(a, b *g53.RRset) bool {
+	if a.IsSameRRset(b) == false || a.Ttl != b.Ttl || len(a.Rdatas) != len(b.Rdatas) {
+		return false
+	}
+
+	as, bs := rdataStrings(a), rdataStrings(b)
+	sort.Strings(as)
+	sort.Strings(bs)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
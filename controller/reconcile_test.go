@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/gok8s/client"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// only the rrsets and rdatas which changed are sent to server
+// deletionRecorder records the records removed by each request, so records
+// deleted and added back in one update are caught
+type deletionRecorder struct {
+	pb.DynamicUpdateInterfaceClient
+	env     *testEnv
+	deleted map[string]struct{}
+}
+
+func (r *deletionRecorder) track(call func() error) error {
+	before := r.env.allRecords()
+	err := call()
+	after := make(map[string]struct{})
+	for _, record := range r.env.allRecords() {
+		after[record] = struct{}{}
+	}
+	for _, record := range before {
+		if _, ok := after[record]; ok == false {
+			r.deleted[record] = struct{}{}
+		}
+	}
+	return err
+}
+
+func (r *deletionRecorder) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (resp *pb.AddRRsetResponse, err error) {
+	r.track(func() error { resp, err = r.DynamicUpdateInterfaceClient.AddRRset(ctx, in, opts...); return err })
+	return
+}
+
+func (r *deletionRecorder) DeleteRRset(ctx context.Context, in *pb.DeleteRRsetRequest, opts ...grpc.CallOption) (resp *pb.DeleteRRsetResponse, err error) {
+	r.track(func() error { resp, err = r.DynamicUpdateInterfaceClient.DeleteRRset(ctx, in, opts...); return err })
+	return
+}
+
+func (r *deletionRecorder) DeleteRdata(ctx context.Context, in *pb.DeleteRdataRequest, opts ...grpc.CallOption) (resp *pb.DeleteRdataResponse, err error) {
+	r.track(func() error { resp, err = r.DynamicUpdateInterfaceClient.DeleteRdata(ctx, in, opts...); return err })
+	return
+}
+
+func (r *deletionRecorder) UpdateRdata(ctx context.Context, in *pb.UpdateRdataRequest, opts ...grpc.CallOption) (resp *pb.UpdateRdataResponse, err error) {
+	r.track(func() error { resp, err = r.DynamicUpdateInterfaceClient.UpdateRdata(ctx, in, opts...); return err })
+	return
+}
+
+func TestEndpointsIncrementalUpdate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	recorder := &deletionRecorder{
+		DynamicUpdateInterfaceClient: env.client.state.backend,
+		env:                          env,
+	}
+	env.client.state.backend = recorder
+
+	env.run(step{createEvent, headlessService("prod", "db")})
+	steps := []struct {
+		ep      *corev1.Endpoints
+		records []string
+	}{
+		{
+			ep: endpoints("prod", "db", []string{"db-0=10.42.2.7", "db-1=10.42.2.8"}, tcpPort("pg", 5432)),
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"8.2.42.10.in-addr.arpa. PTR db-1.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-1.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db-1.db.prod.svc.cluster.local. A 10.42.2.8",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.8",
+			},
+		},
+		{
+			ep: endpoints("prod", "db", []string{"db-0=10.42.2.7", "db-1=10.42.2.9"}, tcpPort("pg", 5432)),
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"9.2.42.10.in-addr.arpa. PTR db-1.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-1.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db-1.db.prod.svc.cluster.local. A 10.42.2.9",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.9",
+			},
+		},
+		{
+			ep: endpoints("prod", "db", []string{"db-0=10.42.2.7"}, tcpPort("pg", 5432)),
+			records: []string{
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-0.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+		{
+			ep: endpoints("prod", "db", []string{"db-0=10.42.2.7", "db-2=10.42.2.10"}, tcpPort("pg", 5432)),
+			records: []string{
+				"10.2.42.10.in-addr.arpa. PTR db-2.db.prod.svc.cluster.local.",
+				"7.2.42.10.in-addr.arpa. PTR db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-0.db.prod.svc.cluster.local.",
+				"_pg._tcp.db.prod.svc.cluster.local. SRV 10 100 5432 db-2.db.prod.svc.cluster.local.",
+				"db-0.db.prod.svc.cluster.local. A 10.42.2.7",
+				"db-2.db.prod.svc.cluster.local. A 10.42.2.10",
+				"db.prod.svc.cluster.local. A 10.42.2.10",
+				"db.prod.svc.cluster.local. A 10.42.2.7",
+			},
+		},
+	}
+
+	var previous []string
+	for i, c := range steps {
+		recorder.deleted = make(map[string]struct{})
+		if i == 0 {
+			env.run(step{createEvent, c.ep})
+		} else {
+			env.run(step{updateEvent, c.ep})
+		}
+		records := env.records()
+		if reflect.DeepEqual(records, c.records) == false {
+			t.Errorf("step %d records mismatch\nwant:\n%s\ngot:\n%s", i, joinLines(c.records), joinLines(records))
+		}
+
+		//records kept by the update shouldn't be deleted on the way
+		for _, record := range previous {
+			if _, ok := recorder.deleted[record]; ok && util.HasString(records, record) {
+				t.Errorf("step %d deleted unchanged record %s", i, record)
+			}
+		}
+		previous = records
+	}
+}
+
+// lockedReader lets the objects in cache change while workers are running
+type lockedReader struct {
+	lock sync.RWMutex
+	r    client.Reader
+}
+
+func (l *lockedReader) set(r client.Reader) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.r = r
+}
+
+func (l *lockedReader) Get(ctx context.Context, key client.ObjectKey, out runtime.Object) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.r.Get(ctx, key, out)
+}
+
+func (l *lockedReader) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.r.List(ctx, opts, list)
+}
+
+// overlapDetector records names updated by concurrent requests, each name
+// belongs to one service, so the same name is only updated by one worker
+type overlapDetector struct {
+	pb.DynamicUpdateInterfaceClient
+
+	lock     sync.Mutex
+	inflight map[string]struct{}
+	overlaps []string
+}
+
+func (d *overlapDetector) enter(names ...string) func() {
+	d.lock.Lock()
+	for _, name := range names {
+		if _, ok := d.inflight[name]; ok {
+			d.overlaps = append(d.overlaps, name)
+		}
+		d.inflight[name] = struct{}{}
+	}
+	d.lock.Unlock()
+	//widen the window of overlapping
+	time.Sleep(time.Millisecond)
+	return func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		for _, name := range names {
+			delete(d.inflight, name)
+		}
+	}
+}
+
+func (d *overlapDetector) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (*pb.AddRRsetResponse, error) {
+	var names []string
+	for _, rrset := range in.Rrsets {
+		names = append(names, rrset.Name)
+	}
+	defer d.enter(names...)()
+	return d.DynamicUpdateInterfaceClient.AddRRset(ctx, in, opts...)
+}
+
+func (d *overlapDetector) DeleteRRset(ctx context.Context, in *pb.DeleteRRsetRequest, opts ...grpc.CallOption) (*pb.DeleteRRsetResponse, error) {
+	var names []string
+	for _, header := range in.Rrsets {
+		names = append(names, header.Name)
+	}
+	defer d.enter(names...)()
+	return d.DynamicUpdateInterfaceClient.DeleteRRset(ctx, in, opts...)
+}
+
+func (d *overlapDetector) DeleteRdata(ctx context.Context, in *pb.DeleteRdataRequest, opts ...grpc.CallOption) (*pb.DeleteRdataResponse, error) {
+	var names []string
+	for _, rrset := range in.Rrsets {
+		names = append(names, rrset.Name)
+	}
+	defer d.enter(names...)()
+	return d.DynamicUpdateInterfaceClient.DeleteRdata(ctx, in, opts...)
+}
+
+func (d *overlapDetector) UpdateRdata(ctx context.Context, in *pb.UpdateRdataRequest, opts ...grpc.CallOption) (*pb.UpdateRdataResponse, error) {
+	defer d.enter(in.NewRrset.Name)()
+	return d.DynamicUpdateInterfaceClient.UpdateRdata(ctx, in, opts...)
+}
+
+// updates of one service interleaved with others are handled in order by
+// several workers, run with -race
+func TestWorkersKeepKeyOrder(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{Workers: 4})
+	defer env.close()
+
+	detector := &overlapDetector{
+		DynamicUpdateInterfaceClient: env.client.state.backend,
+		inflight:                     make(map[string]struct{}),
+	}
+	env.client.state.backend = detector
+
+	services := []string{"a", "b", "c"}
+	for _, name := range services {
+		env.run(step{createEvent, headlessService("default", name)})
+	}
+	//env.run replaces the cache, workers read it through a lock
+	reader := &lockedReader{r: env.ctl.cache}
+	env.ctl.cache = reader
+	env.ctl.startWorkers()
+
+	const updates = 20
+	for i := 0; i < updates; i++ {
+		for j, name := range services {
+			ep := endpoints("default", name, []string{fmt.Sprintf("10.42.%d.%d", j, i+1)})
+			env.objs[objectKey(ep)] = ep
+			var objs []runtime.Object
+			for _, obj := range env.objs {
+				objs = append(objs, obj)
+			}
+			reader.set(newObjectStore(objs))
+			env.ctl.enqueueService("default", name)
+		}
+	}
+
+	//workers drain the queue after it's shut down
+	env.ctl.queue.ShutDown()
+	env.ctl.workerGroup.Wait()
+	if len(detector.overlaps) != 0 {
+		t.Errorf("names shouldn't be updated concurrently:%v", detector.overlaps)
+	}
+	for j, name := range services {
+		n := g53.NameFromStringUnsafe(name + ".default.svc.cluster.local")
+		a := env.server.Store().GetRRset(DefaultView, testClusterDomain, n, g53.RR_A)
+		if want := fmt.Sprintf("10.42.%d.%d", j, updates); a == nil || len(a.Rdatas) != 1 || a.Rdatas[0].String() != want {
+			t.Errorf("%s should point to the last address %s:%v", name, want, a)
+		}
+	}
+}
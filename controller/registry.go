@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+const (
+	OwnerRecordPrefix = "_owner-"
+	OwnerHeritage     = "heritage=vanguard2-controller"
+	OwnerQueryTimeout = 3 * time.Second
+)
+
+// ownerRegistry records the owner of every rrset the controller creates in a
+// txt rrset named _owner-<type>.<name>, rrsets without the owner record or
+// owned by another controller are never modified. Owner records are written
+// in the view of the rrset, and queried from queryServer with the view option
+// so each view has its own owners
+type ownerRegistry struct {
+	ownerID     string
+	queryServer string
+
+	lock  sync.Mutex
+	owned map[string]struct{}
+}
+
+type errNotOwner struct {
+	name *g53.Name
+	typ  g53.RRType
+}
+
+func (e errNotOwner) Error() string {
+	return fmt.Sprintf("rrset %s %s isn't owned by this controller", e.name.String(false), e.typ.String())
+}
+
+func newOwnerRegistry(ownerID, queryServer string) *ownerRegistry {
+	return &ownerRegistry{
+		ownerID:     ownerID,
+		queryServer: queryServer,
+		owned:       make(map[string]struct{}),
+	}
+}
+
+func (r *ownerRegistry) ownerName(name *g53.Name, typ g53.RRType) *g53.Name {
+	prefix := g53.NameFromStringUnsafe(OwnerRecordPrefix + strings.ToLower(typ.String()))
+	n, _ := prefix.Concat(name)
+	return n
+}
+
+func (r *ownerRegistry) ownerRRset(name *g53.Name, typ g53.RRType) *g53.RRset {
+	return &g53.RRset{
+		Name:   r.ownerName(name, typ),
+		Type:   g53.RR_TXT,
+		Class:  g53.CLASS_IN,
+		Ttl:    DefaultTTL,
+		Rdatas: []g53.Rdata{&g53.Txt{Data: []string{r.ownerValue()}}},
+	}
+}
+
+func (r *ownerRegistry) ownerValue() string {
+	return OwnerHeritage + ",owner=" + r.ownerID
+}
+
+func (r *ownerRegistry) isKnownOwned(view string, name *g53.Name, typ g53.RRType) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, ok := r.owned[view+"/"+rrsetKey(name, typ)]
+	return ok
+}
+
+func (r *ownerRegistry) setOwned(view string, name *g53.Name, typ g53.RRType, owned bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if owned {
+		r.owned[view+"/"+rrsetKey(name, typ)] = struct{}{}
+	} else {
+		delete(r.owned, view+"/"+rrsetKey(name, typ))
+	}
+}
+
+// check whether the rrset in view could be modified by this controller, the
+// rrset which doesn't exist could be claimed
+func (r *ownerRegistry) checkOwner(view string, name *g53.Name, typ g53.RRType) (owned bool, exists bool, err error) {
+	if r.isKnownOwned(view, name, typ) {
+		return true, true, nil
+	}
+
+	owner, err := util.QueryRRset(r.queryServer, view, r.ownerName(name, typ), g53.RR_TXT, OwnerQueryTimeout)
+	if err != nil {
+		return false, false, err
+	}
+	if owner != nil {
+		if r.isOwnedBy(owner) {
+			r.setOwned(view, name, typ, true)
+			return true, true, nil
+		}
+		return false, true, nil
+	}
+
+	rrset, err := util.QueryRRset(r.queryServer, view, name, typ, OwnerQueryTimeout)
+	if err != nil {
+		return false, false, err
+	}
+	return false, rrset != nil, nil
+}
+
+// owner record may be shared with other writers, it's ours if any rdata
+// has our owner value
+func (r *ownerRegistry) isOwnedBy(owner *g53.RRset) bool {
+	for _, rdata := range owner.Rdatas {
+		if txt, ok := rdata.(*g53.Txt); ok && strings.Join(txt.Data, "") == r.ownerValue() {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerTarget returns the name and type of the rrset which owner record
+// belongs to, ok is false if name isn't an owner name
+func ownerTarget(owner *g53.Name) (name *g53.Name, typ g53.RRType, ok bool) {
+	label := strings.SplitN(owner.String(false), ".", 2)[0]
+	if strings.HasPrefix(label, OwnerRecordPrefix) == false {
+		return nil, typ, false
+	}
+	typ, err := g53.TypeFromString(strings.TrimPrefix(label, OwnerRecordPrefix))
+	if err != nil {
+		return nil, typ, false
+	}
+	name, err = owner.StripLeft(1)
+	if err != nil {
+		return nil, typ, false
+	}
+	return name, typ, true
+}
+
+func rrsetKey(name *g53.Name, typ g53.RRType) string {
+	return name.String(false) + "/" + typ.String()
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/zdnscloud/g53"
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/vanguard2-controller/crd"
+)
+
+func (c *Controller) ttl() g53.RRTTL {
+	return ttlOrDefault(c.opts.TTL)
+}
+
+// Reload applies opts and replaces vanguard2 client if client isn't nil,
+// all the records are generated again. Client shouldn't be initialized, its
+// zones are initialized when the reload lock is held, zones of the old client
+// on the same server with the same content are reused, others are deleted
+// unless they are shared with other writers, in which case only service
+// records in them are withdrawn. Options about watches, views and workers
+// can't be changed without restart, they are kept. Reload fails after
+// Shutdown
+func (c *Controller) Reload(client *VgClient, opts Options) error {
+	var ingressTarget *g53.Name
+	if opts.IngressTarget != "" {
+		target, err := g53.NameFromString(opts.IngressTarget)
+		if err != nil {
+			return err
+		}
+		ingressTarget = target
+	}
+	scope, err := newServiceScope(opts)
+	if err != nil {
+		return err
+	}
+
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	//client would be swapped in after Shutdown closes the current one
+	select {
+	case <-c.stopCh:
+		return fmt.Errorf("controller is shut down")
+	default:
+	}
+
+	opts = c.keepRestartOptions(opts)
+	replaced := client != nil && client != c.client
+	if replaced {
+		reused, err := client.initZonesFrom(c.client)
+		if err != nil {
+			return err
+		}
+		c.retireClient(client, reused)
+		c.client = client
+		c.forgetZonesExcept(reused)
+	}
+	c.ptrs.setCanonical(opts.CanonicalPTR)
+	c.opts = opts
+	c.ingressTarget = ingressTarget
+	c.scope = scope
+	return c.resync(replaced)
+}
+
+func (c *Controller) keepRestartOptions(opts Options) Options {
+	keep := func(name string, old, new interface{}, restore func()) {
+		if reflect.DeepEqual(old, new) == false {
+			log.Printf("%s can't be changed without restart, keep %v", name, old)
+			restore()
+		}
+	}
+	keep("watchIngress", c.opts.WatchIngress, opts.WatchIngress, func() { opts.WatchIngress = c.opts.WatchIngress })
+	keep("watchDNSResource", c.opts.WatchDNSResource, opts.WatchDNSResource, func() { opts.WatchDNSResource = c.opts.WatchDNSResource })
+	keep("watchPods", c.opts.WatchPods, opts.WatchPods, func() { opts.WatchPods = c.opts.WatchPods })
+	keep("viewIsolation", c.opts.ViewIsolation, opts.ViewIsolation, func() { opts.ViewIsolation = c.opts.ViewIsolation })
+	keep("viewLabel", c.opts.ViewLabel, opts.ViewLabel, func() { opts.ViewLabel = c.opts.ViewLabel })
+	keep("sharedNamespaces", c.opts.SharedNamespaces, opts.SharedNamespaces, func() { opts.SharedNamespaces = c.opts.SharedNamespaces })
+	keep("workers", c.opts.Workers, opts.Workers, func() { opts.Workers = c.opts.Workers })
+	keep("endpointsWindow", c.opts.EndpointsWindow, opts.EndpointsWindow, func() { opts.EndpointsWindow = c.opts.EndpointsWindow })
+	keep("endpointsMaxWait", c.opts.EndpointsMaxWait, opts.EndpointsMaxWait, func() { opts.EndpointsMaxWait = c.opts.EndpointsMaxWait })
+	return opts
+}
+
+// retireClient cleans what current client published out of the zones
+// reused by client before it's replaced
+func (c *Controller) retireClient(client *VgClient, reused map[string]bool) {
+	old := c.client
+	if old.registry == nil {
+		old.deleteZonesExcept(client)
+	} else {
+		log.Printf("zones are shared, withdraw records out of reused zones")
+		c.publishedLock.Lock()
+		published := make(map[types.NamespacedName][]serviceRecord)
+		for key, records := range c.published {
+			for _, r := range records {
+				published[key] = append(published[key], r)
+			}
+		}
+		c.publishedLock.Unlock()
+		for key, records := range published {
+			if err := c.publish(key, recordsInZones(records, reused)); err != nil {
+				log.Printf("withdraw records of service %s failed:%s", key.String(), err.Error())
+			}
+		}
+		for _, key := range c.ptrs.owners() {
+			if err := c.publishPTRs(key, recordsInZones(c.ptrs.records(key), reused)); err != nil {
+				log.Printf("withdraw ptr records of service %s failed:%s", key.String(), err.Error())
+			}
+		}
+		for _, key := range c.ingresses.owners() {
+			if err := c.publishShared(c.ingresses, key, recordsInZones(c.ingresses.records(key), reused), "ingress rrsets"); err != nil {
+				log.Printf("withdraw records of ingress %s failed:%s", key.String(), err.Error())
+			}
+		}
+		for _, key := range c.dnsRecords.owners() {
+			if err := c.publishShared(c.dnsRecords, key, recordsInZones(c.dnsRecords.records(key), reused), "dns records"); err != nil {
+				log.Printf("withdraw dns record %s failed:%s", key.String(), err.Error())
+			}
+		}
+		for _, key := range c.clustersetRecords.owners() {
+			if err := c.publishShared(c.clustersetRecords, key, recordsInZones(c.clustersetRecords.records(key), reused), "clusterset rrsets"); err != nil {
+				log.Printf("withdraw records of clusterset service %s failed:%s", key.String(), err.Error())
+			}
+		}
+	}
+
+	if old.conn != client.conn {
+		old.Close()
+	}
+}
+
+// forgetZonesExcept drops the published records out of zones, since they
+// are deleted or withdrawn with the old client
+func (c *Controller) forgetZonesExcept(zones map[string]bool) {
+	c.publishedLock.Lock()
+	for key, records := range c.published {
+		for k, r := range records {
+			if zones[r.view+"/"+r.zone.String(false)] == false {
+				delete(records, k)
+			}
+		}
+		if len(records) == 0 {
+			delete(c.published, key)
+		}
+	}
+	c.publishedLock.Unlock()
+	c.ptrs.forgetZonesExcept(zones)
+	c.ingresses.forgetZonesExcept(zones)
+	c.dnsRecords.forgetZonesExcept(zones)
+	c.clustersetRecords.forgetZonesExcept(zones)
+}
+
+// zones are in format view/zone
+func recordsInZones(records []serviceRecord, zones map[string]bool) []serviceRecord {
+	var result []serviceRecord
+	for _, r := range records {
+		if zones[r.view+"/"+r.zone.String(false)] {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// resync generates records of all the objects in cache again, custom zones
+// are only created for new client
+func (c *Controller) resync(replaced bool) error {
+	if c.opts.WatchDNSResource && replaced {
+		var zones crd.DNSZoneList
+		if err := c.cache.List(context.TODO(), nil, &zones); err != nil {
+			return err
+		}
+		for _, zone := range zones.Items {
+			c.queue.Add(dnsZoneKey(zone.Name))
+		}
+	}
+
+	var services corev1.ServiceList
+	if err := c.cache.List(context.TODO(), nil, &services); err != nil {
+		return err
+	}
+	for _, svc := range services.Items {
+		c.enqueueService(svc.Namespace, svc.Name)
+	}
+
+	if c.opts.WatchIngress {
+		var ingresses extv1beta1.IngressList
+		if err := c.cache.List(context.TODO(), nil, &ingresses); err != nil {
+			return err
+		}
+		for _, ing := range ingresses.Items {
+			c.enqueueIngress(ing.Namespace, ing.Name)
+		}
+	}
+
+	if c.opts.WatchDNSResource && replaced {
+		var records crd.DNSRecordList
+		if err := c.cache.List(context.TODO(), nil, &records); err != nil {
+			return err
+		}
+		for _, record := range records.Items {
+			c.queue.Add(dnsRecordKey{Namespace: record.Namespace, Name: record.Name})
+		}
+	}
+	return c.enqueueClustersetServices()
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+func TestReload(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.run(step{createEvent, clusterIPService("default", "web", "10.43.0.20")})
+	env.run(step{createEvent, clusterIPService("test", "api", "10.43.0.21")})
+
+	if err := env.ctl.Reload(nil, Options{TTL: 60, ExcludeNamespaces: []string{"test"}}); err != nil {
+		t.Fatalf("reload failed:%s", err.Error())
+	}
+	env.ctl.processQueue()
+	want := []string{
+		"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+		"web.default.svc.cluster.local. A 10.43.0.20",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records after reload mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+	rrsets, err := env.server.Store().RRsets(DefaultView, testClusterDomain)
+	if err != nil {
+		t.Fatalf("get rrsets failed:%s", err.Error())
+	}
+	for _, rrset := range rrsets {
+		if rrset.Name.String(false) == "web.default.svc.cluster.local." && rrset.Ttl != 60 {
+			t.Errorf("ttl should be changed to 60 but got %d", rrset.Ttl)
+		}
+	}
+
+	client, err := DialVgClient(env.addr, "cluster.test", testServiceIPRange, testPodIPRange, testDNSServer, "", "")
+	if err != nil {
+		t.Fatalf("create client failed:%s", err.Error())
+	}
+	if err := env.ctl.Reload(client, Options{}); err != nil {
+		t.Fatalf("reload with new client failed:%s", err.Error())
+	}
+	env.client = client
+	env.ctl.processQueue()
+	if zones := env.server.Store().Zones(DefaultView); util.HasString(zones, testClusterDomain+".") {
+		t.Errorf("old zone %s should be deleted but got %v", testClusterDomain, zones)
+	}
+	var names []string
+	for _, r := range env.allRecords() {
+		if strings.HasPrefix(r, "web.default.") || strings.HasPrefix(r, "api.test.") {
+			names = append(names, r)
+		}
+	}
+	want = []string{
+		"api.test.svc.cluster.test. A 10.43.0.21",
+		"web.default.svc.cluster.test. A 10.43.0.20",
+	}
+	if reflect.DeepEqual(names, want) == false {
+		t.Fatalf("records with new zone mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(names))
+	}
+}
+
+func TestReloadReusesZones(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	env.run(step{createEvent, clusterIPService("default", "web", "10.43.0.20")})
+	published := []string{
+		"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+		"web.default.svc.cluster.local. A 10.43.0.20",
+	}
+
+	client, err := DialVgClient(env.addr, testClusterDomain, testServiceIPRange, testPodIPRange, testDNSServer, "", "")
+	if err != nil {
+		t.Fatalf("create client failed:%s", err.Error())
+	}
+	if err := client.SetClusterDomainAliases([]string{"cluster.example"}); err != nil {
+		t.Fatalf("set aliases failed:%s", err.Error())
+	}
+	if zones := env.server.Store().Zones(DefaultView); util.HasString(zones, "cluster.example.") {
+		t.Errorf("zone shouldn't be created before reload")
+	}
+
+	if err := env.ctl.Reload(client, Options{}); err != nil {
+		t.Fatalf("reload with new client failed:%s", err.Error())
+	}
+	env.client = client
+	webRecords := func() []string {
+		var records []string
+		for _, r := range env.records() {
+			if strings.HasPrefix(r, "web.default.") || strings.HasSuffix(r, "PTR web.default.svc.cluster.local.") {
+				records = append(records, r)
+			}
+		}
+		return records
+	}
+	if got := webRecords(); reflect.DeepEqual(got, published) == false {
+		t.Errorf("records in unchanged zones should be kept\nwant:\n%s\ngot:\n%s", joinLines(published), joinLines(got))
+	}
+
+	env.ctl.processQueue()
+	want := []string{
+		"20.0.43.10.in-addr.arpa. PTR web.default.svc.cluster.local.",
+		"web.default.svc.cluster.example. A 10.43.0.20",
+		"web.default.svc.cluster.local. A 10.43.0.20",
+	}
+	if got := webRecords(); reflect.DeepEqual(got, want) == false {
+		t.Errorf("records with alias mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/gok8s/client"
+
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// service with this annotation set to true has no records
+const ServiceIgnoreAnnotation = "vanguard2.zdns.cn/ignore"
+
+// serviceScope decides which services are published, nil selector selects
+// everything
+type serviceScope struct {
+	include           []string
+	exclude           []string
+	namespaceSelector labels.Selector
+	serviceSelector   labels.Selector
+}
+
+func newServiceScope(opts Options) (*serviceScope, error) {
+	scope := &serviceScope{
+		include: opts.IncludeNamespaces,
+		exclude: opts.ExcludeNamespaces,
+	}
+	if opts.NamespaceSelector != "" {
+		selector, err := labels.Parse(opts.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		scope.namespaceSelector = selector
+	}
+	if opts.ServiceSelector != "" {
+		selector, err := labels.Parse(opts.ServiceSelector)
+		if err != nil {
+			return nil, err
+		}
+		scope.serviceSelector = selector
+	}
+	return scope, nil
+}
+
+func (c *Controller) isServiceSelected(svc *corev1.Service) bool {
+	if svc.Annotations[ServiceIgnoreAnnotation] == "true" {
+		return false
+	}
+	scope := c.scope
+	if len(scope.include) != 0 && util.HasString(scope.include, svc.Namespace) == false {
+		return false
+	}
+	if util.HasString(scope.exclude, svc.Namespace) {
+		return false
+	}
+	if scope.serviceSelector != nil && scope.serviceSelector.Matches(labels.Set(svc.Labels)) == false {
+		return false
+	}
+	if scope.namespaceSelector != nil {
+		var ns corev1.Namespace
+		if err := c.cache.Get(context.TODO(), types.NamespacedName{Name: svc.Namespace}, &ns); err != nil {
+			return false
+		}
+		return scope.namespaceSelector.Matches(labels.Set(ns.Labels))
+	}
+	return true
+}
+
+// labels of namespace decide whether and in which view its services are
+// published
+func (c *Controller) handleNamespaceUpdate(old, new *corev1.Namespace) {
+	if reflect.DeepEqual(old.Labels, new.Labels) {
+		return
+	}
+	if c.scope.namespaceSelector == nil && (c.viewIsolation == nil || c.viewIsolation.labelKey == "") {
+		return
+	}
+
+	var services corev1.ServiceList
+	if err := c.cache.List(context.TODO(), &client.ListOptions{Namespace: new.Name}, &services); err != nil {
+		log.Printf("list services in namespace %s failed:%s", new.Name, err.Error())
+		return
+	}
+	for _, svc := range services.Items {
+		c.enqueueService(svc.Namespace, svc.Name)
+	}
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}
+}
+
+func TestServiceScope(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{
+		NamespaceSelector: "dns=enabled",
+		ServiceSelector:   "tier!=internal",
+	})
+	defer env.close()
+
+	web := clusterIPService("prod", "web", "10.43.0.20")
+	internal := clusterIPService("prod", "cache", "10.43.0.21")
+	internal.Labels = map[string]string{"tier": "internal"}
+	ignored := clusterIPService("prod", "db", "10.43.0.22")
+	ignored.Annotations = map[string]string{ServiceIgnoreAnnotation: "true"}
+	env.run(step{createEvent, namespace("prod", map[string]string{"dns": "enabled"})})
+	env.run(step{createEvent, web})
+	env.run(step{createEvent, internal})
+	env.run(step{createEvent, ignored})
+	want := []string{
+		"20.0.43.10.in-addr.arpa. PTR web.prod.svc.cluster.local.",
+		"web.prod.svc.cluster.local. A 10.43.0.20",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Fatalf("records mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+
+	env.run(step{updateEvent, namespace("prod", nil)})
+	if got := env.records(); len(got) != 0 {
+		t.Fatalf("records should be removed with namespace out of scope but got\n%s", joinLines(got))
+	}
+}
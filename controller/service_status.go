@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	ServiceDNSNamesAnnotation     = "vanguard2.zdns.cn/dns-names"
+	ServiceDNSNameCountAnnotation = "vanguard2.zdns.cn/dns-name-count"
+	ServiceSyncTimeAnnotation     = "vanguard2.zdns.cn/last-sync-time"
+	ServiceSyncResultAnnotation   = "vanguard2.zdns.cn/last-sync-result"
+	SyncResultOK                  = "ok"
+
+	EventReasonSynced              = "DNSSynced"
+	EventReasonSyncFailed          = "DNSSyncFailed"
+	EventReasonNameConflict        = "DNSNameConflict"
+	EventReasonInvalidExternalName = "InvalidExternalName"
+
+	// names of headless service with many pods are truncated
+	maxAnnotatedNames = 20
+
+	// sync time of unchanged service is refreshed at most once in the
+	// interval, so resync doesn't patch every service
+	SyncTimeAnnotateInterval = 5 * time.Minute
+)
+
+var serviceStatusAnnotations = []string{
+	ServiceDNSNamesAnnotation,
+	ServiceDNSNameCountAnnotation,
+	ServiceSyncTimeAnnotation,
+	ServiceSyncResultAnnotation,
+}
+
+// reportServiceStatus annotates service with its published names, sync
+// result and sync time. Events are only recorded when names or result change,
+// sync time of unchanged service is refreshed every SyncTimeAnnotateInterval.
+// Names of headless service follow its pods, the names of service itself are
+// annotated before pod names, and the count of all names is annotated
+func (c *Controller) reportServiceStatus(svc *corev1.Service, err error) {
+	names := c.publishedNames(types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name})
+	var count string
+	if isHeaderlessService(svc) {
+		count = strconv.Itoa(len(names))
+		names = serviceNamesFirst(names)
+	}
+	annotatedNames := joinNames(names)
+	result := SyncResultOK
+	if err != nil {
+		result = err.Error()
+	}
+	now := time.Now()
+	changed := svc.Annotations[ServiceDNSNamesAnnotation] != annotatedNames ||
+		svc.Annotations[ServiceDNSNameCountAnnotation] != count ||
+		svc.Annotations[ServiceSyncResultAnnotation] != result
+	if changed {
+		c.recordSyncEvent(svc, err, annotatedNames, count)
+	} else if isSyncTimeFresh(svc, now) {
+		return
+	}
+
+	//offline controller has no k8s client
+	if c.k8sClient == nil {
+		return
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				ServiceDNSNamesAnnotation:     annotationValue(annotatedNames),
+				ServiceDNSNameCountAnnotation: annotationValue(count),
+				ServiceSyncTimeAnnotation:     now.UTC().Format(time.RFC3339),
+				ServiceSyncResultAnnotation:   result,
+			},
+		},
+	})
+	if err := c.k8sClient.Patch(context.TODO(), svc, types.MergePatchType, patch); err != nil {
+		log.Printf("annotate service %s/%s failed:%s", svc.Namespace, svc.Name, err.Error())
+	}
+}
+
+func (c *Controller) recordSyncEvent(svc *corev1.Service, err error, annotatedNames, count string) {
+	if err == nil {
+		message := "no records published"
+		if count != "" {
+			message = "published " + count + " names"
+		} else if annotatedNames != "" {
+			message = "published " + annotatedNames
+		}
+		c.recordEvent(svc, corev1.EventTypeNormal, EventReasonSynced, message)
+	} else if conflicts := nameConflicts(err); len(conflicts) != 0 {
+		for _, conflict := range conflicts {
+			c.recordEvent(svc, corev1.EventTypeWarning, EventReasonNameConflict, conflict.Error())
+		}
+	} else {
+		c.recordEvent(svc, corev1.EventTypeWarning, EventReasonSyncFailed, err.Error())
+	}
+}
+
+// sync time isn't refreshed if it was annotated within the interval
+func isSyncTimeFresh(svc *corev1.Service, now time.Time) bool {
+	synced, err := time.Parse(time.RFC3339, svc.Annotations[ServiceSyncTimeAnnotation])
+	return err == nil && now.Sub(synced) < SyncTimeAnnotateInterval
+}
+
+// empty value is removed from annotations by merge patch
+func annotationValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// publishedNames returns sorted names of forward records in all views
+func (c *Controller) publishedNames(key types.NamespacedName) []string {
+	c.publishedLock.Lock()
+	unique := make(map[string]struct{})
+	for _, r := range c.published[key] {
+		unique[r.rrset.Name.String(false)] = struct{}{}
+	}
+	c.publishedLock.Unlock()
+
+	names := make([]string, 0, len(unique))
+	for name := range unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceNamesFirst moves the names which aren't under any other name, like
+// the names of headless service itself, before the names of its pods and srv
+// records, so they are kept when names are truncated
+func serviceNamesFirst(names []string) []string {
+	isServiceName := func(name string) bool {
+		for _, parent := range names {
+			if parent != name && strings.HasSuffix(name, "."+parent) {
+				return false
+			}
+		}
+		return true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for _, name := range names {
+		if isServiceName(name) {
+			sorted = append(sorted, name)
+		}
+	}
+	for _, name := range names {
+		if isServiceName(name) == false {
+			sorted = append(sorted, name)
+		}
+	}
+	return sorted
+}
+
+func joinNames(names []string) string {
+	if len(names) > maxAnnotatedNames {
+		more := len(names) - maxAnnotatedNames
+		names = append(names[:maxAnnotatedNames], fmt.Sprintf("and %d more", more))
+	}
+	return strings.Join(names, ",")
+}
+
+func nameConflicts(err error) []errNotOwner {
+	var conflicts []errNotOwner
+	if e, ok := err.(*publishError); ok {
+		for _, err := range e.errs {
+			if conflict, ok := err.(errNotOwner); ok {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	return conflicts
+}
+
+// changes of status annotations written by us don't need reconcile
+func isServiceStatusOnlyChanged(old, new *corev1.Service) bool {
+	if reflect.DeepEqual(old.Spec, new.Spec) == false ||
+		reflect.DeepEqual(old.Labels, new.Labels) == false {
+		return false
+	}
+	return reflect.DeepEqual(withoutStatusAnnotations(old.Annotations), withoutStatusAnnotations(new.Annotations))
+}
+
+func withoutStatusAnnotations(annotations map[string]string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range annotations {
+		result[k] = v
+	}
+	for _, k := range serviceStatusAnnotations {
+		delete(result, k)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestServiceEvents(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.close()
+	var events []string
+	env.ctl.events = newEventRecorder(func(e *corev1.Event) error {
+		events = append(events, formatEvent(e))
+		return nil
+	})
+
+	env.run(step{createEvent, clusterIPService("default", "web", "10.43.0.20")})
+	env.run(step{createEvent, externalNameService("default", "ext", "bad..name")})
+	env.server.Stop()
+	env.run(step{createEvent, clusterIPService("default", "api", "10.43.0.21")})
+
+	want := []string{
+		"Normal default/web DNSSynced published web.default.svc.cluster.local.",
+		"Warning default/ext InvalidExternalName external name bad..name is invalid",
+		"Normal default/ext DNSSynced no records published",
+		"Warning default/api DNSSyncFailed",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events mismatch\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(events))
+	}
+	for i := range want {
+		if strings.HasPrefix(events[i], want[i]) == false {
+			t.Errorf("event %d should start with %q but got %q", i, want[i], events[i])
+		}
+	}
+}
+
+// names of headless service itself survive the truncation of pod names
+func TestHeadlessServiceNames(t *testing.T) {
+	names := []string{"_http._tcp.db.default.svc.cluster.local."}
+	for i := 0; i < maxAnnotatedNames; i++ {
+		names = append(names, fmt.Sprintf("10-42-0-%d.db.default.svc.cluster.local.", i))
+	}
+	names = append(names, "db.default.svc.cluster.local.")
+
+	annotated := strings.Split(joinNames(serviceNamesFirst(names)), ",")
+	if annotated[0] != "db.default.svc.cluster.local." {
+		t.Errorf("service name should be annotated first:%v", annotated)
+	}
+	if len(annotated) != maxAnnotatedNames+1 || annotated[maxAnnotatedNames] != "and 2 more" {
+		t.Errorf("names should be truncated:%v", annotated)
+	}
+}
+
+func TestSyncTimeFresh(t *testing.T) {
+	now := time.Now()
+	svc := clusterIPService("default", "web", "10.43.0.20")
+	if isSyncTimeFresh(svc, now) {
+		t.Errorf("service never synced shouldn't be fresh")
+	}
+	svc.Annotations = map[string]string{ServiceSyncTimeAnnotation: now.Add(-time.Minute).UTC().Format(time.RFC3339)}
+	if isSyncTimeFresh(svc, now) == false {
+		t.Errorf("sync time within interval should be fresh")
+	}
+	if isSyncTimeFresh(svc, now.Add(SyncTimeAnnotateInterval)) {
+		t.Errorf("sync time older than interval should be refreshed")
+	}
+}
+
+func formatEvent(e *corev1.Event) string {
+	return fmt.Sprintf("%s %s/%s %s %s", e.Type, e.InvolvedObject.Namespace, e.InvolvedObject.Name, e.Reason, e.Message)
+}
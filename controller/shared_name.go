@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/zdnscloud/g53"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// nameRegistry tracks the objects generating records of a shared name, like
+// an ingress host used by several ingresses. Records of the name are merged
+// from all of its owners, and deleted after the last owner goes away. Names
+// are pushed outside the registry lock, pushes of one name are serialized
+type nameRegistry struct {
+	// merge returns the records of a name from the rrsets of its owners
+	merge func(owners map[types.NamespacedName][]*g53.RRset) []*g53.RRset
+
+	lock  sync.Mutex
+	names map[string]*sharedName
+	owned map[types.NamespacedName][]string
+}
+
+type sharedName struct {
+	pushLock  sync.Mutex
+	view      string
+	zone      *g53.Name
+	owners    map[types.NamespacedName][]*g53.RRset
+	published []*g53.RRset
+	failed    bool
+}
+
+func newNameRegistry(merge func(map[types.NamespacedName][]*g53.RRset) []*g53.RRset) *nameRegistry {
+	return &nameRegistry{
+		merge: merge,
+		names: make(map[string]*sharedName),
+		owned: make(map[types.NamespacedName][]string),
+	}
+}
+
+func (r *nameRegistry) owners() []types.NamespacedName {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	owners := make([]types.NamespacedName, 0, len(r.owned))
+	for owner := range r.owned {
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// pendingCount returns the number of names failed to push
+func (r *nameRegistry) pendingCount() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := 0
+	for _, p := range r.names {
+		if p.failed {
+			n += 1
+		}
+	}
+	return n
+}
+
+// setOwner replaces the records of owner and returns the names to push,
+// names released by owner are included
+func (r *nameRegistry) setOwner(owner types.NamespacedName, records []serviceRecord) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	affected := make(map[string]struct{})
+	for _, k := range r.owned[owner] {
+		if p, ok := r.names[k]; ok {
+			delete(p.owners, owner)
+		}
+		affected[k] = struct{}{}
+	}
+	for _, record := range records {
+		k := record.view + "/" + record.rrset.Name.String(false)
+		p, ok := r.names[k]
+		if ok == false {
+			p = &sharedName{
+				view:   record.view,
+				zone:   record.zone,
+				owners: make(map[types.NamespacedName][]*g53.RRset),
+			}
+			r.names[k] = p
+		}
+		p.owners[owner] = append(p.owners[owner], record.rrset)
+		affected[k] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(affected))
+	for k := range affected {
+		keys = append(keys, k)
+	}
+	r.owned[owner] = keys
+	return keys
+}
+
+// releaseSynced forgets the names released by owner once they are pushed,
+// names failed to push are kept so owner retries them
+func (r *nameRegistry) releaseSynced(owner types.NamespacedName) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var keys []string
+	for _, k := range r.owned[owner] {
+		if p, ok := r.names[k]; ok {
+			if _, ok := p.owners[owner]; ok || p.failed {
+				keys = append(keys, k)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		delete(r.owned, owner)
+	} else {
+		r.owned[owner] = keys
+	}
+}
+
+// records returns the records owner generates
+func (r *nameRegistry) records(owner types.NamespacedName) []serviceRecord {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var records []serviceRecord
+	for _, k := range r.owned[owner] {
+		if p, ok := r.names[k]; ok {
+			for _, rrset := range p.owners[owner] {
+				records = append(records, serviceRecord{p.view, p.zone, rrset})
+			}
+		}
+	}
+	return records
+}
+
+// typeOwners returns the owners generating rrset of typ for name in view,
+// in namespace/name order
+func (r *nameRegistry) typeOwners(view string, name *g53.Name, typ g53.RRType) []types.NamespacedName {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	p, ok := r.names[view+"/"+name.String(false)]
+	if ok == false {
+		return nil
+	}
+	var owners []types.NamespacedName
+	for _, owner := range sortedOwners(p.owners) {
+		if findRRset(p.owners[owner], typ) != nil {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+func sortedOwners(owners map[types.NamespacedName][]*g53.RRset) []types.NamespacedName {
+	sorted := make([]types.NamespacedName, 0, len(owners))
+	for owner := range owners {
+		sorted = append(sorted, owner)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return sorted
+}
+
+// forgetZonesExcept drops the names out of the kept zones, which are in
+// format view/zone, without pushing
+func (r *nameRegistry) forgetZonesExcept(zones map[string]bool) {
+	r.forget(func(p *sharedName) bool {
+		return zones[p.view+"/"+p.zone.String(false)] == false
+	})
+}
+
+// forgetZone drops the names in the zone of view without pushing
+func (r *nameRegistry) forgetZone(view string, zone *g53.Name) {
+	r.forget(func(p *sharedName) bool {
+		return p.view == view && p.zone.Equals(zone)
+	})
+}
+
+func (r *nameRegistry) forget(drop func(*sharedName) bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for k, p := range r.names {
+		if drop(p) {
+			delete(r.names, k)
+		}
+	}
+	for owner, keys := range r.owned {
+		var kept []string
+		for _, k := range keys {
+			if _, ok := r.names[k]; ok {
+				kept = append(kept, k)
+			}
+		}
+		if len(kept) == 0 {
+			delete(r.owned, owner)
+		} else {
+			r.owned[owner] = kept
+		}
+	}
+}
+
+// publishShared replaces the records of owner in registry, only errors of
+// the names owner generates or releases are returned
+func (c *Controller) publishShared(r *nameRegistry, owner types.NamespacedName, records []serviceRecord, kind string) error {
+	var errs []error
+	for _, k := range r.setOwner(owner, records) {
+		errs = append(errs, c.pushSharedName(r, k)...)
+	}
+	r.releaseSynced(owner)
+
+	if len(errs) != 0 {
+		return &publishError{kind, errs}
+	}
+	return nil
+}
+
+// desired records are computed with the latest owners when the push lock
+// is held, so concurrent owners of a name can't push stale records
+func (c *Controller) pushSharedName(r *nameRegistry, k string) []error {
+	r.lock.Lock()
+	p, ok := r.names[k]
+	r.lock.Unlock()
+	if ok == false {
+		return nil
+	}
+
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	r.lock.Lock()
+	desired := r.merge(p.owners)
+	published := p.published
+	r.lock.Unlock()
+
+	//rrsets which aren't desired are deleted first, so cname could replace
+	//other types
+	var errs []error
+	var current []*g53.RRset
+	for _, old := range published {
+		if findRRset(desired, old.Type) != nil {
+			continue
+		}
+		if err := c.pushRRset(p.view, p.zone, old, nil); err != nil {
+			errs = append(errs, err)
+			current = append(current, old)
+		}
+	}
+	for _, new := range desired {
+		old := findRRset(published, new.Type)
+		if err := c.pushRRset(p.view, p.zone, old, new); err != nil {
+			errs = append(errs, err)
+			if old != nil {
+				current = append(current, old)
+			}
+			continue
+		}
+		current = append(current, new)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	p.published = current
+	p.failed = len(errs) != 0
+	if len(p.owners) == 0 && len(current) == 0 && r.names[k] == p {
+		delete(r.names, k)
+	}
+	return errs
+}
+
+func findRRset(rrsets []*g53.RRset, typ g53.RRType) *g53.RRset {
+	for _, rrset := range rrsets {
+		if rrset.Type == typ {
+			return rrset
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Shutdown stops watching k8s, pending endpoints changes are flushed to
+// queue, then services in queue are reconciled within grace. The vanguard2
+// connection is closed at last, error is returned if some services aren't
+// synced, since failed keys are no longer retried after shutdown. Reload in
+// progress finishes before the connection is closed, later ones are refused
+func (c *Controller) Shutdown(grace time.Duration) error {
+	deadline := time.NewTimer(grace)
+	defer deadline.Stop()
+
+	c.stopOnce.Do(func() { close(c.stopCh) })
+	var err error
+	select {
+	case <-c.stopped:
+		err = c.drain(deadline.C, grace)
+	case <-deadline.C:
+		err = fmt.Errorf("event handlers don't finish in %s", grace.String())
+	}
+
+	c.reloadLock.RLock()
+	client := c.client
+	c.reloadLock.RUnlock()
+	if closeErr := client.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c *Controller) drain(deadline <-chan time.Time, grace time.Duration) error {
+	c.endpoints.flush()
+	c.queue.ShutDown()
+	drained := make(chan struct{})
+	go func() {
+		c.workerGroup.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		if n := c.failedCount(); n != 0 {
+			return fmt.Errorf("%d services failed to sync", n)
+		} else if n := c.ptrs.pendingCount(); n != 0 {
+			return fmt.Errorf("%d ptr rrsets failed to sync", n)
+		} else if n := c.ingresses.pendingCount(); n != 0 {
+			return fmt.Errorf("%d ingress hosts failed to sync", n)
+		} else if n := c.dnsRecords.pendingCount(); n != 0 {
+			return fmt.Errorf("%d dns record names failed to sync", n)
+		} else if n := c.clustersetRecords.pendingCount(); n != 0 {
+			return fmt.Errorf("%d clusterset names failed to sync", n)
+		}
+		return nil
+	case <-deadline:
+		return fmt.Errorf("%d objects aren't synced in %s", c.queue.Len()+int(atomic.LoadInt64(&c.busyWorkers)), grace.String())
+	}
+}
+
+func (c *Controller) setFailed(key interface{}, failed bool) {
+	c.failedLock.Lock()
+	defer c.failedLock.Unlock()
+	if failed {
+		c.failed[key] = struct{}{}
+	} else {
+		delete(c.failed, key)
+	}
+}
+
+func (c *Controller) failedCount() int {
+	c.failedLock.Lock()
+	defer c.failedLock.Unlock()
+	return len(c.failed)
+}
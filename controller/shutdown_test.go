@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zdnscloud/gok8s/handler"
+	"github.com/zdnscloud/gok8s/predicate"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// idleController watches nothing, it returns after stopped
+type idleController struct{}
+
+func (idleController) Watch(obj runtime.Object) error {
+	return nil
+}
+
+func (idleController) Start(stop <-chan struct{}, h handler.EventHandler, predicates ...predicate.Predicate) {
+	<-stop
+}
+
+func TestShutdown(t *testing.T) {
+	for _, failing := range []bool{false, true} {
+		testShutdown(t, failing)
+	}
+}
+
+func testShutdown(t *testing.T, failing bool) {
+	opts := Options{EndpointsWindow: time.Hour, EndpointsMaxWait: time.Hour}
+	env := newTestEnvWithOptions(t, opts)
+	defer env.close()
+	env.ctl.controller = idleController{}
+	env.run(step{createEvent, headlessService("default", "db")})
+	env.run(step{createEvent, endpoints("default", "db", []string{"10.42.0.5"})})
+	env.run(step{updateEvent, endpoints("default", "db", []string{"10.42.0.6"})})
+	if failing {
+		env.server.Stop()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		env.ctl.Run()
+		close(stopped)
+	}()
+	err := env.ctl.Shutdown(time.Second)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("run should return after shutdown")
+	}
+	if reloadErr := env.ctl.Reload(nil, opts); reloadErr == nil {
+		t.Errorf("reload should be refused after shutdown")
+	}
+	if failing {
+		if err == nil {
+			t.Errorf("shutdown should fail when changes can't be pushed")
+		}
+		return
+	}
+
+	if err != nil {
+		t.Fatalf("shutdown failed:%s", err.Error())
+	}
+	want := []string{
+		"10-42-0-6.db.default.svc.cluster.local. A 10.42.0.6",
+		"6.0.42.10.in-addr.arpa. PTR 10-42-0-6.db.default.svc.cluster.local.",
+		"db.default.svc.cluster.local. A 10.42.0.6",
+	}
+	if got := env.records(); reflect.DeepEqual(got, want) == false {
+		t.Errorf("pending changes should be flushed\nwant:\n%s\ngot:\n%s", joinLines(want), joinLines(got))
+	}
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"google.golang.org/grpc"
+
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+)
+
+// pushedState forwards requests to backend, and replays the succeed ones on
+// a memory store, so it knows what has been pushed without querying the
+// server, failed rrset updates are kept until the rrset is updated again.
+// Failed replay means the store diverges from the server, it's logged
+type pushedState struct {
+	backend pb.DynamicUpdateInterfaceClient
+	store   *memstore.Store
+
+	lock   sync.Mutex
+	errors map[string]RRsetError
+}
+
+type RRsetError struct {
+	View   string    `json:"view"`
+	Zone   string    `json:"zone"`
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Rdatas []string  `json:"rdatas,omitempty"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+var _ pb.DynamicUpdateInterfaceClient = &pushedState{}
+
+func newPushedState(backend pb.DynamicUpdateInterfaceClient) *pushedState {
+	return &pushedState{
+		backend: backend,
+		store:   memstore.New(),
+		errors:  make(map[string]RRsetError),
+	}
+}
+
+func (s *pushedState) AddZone(ctx context.Context, in *pb.AddZoneRequest, opts ...grpc.CallOption) (*pb.AddZoneResponse, error) {
+	resp, err := s.backend.AddZone(ctx, in, opts...)
+	if err == nil {
+		s.store.DeleteZone(ctx, &pb.DeleteZoneRequest{Zones: []string{in.Zone}, View: in.View})
+		_, replayErr := s.store.AddZone(ctx, in)
+		s.logReplayError("add zone", in.View, in.Zone, replayErr)
+	} else if s.hasZone(in.View, in.Zone) == false {
+		//zone already exists on server, track the rrsets pushed into it
+		s.store.AddZone(ctx, in)
+	}
+	return resp, err
+}
+
+func (s *pushedState) DeleteZone(ctx context.Context, in *pb.DeleteZoneRequest, opts ...grpc.CallOption) (*pb.DeleteZoneResponse, error) {
+	resp, err := s.backend.DeleteZone(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.DeleteZone(ctx, in)
+		s.logReplayError("delete zones", in.View, strings.Join(in.Zones, ","), replayErr)
+	}
+	return resp, err
+}
+
+func (s *pushedState) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (*pb.AddRRsetResponse, error) {
+	resp, err := s.backend.AddRRset(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.AddRRset(ctx, in)
+		s.logReplayError("add rrset", in.View, in.Zone, replayErr)
+	}
+	for _, rrset := range in.Rrsets {
+		s.setError(in.View, in.Zone, rrset.Name, rrset.Type, rrset.Rdatas, err)
+	}
+	return resp, err
+}
+
+func (s *pushedState) DeleteDomain(ctx context.Context, in *pb.DeleteDomainRequest, opts ...grpc.CallOption) (*pb.DeleteDomainResponse, error) {
+	resp, err := s.backend.DeleteDomain(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.DeleteDomain(ctx, in)
+		s.logReplayError("delete domain", in.View, in.Zone, replayErr)
+	}
+	return resp, err
+}
+
+func (s *pushedState) DeleteRRset(ctx context.Context, in *pb.DeleteRRsetRequest, opts ...grpc.CallOption) (*pb.DeleteRRsetResponse, error) {
+	resp, err := s.backend.DeleteRRset(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.DeleteRRset(ctx, in)
+		s.logReplayError("delete rrset", in.View, in.Zone, replayErr)
+	}
+	for _, header := range in.Rrsets {
+		s.setError(in.View, in.Zone, header.Name, header.Type, nil, err)
+	}
+	return resp, err
+}
+
+func (s *pushedState) DeleteRdata(ctx context.Context, in *pb.DeleteRdataRequest, opts ...grpc.CallOption) (*pb.DeleteRdataResponse, error) {
+	resp, err := s.backend.DeleteRdata(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.DeleteRdata(ctx, in)
+		s.logReplayError("delete rdata", in.View, in.Zone, replayErr)
+	}
+	for _, rrset := range in.Rrsets {
+		s.setError(in.View, in.Zone, rrset.Name, rrset.Type, rrset.Rdatas, err)
+	}
+	return resp, err
+}
+
+func (s *pushedState) UpdateRdata(ctx context.Context, in *pb.UpdateRdataRequest, opts ...grpc.CallOption) (*pb.UpdateRdataResponse, error) {
+	resp, err := s.backend.UpdateRdata(ctx, in, opts...)
+	if err == nil {
+		_, replayErr := s.store.UpdateRdata(ctx, in)
+		s.logReplayError("update rdata", in.View, in.Zone, replayErr)
+	}
+	if in.NewRrset != nil {
+		s.setError(in.View, in.Zone, in.NewRrset.Name, in.NewRrset.Type, in.NewRrset.Rdatas, err)
+	}
+	return resp, err
+}
+
+// copyZone tracks the zone pushed to the same server by other
+func (s *pushedState) copyZone(other *pushedState, view, zone string) {
+	content, err := other.store.ZoneString(view, zone)
+	if err != nil {
+		return
+	}
+	s.store.DeleteZone(context.TODO(), &pb.DeleteZoneRequest{Zones: []string{zone}, View: view})
+	_, err = s.store.AddZone(context.TODO(), &pb.AddZoneRequest{Zone: zone, ZoneContent: content, View: view})
+	s.logReplayError("copy zone", view, zone, err)
+}
+
+func (s *pushedState) hasZone(view, zone string) bool {
+	_, err := s.store.RRsets(view, zone)
+	return err == nil
+}
+
+func (s *pushedState) logReplayError(op, view, zone string, err error) {
+	if err != nil {
+		log.Printf("replay %s in zone %s view %q on pushed state failed:%s", op, zone, view, err.Error())
+	}
+}
+
+func (s *pushedState) setError(view, zone, name string, typ pb.RRType, rdatas []string, err error) {
+	key := view + "/" + zone + "/" + name + "/" + typ.String()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		delete(s.errors, key)
+	} else {
+		s.errors[key] = RRsetError{
+			View:   view,
+			Zone:   zone,
+			Name:   name,
+			Type:   typ.String(),
+			Rdatas: rdatas,
+			Error:  err.Error(),
+			Time:   time.Now(),
+		}
+	}
+}
+
+func (s *pushedState) getErrors() []RRsetError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	errors := make([]RRsetError, 0, len(s.errors))
+	for _, e := range s.errors {
+		errors = append(errors, e)
+	}
+	return errors
+}
+
+// rrsets in all views and zones which match the filter
+func (s *pushedState) findRRsets(match func(*g53.RRset) bool) []PushedRRset {
+	var result []PushedRRset
+	for _, view := range s.store.Views() {
+		for _, zone := range s.store.Zones(view) {
+			rrsets, _ := s.store.RRsets(view, zone)
+			for _, rrset := range rrsets {
+				if match(rrset) {
+					result = append(result, newPushedRRset(view, zone, rrset))
+				}
+			}
+		}
+	}
+	return result
+}
+
+type PushedRRset struct {
+	View   string   `json:"view"`
+	Zone   string   `json:"zone"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    uint32   `json:"ttl"`
+	Rdatas []string `json:"rdatas"`
+}
+
+func newPushedRRset(view, zone string, rrset *g53.RRset) PushedRRset {
+	return PushedRRset{
+		View:   view,
+		Zone:   zone,
+		Name:   rrset.Name.String(false),
+		Type:   rrset.Type.String(),
+		TTL:    uint32(rrset.Ttl),
+		Rdatas: rdataStrings(rrset),
+	}
+}
@@ -2,15 +2,18 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/vanguard2-controller/config"
 	"github.com/zdnscloud/vanguard2-controller/util"
 
 	pb "github.com/zdnscloud/vanguard2-controller/proto"
 	"google.golang.org/grpc"
-	corev1 "k8s.io/api/core/v1"
 )
 
 const (
@@ -19,103 +22,483 @@ const (
 	DefaultSRVWeight   = 100
 	DefaultSRVPriority = 10
 	DNSSchemaVersion   = "1.0.1"
+	DefaultView        = ""
 )
 
 type VgClient struct {
 	grpcClient pb.DynamicUpdateInterfaceClient
 	conn       *grpc.ClientConn
+	grpcServer string
+
+	serviceZone         *g53.Name
+	serviceReverseZones []*g53.Name
+	podReverseZones     []*g53.Name
+	serverAddress       string
+	registry            *ownerRegistry
+	state               *pushedState
+
+	lock         sync.RWMutex
+	customZones  map[string][]*g53.RRset
+	serviceViews []string
+	schemes      []*namingScheme
+	schemeZones  []*g53.Name
+	aliasZones   []*g53.Name
+	// zone of services exported by member clusters
+	clustersetZone *g53.Name
+	initialized    bool
+}
+
+// if ownerID isn't empty, zones are shared with other writers, and only rrsets
+// owned by ownerID are modified, the owner records are queried from ownerQueryServer
+func NewVgClient(grpcServer, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer string) (*VgClient, error) {
+	conn, err := dialGRPC(grpcServer)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := NewVgClientWithBackend(pb.NewDynamicUpdateInterfaceClient(conn), clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	cli.conn = conn
+	cli.grpcServer = grpcServer
+	return cli, nil
+}
+
+// DialVgClient connects to vanguard2 without initializing zones, existing
+// records are kept. Zones are initialized when it replaces the client of
+// controller by Reload
+func DialVgClient(grpcServer, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer string) (*VgClient, error) {
+	conn, err := dialGRPC(grpcServer)
+	if err != nil {
+		return nil, err
+	}
 
-	serviceZone        *g53.Name
-	serviceReverseZone *g53.Name
-	podReverseZone     *g53.Name
-	serverAddress      string
+	cli, err := newVgClient(pb.NewDynamicUpdateInterfaceClient(conn), clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	cli.conn = conn
+	cli.grpcServer = grpcServer
+	return cli, nil
 }
 
-func NewVgClient(grpcServer, clustDomain, serviceIPRange, podIPRange, serverAddress string) (*VgClient, error) {
+func dialGRPC(grpcServer string) (*grpc.ClientConn, error) {
 	dialOptions := []grpc.DialOption{
 		grpc.WithInsecure(),
 		grpc.WithTimeout(GRPCConnTimeout),
 	}
+	return grpc.Dial(grpcServer, dialOptions...)
+}
 
-	conn, err := grpc.Dial(grpcServer, dialOptions...)
+// backend is used to update zones instead of grpc connection to vanguard2
+func NewVgClientWithBackend(backend pb.DynamicUpdateInterfaceClient, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer string) (*VgClient, error) {
+	cli, err := newVgClient(backend, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := cli.initZones(); err != nil {
+		return nil, err
+	}
+
+	return cli, nil
+}
+
+// NewUninitializedVgClient is DialVgClient on backend
+func NewUninitializedVgClient(backend pb.DynamicUpdateInterfaceClient, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer string) (*VgClient, error) {
+	return newVgClient(backend, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer)
+}
+
+func newVgClient(backend pb.DynamicUpdateInterfaceClient, clustDomain, serviceIPRange, podIPRange, serverAddress, ownerID, ownerQueryServer string) (*VgClient, error) {
 	serviceZone, err := g53.NameFromString(clustDomain)
 	if err != nil {
 		return nil, err
 	}
-	serviceReverseZone, err := util.ReverseZoneName(serviceIPRange)
+	serviceReverseZones, err := util.ReverseZoneNames(serviceIPRange)
 	if err != nil {
 		return nil, err
 	}
-	podReverseZone, err := util.ReverseZoneName(podIPRange)
+	podReverseZones, err := util.ReverseZoneNames(podIPRange)
 	if err != nil {
 		return nil, err
 	}
 
+	state := newPushedState(backend)
 	cli := &VgClient{
-		grpcClient:         pb.NewDynamicUpdateInterfaceClient(conn),
-		conn:               conn,
-		serviceZone:        serviceZone,
-		serviceReverseZone: serviceReverseZone,
-		podReverseZone:     podReverseZone,
-		serverAddress:      serverAddress,
+		grpcClient:          state,
+		serviceZone:         serviceZone,
+		serviceReverseZones: serviceReverseZones,
+		podReverseZones:     podReverseZones,
+		serverAddress:       serverAddress,
+		state:               state,
+		customZones:         make(map[string][]*g53.RRset),
+		schemes:             []*namingScheme{defaultNamingScheme(serviceZone)},
+	}
+	if ownerID != "" {
+		cli.registry = newOwnerRegistry(ownerID, ownerQueryServer)
 	}
+	return cli, nil
+}
 
+// cloneWithBackend creates client with same fixed zones on backend, custom
+// zones, owner registry and pushed state aren't copied
+func (c *VgClient) cloneWithBackend(backend pb.DynamicUpdateInterfaceClient) (*VgClient, error) {
+	cli := &VgClient{
+		grpcClient:          backend,
+		serviceZone:         c.serviceZone,
+		serviceReverseZones: c.serviceReverseZones,
+		podReverseZones:     c.podReverseZones,
+		serverAddress:       c.serverAddress,
+		customZones:         make(map[string][]*g53.RRset),
+	}
+	c.lock.RLock()
+	cli.schemes = c.schemes
+	cli.schemeZones = append([]*g53.Name(nil), c.schemeZones...)
+	cli.aliasZones = append([]*g53.Name(nil), c.aliasZones...)
+	cli.clustersetZone = c.clustersetZone
+	c.lock.RUnlock()
 	if err := cli.initZones(); err != nil {
 		return nil, err
 	}
-
 	return cli, nil
 }
 
 func (c *VgClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
 
+// fixedZone is created with client, its records come from template
+type fixedZone struct {
+	name     *g53.Name
+	template string
+}
+
+// reverse zones, service zone and zones of naming schemes and aliases, lock
+// should be held by caller
+func (c *VgClient) fixedZones() []fixedZone {
+	var zones []fixedZone
+	for _, zone := range c.reverseZones() {
+		zones = append(zones, fixedZone{zone, c.reverseZoneTemplate(zone)})
+	}
+	zones = append(zones, fixedZone{c.serviceZone, ServiceZoneTemplate})
+	for _, zone := range c.extraServiceZones() {
+		zones = append(zones, fixedZone{zone, ServiceZoneTemplate})
+	}
+	return zones
+}
+
+func findFixedZone(zones []fixedZone, name *g53.Name) *fixedZone {
+	for i, zone := range zones {
+		if zone.name.Equals(name) {
+			return &zones[i]
+		}
+	}
+	return nil
+}
+
+// initZones creates fixed zones in default view
 func (c *VgClient) initZones() error {
-	c.doDeleteZone([]*g53.Name{c.serviceZone, c.serviceReverseZone, c.podReverseZone})
-	return c.createZones()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, zone := range c.fixedZones() {
+		if err := c.initZone(DefaultView, zone); err != nil {
+			return err
+		}
+	}
+	c.initialized = true
+	return nil
 }
 
-func (c *VgClient) createZones() error {
-	if err := c.createServiceZone(); err != nil {
-		return err
+// zone is recreated to drop records left by last run, unless it's shared
+// with other writers, in which case it may have records from them and is
+// kept
+func (c *VgClient) initZone(view string, zone fixedZone) error {
+	if c.registry == nil {
+		c.doDeleteZone(view, []*g53.Name{zone.name})
 	}
-	if err := c.createServiceReverseZone(); err != nil {
-		return err
+
+	var err error
+	if zone.template == ServiceZoneTemplate {
+		err = c.createServiceZoneInView(view, zone.name)
+	} else {
+		err = c.createReverseZoneInView(view, zone.name)
 	}
-	return c.createPodReverseZone()
+	if err != nil {
+		if c.registry == nil {
+			return err
+		}
+		log.Printf("create zone %s in view %q failed, assume it already exists:%s", zone.name.String(false), view, err.Error())
+	}
+	return nil
 }
 
-func (c *VgClient) createServiceZone() error {
-	return c.doCreateZone(c.serviceZone, ServiceZoneTemplate, map[string]interface{}{
-		"origin":            c.serviceZone.String(false),
+// initZonesFrom initializes zones of c which replaces old. Zones of old on
+// the same server with the same content are reused with their records, so
+// names in them keep resolving until they are updated, other zones are
+// initialized like initZones. Reused zones are returned in format view/zone
+func (c *VgClient) initZonesFrom(old *VgClient) (map[string]bool, error) {
+	reused := make(map[string]bool)
+	if c.isSameServer(old) == false || c.serverAddress != old.serverAddress {
+		return reused, c.initZones()
+	}
+
+	old.lock.RLock()
+	oldZones := old.fixedZones()
+	views := append([]string(nil), old.serviceViews...)
+	customZones := make(map[string][]*g53.RRset)
+	for zone, rrsets := range old.customZones {
+		customZones[zone] = rrsets
+	}
+	old.lock.RUnlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	zones := c.fixedZones()
+	for _, view := range append([]string{DefaultView}, views...) {
+		for _, zone := range zones {
+			name := zone.name.String(false)
+			if o := findFixedZone(oldZones, zone.name); o != nil && o.template == zone.template {
+				c.state.copyZone(old.state, view, name)
+				reused[view+"/"+name] = true
+			} else if err := c.initZone(view, zone); err != nil {
+				return nil, err
+			}
+		}
+	}
+	//custom zones are updated in place when DNSZone resources are handled
+	for zone, rrsets := range customZones {
+		if findFixedZone(zones, g53.NameFromStringUnsafe(zone)) == nil {
+			c.customZones[zone] = rrsets
+			c.state.copyZone(old.state, DefaultView, zone)
+			reused[DefaultView+"/"+zone] = true
+		}
+	}
+	c.serviceViews = views
+	c.initialized = true
+	return reused, nil
+}
+
+// grpc connections to the same address, or the same backend
+func (c *VgClient) isSameServer(other *VgClient) bool {
+	if c.grpcServer != "" || other.grpcServer != "" {
+		return c.grpcServer == other.grpcServer
+	}
+	return c.state != nil && other.state != nil && c.state.backend == other.state.backend
+}
+
+func (c *VgClient) createServiceZoneInView(view string, zone *g53.Name) error {
+	return c.doCreateZone(view, zone, ServiceZoneTemplate, c.serviceZoneTemplateParameter(zone))
+}
+
+func (c *VgClient) serviceZoneTemplateParameter(zone *g53.Name) map[string]interface{} {
+	return map[string]interface{}{
+		"origin":            zone.String(false),
 		"ttl":               DefaultTTL,
 		"clusterDnsService": c.serverAddress,
 		"dnsSchemaVersion":  DNSSchemaVersion,
-	})
+	}
 }
 
-func (c *VgClient) createServiceReverseZone() error {
-	return c.doCreateZone(c.serviceReverseZone, ServiceReverseZoneTemplate, map[string]interface{}{
-		"origin":            c.serviceReverseZone.String(false),
-		"ttl":               DefaultTTL,
-		"clusterDnsService": c.serverAddress,
-	})
+func (c *VgClient) reverseZones() []*g53.Name {
+	return append(append([]*g53.Name(nil), c.serviceReverseZones...), c.podReverseZones...)
 }
 
-func (c *VgClient) createPodReverseZone() error {
-	return c.doCreateZone(c.podReverseZone, PodReverseZoneTemplate, map[string]interface{}{
-		"origin":            c.podReverseZone.String(false),
+func (c *VgClient) reverseZoneTemplate(zone *g53.Name) string {
+	if hasName(c.podReverseZones, zone) {
+		return PodReverseZoneTemplate
+	}
+	return ServiceReverseZoneTemplate
+}
+
+// serviceReverseZone returns the reverse zone of service ip range which ptr
+// name belongs to, the first one if the ip is out of range
+func (c *VgClient) serviceReverseZone(name *g53.Name) *g53.Name {
+	return reverseZoneOf(name, c.serviceReverseZones)
+}
+
+func (c *VgClient) podReverseZone(name *g53.Name) *g53.Name {
+	return reverseZoneOf(name, c.podReverseZones)
+}
+
+func reverseZoneOf(name *g53.Name, zones []*g53.Name) *g53.Name {
+	for _, zone := range zones {
+		if isNameInZone(name, zone) {
+			return zone
+		}
+	}
+	return zones[0]
+}
+
+func (c *VgClient) createReverseZoneInView(view string, zone *g53.Name) error {
+	return c.doCreateZone(view, zone, c.reverseZoneTemplate(zone), map[string]interface{}{
+		"origin":            zone.String(false),
 		"ttl":               DefaultTTL,
 		"clusterDnsService": c.serverAddress,
 	})
 }
 
-func (c *VgClient) doCreateZone(zoneName *g53.Name, template string, templateParameter map[string]interface{}) error {
+// custom zone is created from DNSZone resource if it's missing, records in
+// existing zone are kept and only the records from template are updated.
+// Zone created by others isn't changed if it's shared with other writers,
+// created is true if the zone is new
+func (c *VgClient) createCustomZone(zoneName *g53.Name, template string, templateParameter map[string]interface{}) (created bool, err error) {
+	rrsets, err := templateRRsets(template, templateParameter)
+	if err != nil {
+		return false, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := zoneName.String(false)
+	old, ok := c.customZones[key]
+	if ok == false {
+		if err := c.doCreateZone(DefaultView, zoneName, template, templateParameter); err == nil {
+			c.customZones[key] = rrsets
+			return true, nil
+		} else if c.registry != nil {
+			log.Printf("create zone %s failed, assume it's created by others and keep it:%s", key, err.Error())
+			c.customZones[key] = nil
+			return false, nil
+		} else {
+			log.Printf("create zone %s failed, assume it already exists:%s", key, err.Error())
+		}
+	} else if old == nil {
+		//zone isn't created by us
+		return false, nil
+	}
+
+	for _, rrset := range old {
+		if findRRsetByName(rrsets, rrset.Name, rrset.Type) == nil {
+			if err := c.doDeleteRRset(DefaultView, zoneName, rrset.Name, rrset.Type); err != nil {
+				return false, err
+			}
+		}
+	}
+	for _, rrset := range rrsets {
+		if o := findRRsetByName(old, rrset.Name, rrset.Type); o != nil && isRRsetEqual(o, rrset) {
+			continue
+		}
+		if err := c.doReplaceRRset(DefaultView, zoneName, rrset); err != nil {
+			return false, err
+		}
+	}
+	c.customZones[key] = rrsets
+	return false, nil
+}
+
+// zone shared with other writers is kept
+func (c *VgClient) deleteCustomZone(zoneName *g53.Name) error {
+	c.lock.Lock()
+	delete(c.customZones, zoneName.String(false))
+	c.lock.Unlock()
+	if c.registry != nil {
+		log.Printf("zone %s is shared with other writers, keep it", zoneName.String(false))
+		return nil
+	}
+	return c.doDeleteZone(DefaultView, []*g53.Name{zoneName})
+}
+
+// templateRRsets parses the records of zone from template
+func templateRRsets(template string, templateParameter map[string]interface{}) ([]*g53.RRset, error) {
+	zoneContent, err := util.CompileTemplateFromMap(template, templateParameter)
+	if err != nil {
+		return nil, err
+	}
+
+	var rrsets []*g53.RRset
+	for _, line := range strings.Split(zoneContent, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rrset, err := g53.RRsetFromString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rr %s:%s", line, err.Error())
+		}
+		if old := findRRsetByName(rrsets, rrset.Name, rrset.Type); old != nil {
+			for _, rdata := range rrset.Rdatas {
+				old.AddRdata(rdata)
+			}
+		} else {
+			rrsets = append(rrsets, rrset)
+		}
+	}
+	return rrsets, nil
+}
+
+func findRRsetByName(rrsets []*g53.RRset, name *g53.Name, typ g53.RRType) *g53.RRset {
+	for _, rrset := range rrsets {
+		if rrset.Type == typ && rrset.Name.Equals(name) {
+			return rrset
+		}
+	}
+	return nil
+}
+
+// deleteZonesExcept deletes the zones created by c except the zones of
+// other, it's used when other replaces c, zones of other are only kept on
+// the same server. Custom zones created by others are kept
+func (c *VgClient) deleteZonesExcept(other *VgClient) {
+	keep := make(map[string]bool)
+	if c.isSameServer(other) {
+		other.lock.RLock()
+		for _, view := range append([]string{DefaultView}, other.serviceViews...) {
+			for _, zone := range other.fixedZones() {
+				keep[view+"/"+zone.name.String(false)] = true
+			}
+		}
+		for zone := range other.customZones {
+			keep[DefaultView+"/"+zone] = true
+		}
+		other.lock.RUnlock()
+	}
+
+	c.lock.RLock()
+	var fixed, custom []*g53.Name
+	for _, zone := range c.fixedZones() {
+		fixed = append(fixed, zone.name)
+	}
+	for zone, rrsets := range c.customZones {
+		if rrsets != nil {
+			custom = append(custom, g53.NameFromStringUnsafe(zone))
+		}
+	}
+	views := append([]string{DefaultView}, c.serviceViews...)
+	c.lock.RUnlock()
+
+	for _, view := range views {
+		zones := fixed
+		if view == DefaultView {
+			zones = append(append([]*g53.Name(nil), fixed...), custom...)
+		}
+		var deleted []*g53.Name
+		for _, zone := range zones {
+			if keep[view+"/"+zone.String(false)] == false {
+				deleted = append(deleted, zone)
+			}
+		}
+		if len(deleted) == 0 {
+			continue
+		}
+		if err := c.doDeleteZone(view, deleted); err != nil {
+			log.Printf("delete zones in view %q failed:%s", view, err.Error())
+		}
+	}
+}
+
+func (c *VgClient) isCustomZone(zoneName *g53.Name) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.customZones[zoneName.String(false)]
+	return ok
+}
+
+func (c *VgClient) doCreateZone(view string, zoneName *g53.Name, template string, templateParameter map[string]interface{}) error {
 	zoneContent, err := util.CompileTemplateFromMap(template, templateParameter)
 	if err != nil {
 		return err
@@ -123,46 +506,130 @@ func (c *VgClient) doCreateZone(zoneName *g53.Name, template string, templatePar
 	_, err = c.grpcClient.AddZone(context.TODO(), &pb.AddZoneRequest{
 		Zone:        zoneName.String(false),
 		ZoneContent: zoneContent,
+		View:        view,
 	})
 	return err
 }
 
-func (c *VgClient) doDeleteZone(zones []*g53.Name) {
+func (c *VgClient) doDeleteZone(view string, zones []*g53.Name) error {
 	zoneNames := make([]string, len(zones))
 	for i, z := range zones {
 		zoneNames[i] = z.String(false)
 	}
 
-	c.grpcClient.DeleteZone(context.TODO(), &pb.DeleteZoneRequest{
+	_, err := c.grpcClient.DeleteZone(context.TODO(), &pb.DeleteZoneRequest{
 		Zones: zoneNames,
+		View:  view,
 	})
+	return err
+}
+
+// create service zone and reverse zones in view when it's first used, zones
+// in view aren't wiped on start, so recreate them to drop records left by
+// last run, unless they are shared with other writers
+func (c *VgClient) ensureServiceZoneInView(view string) (bool, error) {
+	if view == DefaultView {
+		return false, nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, v := range c.serviceViews {
+		if v == view {
+			return false, nil
+		}
+	}
+
+	for _, zone := range c.fixedZones() {
+		if err := c.initZone(view, zone); err != nil {
+			return false, err
+		}
+	}
+	c.serviceViews = append(c.serviceViews, view)
+	return true, nil
+}
+
+func (c *VgClient) getServiceViews() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]string(nil), c.serviceViews...)
 }
 
-func (c *VgClient) replaceServiceRRset(rrset *g53.RRset) error {
-	return c.replaceRRset(c.serviceZone, rrset)
+// return the closest managed zone which name belongs to, nil if no zone
+func (c *VgClient) getZone(name *g53.Name) *g53.Name {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var closest *g53.Name
+	zones := append(append([]*g53.Name{c.serviceZone}, c.reverseZones()...), c.extraServiceZones()...)
+	for zone := range c.customZones {
+		zones = append(zones, g53.NameFromStringUnsafe(zone))
+	}
+	for _, zone := range zones {
+		if isNameInZone(name, zone) == false {
+			continue
+		}
+		if closest == nil || zone.LabelCount() > closest.LabelCount() {
+			closest = zone
+		}
+	}
+	return closest
 }
 
-func (c *VgClient) deleteServiceRRset(name *g53.Name, typ g53.RRType) error {
-	return c.deleteRRset(c.serviceZone, name, typ)
+func isNameInZone(name, zone *g53.Name) bool {
+	relation := name.Compare(zone, false).Relation
+	return relation == g53.EQUAL || relation == g53.SUBDOMAIN
 }
 
-func (c *VgClient) replacePodReverseRRset(rrset *g53.RRset) error {
-	return c.replaceRRset(c.podReverseZone, rrset)
+func (c *VgClient) deleteRRset(zone *g53.Name, name *g53.Name, typ g53.RRType) error {
+	return c.deleteRRsetInView(DefaultView, zone, name, typ)
 }
 
-func (c *VgClient) deletePodReverseRRset(name *g53.Name) error {
-	return c.deleteRRset(c.podReverseZone, name, g53.RR_PTR)
+func (c *VgClient) deleteRRsetInView(view string, zone *g53.Name, name *g53.Name, typ g53.RRType) error {
+	if c.registry == nil {
+		return c.doDeleteRRset(view, zone, name, typ)
+	}
+
+	owned, exists, err := c.registry.checkOwner(view, name, typ)
+	if err != nil {
+		return err
+	} else if owned == false {
+		if exists {
+			return errNotOwner{name, typ}
+		}
+		return nil
+	}
+
+	if err := c.doDeleteRRset(view, zone, name, typ); err != nil {
+		return err
+	}
+	c.registry.setOwned(view, name, typ, false)
+	return c.doDeleteRRset(view, zone, c.registry.ownerName(name, typ), g53.RR_TXT)
 }
 
-func (c *VgClient) replaceServiceReverseRRset(rrset *g53.RRset) error {
-	return c.replaceRRset(c.serviceReverseZone, rrset)
+func (c *VgClient) replaceRRset(zone *g53.Name, rrset *g53.RRset) error {
+	return c.replaceRRsetInView(DefaultView, zone, rrset)
 }
 
-func (c *VgClient) deleteServiceReverseRRset(name *g53.Name) error {
-	return c.deleteRRset(c.serviceReverseZone, name, g53.RR_PTR)
+func (c *VgClient) replaceRRsetInView(view string, zone *g53.Name, rrset *g53.RRset) error {
+	if c.registry != nil {
+		owned, exists, err := c.registry.checkOwner(view, rrset.Name, rrset.Type)
+		if err != nil {
+			return err
+		} else if owned == false {
+			if exists {
+				return errNotOwner{rrset.Name, rrset.Type}
+			}
+			if err := c.doReplaceRRset(view, zone, c.registry.ownerRRset(rrset.Name, rrset.Type)); err != nil {
+				return err
+			}
+			c.registry.setOwned(view, rrset.Name, rrset.Type, true)
+		}
+	}
+	return c.doReplaceRRset(view, zone, rrset)
 }
 
-func (c *VgClient) deleteRRset(zone *g53.Name, name *g53.Name, typ g53.RRType) error {
+func (c *VgClient) doDeleteRRset(view string, zone *g53.Name, name *g53.Name, typ g53.RRType) error {
 	_, err := c.grpcClient.DeleteRRset(context.TODO(), &pb.DeleteRRsetRequest{
 		Zone: zone.String(false),
 		Rrsets: []*pb.RRsetHeader{
@@ -171,51 +638,270 @@ func (c *VgClient) deleteRRset(zone *g53.Name, name *g53.Name, typ g53.RRType) e
 				Type: g53RRTypeToPB(typ),
 			},
 		},
+		View: view,
 	})
 	return err
 }
 
-func (c *VgClient) replaceRRset(zone *g53.Name, rrset *g53.RRset) error {
-	if err := c.deleteRRset(zone, rrset.Name, rrset.Type); err != nil {
+func (c *VgClient) doReplaceRRset(view string, zone *g53.Name, rrset *g53.RRset) error {
+	if err := c.doDeleteRRset(view, zone, rrset.Name, rrset.Type); err != nil {
 		return err
 	}
 
+	return c.doAddRRset(view, zone, rrset)
+}
+
+// add rdatas of rrset to the rrset with same name and type
+func (c *VgClient) doAddRRset(view string, zone *g53.Name, rrset *g53.RRset) error {
+	_, err := c.grpcClient.AddRRset(context.TODO(), &pb.AddRRsetRequest{
+		Zone:   zone.String(false),
+		Rrsets: []*pb.RRset{rrsetToPB(rrset)},
+		View:   view,
+	})
+	return err
+}
+
+// updateRdataInView changes old rrset to new one by only sending the rdatas
+// which are added or removed, old rrset should be published by us
+func (c *VgClient) updateRdataInView(view string, zone *g53.Name, old, new *g53.RRset) error {
+	if c.registry != nil {
+		if owned, _, err := c.registry.checkOwner(view, new.Name, new.Type); err != nil {
+			return err
+		} else if owned == false {
+			return c.replaceRRsetInView(view, zone, new)
+		}
+	}
+
+	added := rdataDifference(new, old)
+	removed := rdataDifference(old, new)
+	switch {
+	case old.Ttl != new.Ttl || (len(added) != 0 && len(removed) != 0):
+		_, err := c.grpcClient.UpdateRdata(context.TODO(), &pb.UpdateRdataRequest{
+			Zone:     zone.String(false),
+			OldRrset: rrsetToPB(old),
+			NewRrset: rrsetToPB(new),
+			View:     view,
+		})
+		return err
+	case len(removed) != 0:
+		_, err := c.grpcClient.DeleteRdata(context.TODO(), &pb.DeleteRdataRequest{
+			Zone:   zone.String(false),
+			Rrsets: []*pb.RRset{rrsetToPB(newRRset(old.Name, old.Type, old.Ttl, removed...))},
+			View:   view,
+		})
+		return err
+	case len(added) != 0:
+		return c.doAddRRset(view, zone, newRRset(new.Name, new.Type, new.Ttl, added...))
+	}
+	return nil
+}
+
+// rdatas in a but not in b
+func rdataDifference(a, b *g53.RRset) []g53.Rdata {
+	var diff []g53.Rdata
+	for _, rdata := range a.Rdatas {
+		found := false
+		for _, other := range b.Rdatas {
+			if rdata.String() == other.String() {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			diff = append(diff, rdata)
+		}
+	}
+	return diff
+}
+
+func rrsetToPB(rrset *g53.RRset) *pb.RRset {
 	var rdatas []string
 	for _, rdata := range rrset.Rdatas {
 		rdatas = append(rdatas, rdata.String())
 	}
+	return &pb.RRset{
+		Name:   rrset.Name.String(false),
+		Type:   g53RRTypeToPB(rrset.Type),
+		Ttl:    uint32(rrset.Ttl),
+		Rdatas: rdatas,
+	}
+}
 
-	_, err := c.grpcClient.AddRRset(context.TODO(), &pb.AddRRsetRequest{
-		Zone: zone.String(false),
-		Rrsets: []*pb.RRset{
-			&pb.RRset{
-				Name:   rrset.Name.String(false),
-				Type:   g53RRTypeToPB(rrset.Type),
-				Ttl:    uint32(rrset.Ttl),
-				Rdatas: rdatas,
-			},
-		},
-	})
-	return err
+// SetNamingSchemes replaces the default naming scheme, names of all the
+// schemes are published, the first one is used in ptr records. Zones of
+// schemes other than cluster domain are created like service zone
+func (c *VgClient) SetNamingSchemes(schemes []config.NamingScheme) error {
+	if len(schemes) == 0 {
+		return nil
+	}
+
+	parsed, zones, err := parseNamingSchemes(schemes, c.serviceZone)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := validateAliasSchemes(parsed, c.serviceZone, c.copyZones(c.aliasZones)); err != nil {
+		return err
+	}
+	if c.clustersetZone != nil && hasName(zones, c.clustersetZone) {
+		return fmt.Errorf("zone of naming scheme conflicts with clusterset zone %s", c.clustersetZone.String(false))
+	}
+	if err := c.createExtraServiceZones(zones); err != nil {
+		return err
+	}
+	c.schemes = parsed
+	c.schemeZones = zones
+	return nil
+}
+
+// SetClusterDomainAliases publishes records of naming schemes in cluster
+// domain under each alias as well, names in ptr records keep in cluster domain
+func (c *VgClient) SetClusterDomainAliases(aliases []string) error {
+	zones, err := parseAliases(aliases, c.serviceZone)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := validateAliasSchemes(c.schemes, c.serviceZone, c.copyZones(zones)); err != nil {
+		return err
+	}
+	if c.clustersetZone != nil && hasName(zones, c.clustersetZone) {
+		return fmt.Errorf("cluster domain alias conflicts with clusterset zone %s", c.clustersetZone.String(false))
+	}
+	if err := c.createExtraServiceZones(zones); err != nil {
+		return err
+	}
+	c.aliasZones = zones
+	return nil
+}
+
+// SetClustersetDomain creates the zone where services exported by member
+// clusters are published, their names come from the naming schemes in
+// cluster domain copied into the zone like alias zones. The zone is managed
+// like service zone, so it's recreated unless it's shared with other writers
+func (c *VgClient) SetClustersetDomain(domain string) error {
+	zone, err := g53.NameFromString(domain)
+	if err != nil {
+		return fmt.Errorf("clusterset domain %s is invalid:%s", domain, err.Error())
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if zone.Equals(c.serviceZone) || hasName(c.extraServiceZones(), zone) {
+		return fmt.Errorf("clusterset domain %s is already used by cluster domain, naming schemes or aliases", domain)
+	}
+	if err := validateAliasSchemes(c.schemes, c.serviceZone, []*g53.Name{zone}); err != nil {
+		return err
+	}
+	if err := c.createExtraServiceZones([]*g53.Name{zone}); err != nil {
+		return err
+	}
+	c.clustersetZone = zone
+	return nil
+}
+
+// copyZones appends clusterset zone to alias zones, since schemes in cluster
+// domain are copied into both, lock should be held by caller
+func (c *VgClient) copyZones(aliasZones []*g53.Name) []*g53.Name {
+	if c.clustersetZone == nil {
+		return aliasZones
+	}
+	return append(append([]*g53.Name(nil), aliasZones...), c.clustersetZone)
+}
+
+// clustersetSchemes returns the schemes in cluster domain copied into
+// clusterset zone, nil if there is no clusterset zone
+func (c *VgClient) clustersetSchemes() []*namingScheme {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.clustersetZone == nil {
+		return nil
+	}
+	return aliasSchemes(c.schemes, c.serviceZone, []*g53.Name{c.clustersetZone})[len(c.schemes):]
+}
+
+// zones other than cluster domain are created like service zone, they are
+// created with other zones if client isn't initialized, lock should be held
+// by caller
+func (c *VgClient) createExtraServiceZones(zones []*g53.Name) error {
+	if c.initialized == false {
+		return nil
+	}
+	for _, zone := range zones {
+		if err := c.initZone(DefaultView, fixedZone{zone, ServiceZoneTemplate}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namingSchemes returns the configured schemes, schemes in cluster domain
+// are copied into each alias zone
+func (c *VgClient) namingSchemes() []*namingScheme {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return aliasSchemes(c.schemes, c.serviceZone, c.aliasZones)
 }
 
-func (c *VgClient) getServiceName(svc *corev1.Service) *g53.Name {
-	n, _ := g53.NameFromStringUnsafe(strings.Join([]string{svc.Name, svc.Namespace, "svc"}, ".")).Concat(c.serviceZone)
-	return n
+// service zone, zones of naming schemes, cluster domain aliases and
+// clusterset
+func (c *VgClient) serviceZones() []*g53.Name {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]*g53.Name{c.serviceZone}, c.extraServiceZones()...)
 }
 
-func (c *VgClient) getEndpointsAddrName(addr *corev1.EndpointAddress, svc, namespace string) *g53.Name {
-	podName := addr.Hostname
-	if podName == "" {
-		podName = strings.Replace(addr.IP, ".", "-", 3)
+// lock should be held by caller
+func (c *VgClient) extraServiceZones() []*g53.Name {
+	zones := append([]*g53.Name(nil), c.schemeZones...)
+	for _, zone := range c.copyZones(c.aliasZones) {
+		if hasName(zones, zone) == false {
+			zones = append(zones, zone)
+		}
 	}
-	n, _ := g53.NameFromStringUnsafe(strings.Join([]string{podName, svc, namespace, "svc"}, ".")).Concat(c.serviceZone)
-	return n
+	return zones
 }
 
-func (c *VgClient) getPortName(port, protocol, svc, namespace string) *g53.Name {
-	n, _ := g53.NameFromStringUnsafe(strings.Join([]string{"_" + port, "_" + protocol, svc, namespace, "svc"}, ".")).Concat(c.serviceZone)
-	return n
+func (c *VgClient) getServiceNameByKey(name, namespace string) (*g53.Name, error) {
+	return c.namingSchemes()[0].serviceName(name, namespace)
+}
+
+// getObjectOfName returns the service or endpoints which generates the name,
+// kind is empty if name isn't in service zone or isn't from default scheme
+func (c *VgClient) getObjectOfName(name *g53.Name) (kind, namespace, objName string) {
+	if scheme := c.namingSchemes()[0]; scheme.isDefault() == false || scheme.zone.Equals(c.serviceZone) == false {
+		return
+	}
+	if name.Compare(c.serviceZone, false).Relation != g53.SUBDOMAIN {
+		return
+	}
+
+	relative := strings.TrimSuffix(name.String(false), "."+c.serviceZone.String(false))
+	labels := strings.Split(relative, ".")
+	n := len(labels)
+	if n < 3 || labels[n-1] != "svc" {
+		return
+	}
+
+	if n == 3 {
+		kind = ObjectKindService
+	} else {
+		kind = ObjectKindEndpoints
+	}
+	return kind, labels[n-2], labels[n-3]
+}
+
+func isSupportedRRType(typ g53.RRType) bool {
+	switch typ {
+	case g53.RR_A, g53.RR_AAAA, g53.RR_NS, g53.RR_SOA, g53.RR_CNAME, g53.RR_MX, g53.RR_TXT, g53.RR_SRV, g53.RR_PTR:
+		return true
+	default:
+		return false
+	}
 }
 
 func g53RRTypeToPB(typ g53.RRType) pb.RRType {
@@ -230,6 +916,8 @@ func g53RRTypeToPB(typ g53.RRType) pb.RRType {
 		return pb.RRType_SOA
 	case g53.RR_CNAME:
 		return pb.RRType_CNAME
+	case g53.RR_MX:
+		return pb.RRType_MX
 	case g53.RR_TXT:
 		return pb.RRType_TXT
 	case g53.RR_SRV:
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/zdnscloud/gok8s/client"
+)
+
+// viewIsolation publishes services of each namespace into its own view,
+// namespaces with same value of labelKey share one view, services in shared
+// namespaces are published into default view and all the other views
+type viewIsolation struct {
+	labelKey         string
+	sharedNamespaces map[string]struct{}
+}
+
+func newViewIsolation(labelKey string, sharedNamespaces []string) *viewIsolation {
+	shared := make(map[string]struct{})
+	for _, ns := range sharedNamespaces {
+		shared[ns] = struct{}{}
+	}
+	return &viewIsolation{
+		labelKey:         labelKey,
+		sharedNamespaces: shared,
+	}
+}
+
+func (v *viewIsolation) isShared(namespace string) bool {
+	_, ok := v.sharedNamespaces[namespace]
+	return ok
+}
+
+func (c *Controller) getViews(namespace string) ([]string, error) {
+	if c.viewIsolation == nil {
+		return []string{DefaultView}, nil
+	}
+
+	if c.viewIsolation.isShared(namespace) {
+		return append([]string{DefaultView}, c.client.getServiceViews()...), nil
+	}
+
+	view := c.getNamespaceView(namespace)
+	created, err := c.client.ensureServiceZoneInView(view)
+	if err != nil {
+		return nil, fmt.Errorf("create service zone in view %s failed:%s", view, err.Error())
+	}
+	if created {
+		c.syncSharedNamespaces()
+	}
+	return []string{view}, nil
+}
+
+func (c *Controller) getNamespaceView(namespace string) string {
+	if c.viewIsolation.labelKey == "" {
+		return namespace
+	}
+
+	var ns corev1.Namespace
+	if err := c.cache.Get(context.TODO(), types.NamespacedName{Name: namespace}, &ns); err == nil {
+		if view, ok := ns.Labels[c.viewIsolation.labelKey]; ok && view != "" {
+			return view
+		}
+	}
+	return namespace
+}
+
+// new view should has all the records of shared namespaces
+func (c *Controller) syncSharedNamespaces() {
+	for namespace := range c.viewIsolation.sharedNamespaces {
+		var services corev1.ServiceList
+		if err := c.cache.List(context.TODO(), &client.ListOptions{Namespace: namespace}, &services); err != nil {
+			log.Printf("list services in namespace %s failed:%s", namespace, err.Error())
+			continue
+		}
+
+		for _, svc := range services.Items {
+			c.enqueueService(svc.Namespace, svc.Name)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/zdnscloud/g53"
+)
+
+// ptr of service in isolated namespace is only visible in its view
+func TestViewIsolationPTR(t *testing.T) {
+	env := newTestEnvWithOptions(t, Options{ViewIsolation: true, SharedNamespaces: []string{"shared"}})
+	defer env.close()
+
+	env.run(step{createEvent, clusterIPService("a", "web", "10.43.0.5")})
+	env.run(step{createEvent, clusterIPService("shared", "db", "10.43.0.6")})
+
+	store := env.server.Store()
+	reverseZone := "43.10.in-addr.arpa"
+	for _, c := range []struct {
+		view    string
+		ip      string
+		visible bool
+	}{
+		{"a", "5.0", true},
+		{"a", "6.0", true},
+		{DefaultView, "5.0", false},
+		{DefaultView, "6.0", true},
+	} {
+		ptr := store.GetRRset(c.view, reverseZone, g53.NameFromStringUnsafe(c.ip+"."+reverseZone), g53.RR_PTR)
+		if (ptr != nil) != c.visible {
+			t.Errorf("ptr %s in view %q should be visible:%v", c.ip, c.view, c.visible)
+		}
+	}
+
+	env.run(step{deleteEvent, clusterIPService("a", "web", "10.43.0.5")})
+	if store.GetRRset("a", reverseZone, g53.NameFromStringUnsafe("5.0."+reverseZone), g53.RR_PTR) != nil {
+		t.Errorf("ptr of deleted service should be removed from view")
+	}
+}
@@ -16,3 +16,12 @@ const PodReverseZoneTemplate = `
 {{.origin}} {{.ttl}} IN NS ns.dns.{{.origin}}
 ns.dns.{{.origin}} {{.ttl}} IN A {{.clusterDnsService}}
 `
+const CustomZoneTemplate = `
+{{.origin}} {{.ttl}} IN SOA {{.mname}} {{.rname}} {{.serial}} {{.refresh}} {{.retry}} {{.expire}} {{.minimum}}
+{{- range .nameServers}}
+{{$.origin}} {{$.ttl}} IN NS {{.name}}
+{{- if .ip}}
+{{.name}} {{$.ttl}} IN A {{.ip}}
+{{- end}}
+{{- end}}
+`
@@ -0,0 +1,128 @@
+package crd
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *DNSZone) DeepCopyInto(out *DNSZone) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *DNSZone) DeepCopy() *DNSZone {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DNSZone) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *DNSZoneSpec) DeepCopyInto(out *DNSZoneSpec) {
+	*out = *in
+	if in.NameServers != nil {
+		out.NameServers = make([]NameServer, len(in.NameServers))
+		copy(out.NameServers, in.NameServers)
+	}
+}
+
+func (in *DNSZoneList) DeepCopyInto(out *DNSZoneList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]DNSZone, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *DNSZoneList) DeepCopy() *DNSZoneList {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSZoneList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DNSZoneList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *DNSRecord) DeepCopyInto(out *DNSRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *DNSRecord) DeepCopy() *DNSRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DNSRecord) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *DNSRecordSpec) DeepCopyInto(out *DNSRecordSpec) {
+	*out = *in
+	if in.Rdatas != nil {
+		out.Rdatas = make([]string, len(in.Rdatas))
+		copy(out.Rdatas, in.Rdatas)
+	}
+}
+
+func (in *DNSRecordList) DeepCopyInto(out *DNSRecordList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]DNSRecord, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *DNSRecordList) DeepCopy() *DNSRecordList {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSRecordList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DNSRecordList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *Status) DeepCopyInto(out *Status) {
+	*out = *in
+	if in.Conditions != nil {
+		out.Conditions = make([]Condition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+func (in *Condition) DeepCopyInto(out *Condition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
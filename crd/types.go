@@ -0,0 +1,88 @@
+package crd
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConditionReady = "Ready"
+
+	ReasonSynced    = "Synced"
+	ReasonSyncError = "SyncError"
+)
+
+type DNSZone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSZoneSpec `json:"spec"`
+	Status Status      `json:"status,omitempty"`
+}
+
+type DNSZoneSpec struct {
+	Zone        string       `json:"zone"`
+	TTL         uint32       `json:"ttl,omitempty"`
+	SOA         SOA          `json:"soa"`
+	NameServers []NameServer `json:"nameServers"`
+}
+
+type SOA struct {
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Serial  uint32 `json:"serial,omitempty"`
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	Minimum uint32 `json:"minimum,omitempty"`
+}
+
+// IP is optional, it's only needed when the name server is inside the zone
+type NameServer struct {
+	Name string `json:"name"`
+	IP   string `json:"ip,omitempty"`
+}
+
+type DNSZoneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DNSZone `json:"items"`
+}
+
+// Zone is optional, the closest managed zone is used if it's empty
+type DNSRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DNSRecordSpec `json:"spec"`
+	Status Status        `json:"status,omitempty"`
+}
+
+type DNSRecordSpec struct {
+	Zone   string   `json:"zone,omitempty"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    uint32   `json:"ttl,omitempty"`
+	Rdatas []string `json:"rdatas"`
+}
+
+type DNSRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DNSRecord `json:"items"`
+}
+
+type Status struct {
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+type Condition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zdnscloud/vanguard2-controller/controller"
+)
+
+// runDiff loads the config like the controller, so the desired state is
+// generated with the same naming, ttl, scope and views
+func runDiff(args []string) error {
+	var kubeconfig, configFile, configMap string
+	var apply bool
+	var xfr controller.XFRConfig
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	newBase := configFlags(fs)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "path to kubeconfig, only required if out-of-cluster")
+	fs.StringVar(&configFile, "config", "", "yaml or json config file of the controller, its fields override the flags")
+	fs.StringVar(&configMap, "config-map", "", "load config from config map in format namespace/name[:key] instead of file")
+	fs.StringVar(&xfr.Server, "xfr-server", "127.0.0.1:53", "dns server address to transfer zones from")
+	fs.StringVar(&xfr.TSIGKey, "tsig-key", "", "tsig key name to sign zone transfer")
+	fs.StringVar(&xfr.TSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	fs.StringVar(&xfr.TSIGAlgorithm, "tsig-algorithm", "hmac-md5", "tsig algorithm")
+	fs.BoolVar(&apply, "apply", false, "update the server to match the desired state")
+	fs.Parse(args)
+
+	if kubeconfig != "" {
+		flag.Set("kubeconfig", kubeconfig)
+	}
+
+	cfg, err := loadConfig(configFile, configMap, newBase())
+	if err != nil {
+		return err
+	}
+
+	client, err := newVgClient(cfg, nil, false)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctl, err := controller.NewK8sController(client, controllerOptions(cfg))
+	if err != nil {
+		return err
+	}
+
+	diffs, err := ctl.Diff(xfr)
+	if err != nil {
+		return err
+	}
+
+	view, zone := "", ""
+	for i, diff := range diffs {
+		if i == 0 || diff.View != view || diff.Zone != zone {
+			view, zone = diff.View, diff.Zone
+			fmt.Fprintf(os.Stdout, "; view %s zone %s\n", view, zone)
+		}
+		fmt.Fprintln(os.Stdout, diff.String())
+	}
+
+	if apply && len(diffs) != 0 {
+		return ctl.ApplyDiff(diffs)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package fakeserver
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+)
+
+// Server is an in process vanguard2 grpc server, zones are kept in a memory
+// store which could be inspected directly
+type Server struct {
+	pb.UnimplementedDynamicUpdateInterfaceServer
+	store    *memstore.Store
+	server   *grpc.Server
+	listener net.Listener
+}
+
+var _ pb.DynamicUpdateInterfaceServer = &Server{}
+
+func New() *Server {
+	return &Server{
+		store: memstore.New(),
+	}
+}
+
+// Start listens on addr and serves in background, addr could use port 0,
+// the real listening address is returned
+func (s *Server) Start(addr string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	s.listener = listener
+	s.server = grpc.NewServer()
+	pb.RegisterDynamicUpdateInterfaceServer(s.server, s)
+	go s.server.Serve(listener)
+	return listener.Addr().String(), nil
+}
+
+func (s *Server) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+func (s *Server) Store() *memstore.Store {
+	return s.store
+}
+
+func (s *Server) AddZone(ctx context.Context, req *pb.AddZoneRequest) (*pb.AddZoneResponse, error) {
+	return s.store.AddZone(ctx, req)
+}
+
+func (s *Server) DeleteZone(ctx context.Context, req *pb.DeleteZoneRequest) (*pb.DeleteZoneResponse, error) {
+	return s.store.DeleteZone(ctx, req)
+}
+
+func (s *Server) AddRRset(ctx context.Context, req *pb.AddRRsetRequest) (*pb.AddRRsetResponse, error) {
+	return s.store.AddRRset(ctx, req)
+}
+
+func (s *Server) DeleteDomain(ctx context.Context, req *pb.DeleteDomainRequest) (*pb.DeleteDomainResponse, error) {
+	return s.store.DeleteDomain(ctx, req)
+}
+
+func (s *Server) DeleteRRset(ctx context.Context, req *pb.DeleteRRsetRequest) (*pb.DeleteRRsetResponse, error) {
+	return s.store.DeleteRRset(ctx, req)
+}
+
+func (s *Server) DeleteRdata(ctx context.Context, req *pb.DeleteRdataRequest) (*pb.DeleteRdataResponse, error) {
+	return s.store.DeleteRdata(ctx, req)
+}
+
+func (s *Server) UpdateRdata(ctx context.Context, req *pb.UpdateRdataRequest) (*pb.UpdateRdataResponse, error) {
+	return s.store.UpdateRdata(ctx, req)
+}
@@ -2,27 +2,131 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
 
+	k8sclient "github.com/zdnscloud/gok8s/client"
+	k8sconfig "github.com/zdnscloud/gok8s/client/config"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
 	"github.com/zdnscloud/vanguard2-controller/controller"
 )
 
 func main() {
-	var grpcServer, clusterDomain, serviceIPRange, podIPRange, serverAddress string
-	flag.StringVar(&grpcServer, "grpc-server", "127.0.0.1:5555", "vanguard2 grpc server address")
-	flag.StringVar(&clusterDomain, "cluster-domain", "", "k8s cluster domain")
-	flag.StringVar(&serviceIPRange, "service-ip-range", "", "service ip range")
-	flag.StringVar(&podIPRange, "pod-ip-range", "", "pod ip range")
-	flag.StringVar(&serverAddress, "dns-server", "", "k8s dns service address")
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := runRender(os.Args[2:]); err != nil {
+			log.Fatalf("render failed:%s", err.Error())
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "conformance" {
+		if err := runConformance(os.Args[2:]); err != nil {
+			log.Fatalf("conformance check failed:%s", err.Error())
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := runDiff(os.Args[2:]); err != nil {
+			log.Fatalf("diff failed:%s", err.Error())
+		}
+		return
+	}
+	os.Exit(runController())
+}
+
+// runController returns the exit code after deferred cleanups are done, it's
+// 1 if the controller fails to start or changes aren't synced on shutdown
+func runController() int {
+	newBase := configFlags(flag.CommandLine)
+	var clustersetDomain, memberKubeconfigs, debugAddr, dryRunOutput, configFile, configMap string
+	var dryRun, autoDetect, guessIPRanges bool
+	var dnsServices, domainSources string
+	var configInterval, shutdownGrace time.Duration
+	var xfr controller.XFRConfig
+	flag.StringVar(&clustersetDomain, "clusterset-domain", "", "publish exported services of all member clusters under this domain, like clusterset.local")
+	flag.StringVar(&memberKubeconfigs, "member-kubeconfigs", "", "comma separated kubeconfigs of other member clusters, each one could be prefixed with cluster name like east=/path/to/kubeconfig")
+	flag.StringVar(&debugAddr, "debug-addr", "", "address to serve debug api, disabled if empty")
+	flag.StringVar(&xfr.Server, "xfr-server", "127.0.0.1:53", "dns server address to transfer zones from for debug diff and garbage collection of shared zones")
+	flag.StringVar(&xfr.TSIGKey, "tsig-key", "", "tsig key name to sign zone transfer")
+	flag.StringVar(&xfr.TSIGSecret, "tsig-secret", "", "base64 encoded tsig secret")
+	flag.StringVar(&xfr.TSIGAlgorithm, "tsig-algorithm", "hmac-md5", "tsig algorithm")
+	flag.BoolVar(&dryRun, "dry-run", false, "don't update vanguard2, log the changes instead")
+	flag.StringVar(&dryRunOutput, "dry-run-output", "", "file to append changes as json lines in dry run mode, changes are logged if it's empty")
+	flag.BoolVar(&autoDetect, "auto-detect", false, "detect cluster domain, ip ranges and dns server which aren't specified from the cluster")
+	flag.StringVar(&dnsServices, "dns-services", strings.Join(config.DefaultDNSServices, ","), "comma separated services in format namespace/name, cluster ip of the first existing one is detected as dns server")
+	flag.BoolVar(&guessIPRanges, "guess-ip-ranges", false, "with auto-detect, guess service ip range as the /16 network of kubernetes service ip if it isn't configured in the cluster")
+	flag.StringVar(&domainSources, "cluster-domain-source", strings.Join(config.DefaultDomainSources, ","), "comma separated sources to detect cluster domain in order, supported sources are kubeadm, coredns and resolv-conf")
+	flag.StringVar(&configFile, "config", "", "yaml or json config file, its fields override the flags and changes are applied without restart")
+	flag.StringVar(&configMap, "config-map", "", "load config from config map in format namespace/name[:key] instead of file")
+	flag.DurationVar(&configInterval, "config-interval", 10*time.Second, "interval to check changes of config")
+	flag.DurationVar(&shutdownGrace, "shutdown-grace", 20*time.Second, "time to sync the queued services after SIGTERM, it should be shorter than the termination grace period of pod")
 	flag.Parse()
 
-	log.Printf("start with: clusterDomain:%s, serviceIPRange:%s, podIPRange:%s, serverAddress:%s", clusterDomain, serviceIPRange, podIPRange, serverAddress)
+	base := newBase()
+	if autoDetect {
+		cli, err := newK8sClient()
+		if err != nil {
+			log.Printf("create k8s client failed:%s", err.Error())
+			return 1
+		}
+		detector := &config.Detector{
+			Client:        cli,
+			DNSServices:   splitList(dnsServices),
+			DomainSources: splitList(domainSources),
+			GuessIPRanges: guessIPRanges,
+		}
+		if err := detector.Detect(&base); err != nil {
+			log.Printf("auto detect incomplete:%s", err.Error())
+		}
+	}
+
+	cfg := &base
+	var watcher *config.Watcher
+	if src, err := configSource(configFile, configMap); err != nil {
+		log.Printf("create config source failed:%s", err.Error())
+		return 1
+	} else if src != nil {
+		watcher, cfg, err = config.NewWatcher(src, base)
+		if err != nil {
+			log.Printf("%s", err.Error())
+			return 1
+		}
+	} else if autoDetect {
+		if err := cfg.Validate(); err != nil {
+			log.Printf("config is invalid:%s", err.Error())
+			return 1
+		}
+	}
+
+	log.Printf("start with: clusterDomain:%s, serviceIPRange:%s, podIPRange:%s, serverAddress:%s", cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer)
+
+	var dryRunBackend *controller.DryRunBackend
+	if dryRun {
+		var out io.Writer
+		if dryRunOutput != "" {
+			f, err := os.OpenFile(dryRunOutput, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				log.Printf("open dry run output failed:%s", err.Error())
+				return 1
+			}
+			defer f.Close()
+			out = f
+		}
+		dryRunBackend = controller.NewDryRunBackend(out)
+	}
 
 	var client *controller.VgClient
 	for {
 		var err error
-		client, err = controller.NewVgClient(grpcServer, clusterDomain, serviceIPRange, podIPRange, serverAddress)
+		client, err = newVgClient(cfg, dryRunBackend, true)
 		if err != nil {
 			log.Printf("create vangaurd2 client failed:%s", err.Error())
 		} else {
@@ -32,10 +136,262 @@ func main() {
 	}
 	log.Printf("finish initialize zone\n")
 
-	ctl, err := controller.NewK8sController(client)
+	//client is closed by shutdown of controller once it's running
+	ctl, err := controller.NewK8sController(client, controllerOptions(cfg))
 	if err != nil {
 		log.Printf("create k8s controller failed:%s", err.Error())
-		return
+		client.Close()
+		return 1
+	}
+
+	var mc *controller.MultiClusterController
+	mcStopped := make(chan struct{})
+	if clustersetDomain != "" {
+		mc, err = controller.NewMultiClusterController(ctl, clustersetDomain, splitList(memberKubeconfigs))
+		if err != nil {
+			log.Printf("create multi cluster controller failed:%s", err.Error())
+			client.Close()
+			return 1
+		}
+		go func() {
+			mc.Run()
+			close(mcStopped)
+		}()
+	}
+
+	stopWatcher := make(chan struct{})
+	if watcher != nil {
+		current := cfg
+		go watcher.Run(configInterval, stopWatcher, func(cfg *config.Config) {
+			var newClient *controller.VgClient
+			if isClientConfigChanged(current, cfg) {
+				if clustersetDomain != "" {
+					log.Printf("zones and backend can't be changed without restart in multi cluster mode")
+					return
+				}
+				//zones are initialized by reload, so live zones are kept until then
+				c, err := newVgClient(cfg, dryRunBackend, false)
+				if err != nil {
+					log.Printf("create vanguard2 client with new config failed:%s", err.Error())
+					return
+				}
+				newClient = c
+			}
+			if err := ctl.Reload(newClient, controllerOptions(cfg)); err != nil {
+				log.Printf("apply new config failed:%s", err.Error())
+				if newClient != nil {
+					newClient.Close()
+				}
+				return
+			}
+			current = cfg
+			log.Printf("new config is applied")
+		})
+	}
+
+	if debugAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(debugAddr, ctl.DebugHandler(xfr)); err != nil {
+				log.Printf("serve debug api failed:%s", err.Error())
+			}
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go ctl.Run()
+	go func() {
+		if err := ctl.CollectGarbage(xfr); err != nil {
+			log.Printf("collect garbage failed:%s", err.Error())
+		}
+	}()
+	sig := <-signals
+	log.Printf("receive signal %s, shutdown in %s", sig.String(), shutdownGrace.String())
+
+	deadline := time.Now().Add(shutdownGrace)
+	close(stopWatcher)
+	if mc != nil {
+		mc.Stop()
+		select {
+		case <-mcStopped:
+		case <-time.After(time.Until(deadline)):
+			log.Printf("multi cluster controller doesn't stop in %s", shutdownGrace.String())
+		}
+	}
+	if err := ctl.Shutdown(time.Until(deadline)); err != nil {
+		log.Printf("shutdown with unsynced changes:%s", err.Error())
+		return 1
+	}
+	log.Printf("all changes are synced, exit")
+	return 0
+}
+
+// configFlags registers the flags of config fields on fs, the returned
+// function builds the config from them after fs is parsed
+func configFlags(fs *flag.FlagSet) func() config.Config {
+	var base config.Config
+	var ingressTarget, sharedNamespaces, includeNamespaces, excludeNamespaces, clusterDomainAliases string
+	var ttl uint
+	fs.StringVar(&base.GRPCServer, "grpc-server", "127.0.0.1:5555", "vanguard2 grpc server address")
+	fs.StringVar(&base.ClusterDomain, "cluster-domain", "", "k8s cluster domain")
+	fs.StringVar(&clusterDomainAliases, "cluster-domain-aliases", "", "comma separated domains where records of cluster domain are published as well")
+	fs.StringVar(&base.ServiceIPRange, "service-ip-range", "", "comma separated networks of service ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&base.PodIPRange, "pod-ip-range", "", "comma separated networks of pod ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&base.DNSServer, "dns-server", "", "k8s dns service address")
+	fs.StringVar(&base.OwnerID, "owner-id", "", "only modify records owned by this id and keep records of other writers, zones are wiped on start if it's empty")
+	fs.StringVar(&base.OwnerQueryServer, "owner-query-server", "127.0.0.1:53", "dns server address to query record owners")
+	fs.UintVar(&ttl, "ttl", 0, "ttl of generated records, default ttl is used if it's 0")
+	fs.BoolVar(&base.Features.WatchIngress, "watch-ingress", false, "publish ingress hosts")
+	fs.StringVar(&ingressTarget, "ingress-target", "", "cname target for ingress hosts, use ingress load balancer ips if empty")
+	fs.BoolVar(&base.Features.WatchDNSResource, "watch-dns-resource", false, "manage zones and records from DNSZone and DNSRecord resources")
+	fs.BoolVar(&base.Features.ViewIsolation, "view-isolation", false, "publish services of each namespace into its own view")
+	fs.StringVar(&base.Features.ViewLabel, "view-label", "", "namespace label whose value is used as view name, namespaces with same value share one view")
+	fs.StringVar(&sharedNamespaces, "shared-namespaces", "kube-system,default", "comma separated namespaces whose services are visible in all views")
+	fs.IntVar(&base.Workers, "workers", 4, "number of services reconciled concurrently")
+	fs.DurationVar((*time.Duration)(&base.EndpointsWindow), "endpoints-window", 500*time.Millisecond, "coalesce endpoints updates of a service until it keeps unchanged for this long, 0 to disable")
+	fs.DurationVar((*time.Duration)(&base.EndpointsMaxWait), "endpoints-max-wait", 5*time.Second, "max delay of coalesced endpoints updates")
+	fs.BoolVar(&base.CanonicalPTR, "canonical-ptr", false, "ip shared by several names only points to the first one in alphabetical order")
+	fs.BoolVar(&base.FlattenExternalNames, "flatten-external-names", false, "publish addresses of the target instead of cname for ExternalName services pointing to names in managed zones")
+	fs.BoolVar(&base.Features.WatchPods, "watch-pods", false, "publish pods with hostname and subdomain under headless services, even before they are ready")
+	fs.StringVar(&includeNamespaces, "include-namespaces", "", "comma separated namespaces, only services in them are published if it isn't empty")
+	fs.StringVar(&excludeNamespaces, "exclude-namespaces", "", "comma separated namespaces whose services are ignored")
+	fs.StringVar(&base.Namespaces.Selector, "namespace-selector", "", "label selector of namespaces whose services are published")
+	fs.StringVar(&base.ServiceSelector, "service-selector", "", "label selector of services which are published")
+
+	return func() config.Config {
+		cfg := base
+		cfg.TTL = uint32(ttl)
+		cfg.IngressTarget = ingressTarget
+		cfg.Features.SharedNamespaces = splitList(sharedNamespaces)
+		cfg.ClusterDomainAliases = splitList(clusterDomainAliases)
+		cfg.Namespaces.Include = splitList(includeNamespaces)
+		cfg.Namespaces.Exclude = splitList(excludeNamespaces)
+		return cfg
+	}
+}
+
+// loadConfig loads the config once like the controller does, fields in the
+// file or config map override base
+func loadConfig(file, configMap string, base config.Config) (*config.Config, error) {
+	src, err := configSource(file, configMap)
+	if err != nil {
+		return nil, err
+	} else if src == nil {
+		return &base, base.Validate()
+	}
+	data, err := src.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load config from %s failed:%s", src.String(), err.Error())
+	}
+	return config.Parse(data, base)
+}
+
+func configSource(file, configMap string) (config.Source, error) {
+	if file != "" && configMap != "" {
+		return nil, fmt.Errorf("config and config-map are exclusive")
+	}
+	if file != "" {
+		return config.FileSource(file), nil
+	}
+	if configMap == "" {
+		return nil, nil
+	}
+
+	key := config.DefaultConfigMapKey
+	if i := strings.Index(configMap, ":"); i != -1 {
+		configMap, key = configMap[:i], configMap[i+1:]
+	}
+	parts := strings.Split(configMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || key == "" {
+		return nil, fmt.Errorf("config map %q isn't in format namespace/name[:key]", configMap)
+	}
+	cli, err := newK8sClient()
+	if err != nil {
+		return nil, err
+	}
+	return &config.ConfigMapSource{
+		Client:    cli,
+		Namespace: parts[0],
+		Name:      parts[1],
+		Key:       key,
+	}, nil
+}
+
+func newK8sClient() (k8sclient.Client, error) {
+	k8sCfg, err := k8sconfig.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return k8sclient.New(k8sCfg, k8sclient.Options{})
+}
+
+// zones of client which isn't initialized are initialized when it's passed
+// to Reload
+func newVgClient(cfg *config.Config, dryRunBackend *controller.DryRunBackend, initZones bool) (*controller.VgClient, error) {
+	var client *controller.VgClient
+	var err error
+	switch {
+	case dryRunBackend != nil && initZones:
+		client, err = controller.NewVgClientWithBackend(dryRunBackend, cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer, cfg.OwnerID, cfg.OwnerQueryServer)
+	case dryRunBackend != nil:
+		client, err = controller.NewUninitializedVgClient(dryRunBackend, cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer, cfg.OwnerID, cfg.OwnerQueryServer)
+	case initZones:
+		client, err = controller.NewVgClient(cfg.GRPCServer, cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer, cfg.OwnerID, cfg.OwnerQueryServer)
+	default:
+		client, err = controller.DialVgClient(cfg.GRPCServer, cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer, cfg.OwnerID, cfg.OwnerQueryServer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.SetNamingSchemes(cfg.Naming); err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := client.SetClusterDomainAliases(cfg.ClusterDomainAliases); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// zones, naming and backend are owned by vanguard2 client, it's replaced when they change
+func isClientConfigChanged(old, new *config.Config) bool {
+	return old.ClusterDomain != new.ClusterDomain ||
+		reflect.DeepEqual(old.ClusterDomainAliases, new.ClusterDomainAliases) == false ||
+		old.ServiceIPRange != new.ServiceIPRange ||
+		old.PodIPRange != new.PodIPRange ||
+		old.DNSServer != new.DNSServer ||
+		old.GRPCServer != new.GRPCServer ||
+		old.OwnerID != new.OwnerID ||
+		old.OwnerQueryServer != new.OwnerQueryServer ||
+		reflect.DeepEqual(old.Naming, new.Naming) == false
+}
+
+func controllerOptions(cfg *config.Config) controller.Options {
+	return controller.Options{
+		WatchIngress:         cfg.Features.WatchIngress,
+		IngressTarget:        cfg.IngressTarget,
+		WatchDNSResource:     cfg.Features.WatchDNSResource,
+		ViewIsolation:        cfg.Features.ViewIsolation,
+		ViewLabel:            cfg.Features.ViewLabel,
+		SharedNamespaces:     cfg.Features.SharedNamespaces,
+		Workers:              cfg.Workers,
+		EndpointsWindow:      time.Duration(cfg.EndpointsWindow),
+		EndpointsMaxWait:     time.Duration(cfg.EndpointsMaxWait),
+		CanonicalPTR:         cfg.CanonicalPTR,
+		WatchPods:            cfg.Features.WatchPods,
+		TTL:                  cfg.TTL,
+		IncludeNamespaces:    cfg.Namespaces.Include,
+		ExcludeNamespaces:    cfg.Namespaces.Exclude,
+		NamespaceSelector:    cfg.Namespaces.Selector,
+		ServiceSelector:      cfg.ServiceSelector,
+		FlattenExternalNames: cfg.FlattenExternalNames,
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
 	}
-	ctl.Run()
+	return strings.Split(s, ",")
 }
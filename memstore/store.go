@@ -0,0 +1,392 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zdnscloud/g53"
+	"google.golang.org/grpc"
+
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+// Store keeps zones in memory and implements the vanguard2 dynamic update
+// interface with the same semantics as the server
+type Store struct {
+	lock  sync.RWMutex
+	zones map[zoneKey]*zone
+}
+
+type zoneKey struct {
+	view string
+	name string
+}
+
+type zone struct {
+	name   *g53.Name
+	rrsets map[rrsetKey]*g53.RRset
+}
+
+type rrsetKey struct {
+	name string
+	typ  g53.RRType
+}
+
+var _ pb.DynamicUpdateInterfaceClient = &Store{}
+
+func New() *Store {
+	return &Store{
+		zones: make(map[zoneKey]*zone),
+	}
+}
+
+func (s *Store) AddZone(ctx context.Context, in *pb.AddZoneRequest, opts ...grpc.CallOption) (*pb.AddZoneResponse, error) {
+	name, err := g53.NameFromString(in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &zone{
+		name:   name,
+		rrsets: make(map[rrsetKey]*g53.RRset),
+	}
+	for _, line := range strings.Split(in.ZoneContent, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rrset, err := g53.RRsetFromString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rr %s:%s", line, err.Error())
+		}
+		if err := z.addRRset(rrset); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := z.rrsets[rrsetKey{name.String(false), g53.RR_SOA}]; ok == false {
+		return nil, fmt.Errorf("zone %s has no soa", in.Zone)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := zoneKey{in.View, name.String(false)}
+	if _, ok := s.zones[key]; ok {
+		return nil, fmt.Errorf("zone %s already exists", in.Zone)
+	}
+	s.zones[key] = z
+	return &pb.AddZoneResponse{}, nil
+}
+
+func (s *Store) DeleteZone(ctx context.Context, in *pb.DeleteZoneRequest, opts ...grpc.CallOption) (*pb.DeleteZoneResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, zoneName := range in.Zones {
+		name, err := g53.NameFromString(zoneName)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.zones, zoneKey{in.View, name.String(false)})
+	}
+	return &pb.DeleteZoneResponse{}, nil
+}
+
+func (s *Store) AddRRset(ctx context.Context, in *pb.AddRRsetRequest, opts ...grpc.CallOption) (*pb.AddRRsetResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.getZone(in.View, in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range in.Rrsets {
+		rrset, err := rrsetFromPB(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := z.addRRset(rrset); err != nil {
+			return nil, err
+		}
+	}
+	return &pb.AddRRsetResponse{}, nil
+}
+
+func (s *Store) DeleteDomain(ctx context.Context, in *pb.DeleteDomainRequest, opts ...grpc.CallOption) (*pb.DeleteDomainResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.getZone(in.View, in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range in.Names {
+		name, err := g53.NameFromString(n)
+		if err != nil {
+			return nil, err
+		}
+		for key := range z.rrsets {
+			if key.name == name.String(false) {
+				delete(z.rrsets, key)
+			}
+		}
+	}
+	return &pb.DeleteDomainResponse{}, nil
+}
+
+func (s *Store) DeleteRRset(ctx context.Context, in *pb.DeleteRRsetRequest, opts ...grpc.CallOption) (*pb.DeleteRRsetResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.getZone(in.View, in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range in.Rrsets {
+		name, err := g53.NameFromString(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := rrTypeFromPB(header.Type)
+		if err != nil {
+			return nil, err
+		}
+		delete(z.rrsets, rrsetKey{name.String(false), typ})
+	}
+	return &pb.DeleteRRsetResponse{}, nil
+}
+
+func (s *Store) DeleteRdata(ctx context.Context, in *pb.DeleteRdataRequest, opts ...grpc.CallOption) (*pb.DeleteRdataResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.getZone(in.View, in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range in.Rrsets {
+		rrset, err := rrsetFromPB(r)
+		if err != nil {
+			return nil, err
+		}
+		z.deleteRdata(rrset)
+	}
+	return &pb.DeleteRdataResponse{}, nil
+}
+
+func (s *Store) UpdateRdata(ctx context.Context, in *pb.UpdateRdataRequest, opts ...grpc.CallOption) (*pb.UpdateRdataResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z, err := s.getZone(in.View, in.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	oldRRset, err := rrsetFromPB(in.OldRrset)
+	if err != nil {
+		return nil, err
+	}
+	newRRset, err := rrsetFromPB(in.NewRrset)
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := z.rrsets[keyOfRRset(oldRRset)]
+	if ok == false || current.Equals(oldRRset) == false {
+		return nil, fmt.Errorf("rrset %s %s doesn't match old rrset", oldRRset.Name.String(false), oldRRset.Type.String())
+	}
+	delete(z.rrsets, keyOfRRset(oldRRset))
+	if err := z.addRRset(newRRset); err != nil {
+		z.rrsets[keyOfRRset(oldRRset)] = current
+		return nil, err
+	}
+	return &pb.UpdateRdataResponse{}, nil
+}
+
+func (s *Store) getZone(view, zoneName string) (*zone, error) {
+	name, err := g53.NameFromString(zoneName)
+	if err != nil {
+		return nil, err
+	}
+	z, ok := s.zones[zoneKey{view, name.String(false)}]
+	if ok == false {
+		return nil, fmt.Errorf("zone %s doesn't exist", zoneName)
+	}
+	return z, nil
+}
+
+func (z *zone) addRRset(rrset *g53.RRset) error {
+	relation := rrset.Name.Compare(z.name, false).Relation
+	if relation != g53.EQUAL && relation != g53.SUBDOMAIN {
+		return fmt.Errorf("%s is out of zone %s", rrset.Name.String(false), z.name.String(false))
+	}
+
+	key := keyOfRRset(rrset)
+	if rrset.Type == g53.RR_CNAME {
+		for k := range z.rrsets {
+			if k.name == key.name && k.typ != g53.RR_CNAME {
+				return fmt.Errorf("cname %s coexists with other data", key.name)
+			}
+		}
+	} else if _, ok := z.rrsets[rrsetKey{key.name, g53.RR_CNAME}]; ok {
+		return fmt.Errorf("%s already has cname", key.name)
+	}
+
+	current, ok := z.rrsets[key]
+	if ok == false {
+		z.rrsets[key] = rrset.Clone()
+		return nil
+	}
+
+	current.Ttl = rrset.Ttl
+	for _, rdata := range rrset.Rdatas {
+		current.AddRdata(rdata)
+	}
+	return nil
+}
+
+func (z *zone) deleteRdata(rrset *g53.RRset) {
+	key := keyOfRRset(rrset)
+	current, ok := z.rrsets[key]
+	if ok == false {
+		return
+	}
+
+	for _, rdata := range rrset.Rdatas {
+		current.RemoveRdata(rdata)
+	}
+	if len(current.Rdatas) == 0 {
+		delete(z.rrsets, key)
+	}
+}
+
+// Views return all the views which have zones, default view is empty string
+func (s *Store) Views() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var views []string
+	for key := range s.zones {
+		if util.HasString(views, key.view) == false {
+			views = append(views, key.view)
+		}
+	}
+	sort.Strings(views)
+	return views
+}
+
+func (s *Store) Zones(view string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var zones []string
+	for key := range s.zones {
+		if key.view == view {
+			zones = append(zones, key.name)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// RRsets return copy of all the rrsets in the zone, soa is the first one
+// and the others are sorted by name and type
+func (s *Store) RRsets(view, zoneName string) ([]*g53.RRset, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	z, err := s.getZone(view, zoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	rrsets := make([]*g53.RRset, 0, len(z.rrsets))
+	for _, rrset := range z.rrsets {
+		rrset = rrset.Clone()
+		rrset.SortRdata()
+		rrsets = append(rrsets, rrset)
+	}
+	sort.Slice(rrsets, func(i, j int) bool {
+		ri, rj := rrsets[i], rrsets[j]
+		if (ri.Type == g53.RR_SOA) != (rj.Type == g53.RR_SOA) {
+			return ri.Type == g53.RR_SOA
+		}
+		if order := ri.Name.Compare(rj.Name, false).Order; order != 0 {
+			return order < 0
+		}
+		return ri.Type < rj.Type
+	})
+	return rrsets, nil
+}
+
+// GetRRset return nil if the rrset doesn't exist
+func (s *Store) GetRRset(view, zoneName string, name *g53.Name, typ g53.RRType) *g53.RRset {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	z, err := s.getZone(view, zoneName)
+	if err != nil {
+		return nil
+	}
+	if rrset, ok := z.rrsets[rrsetKey{name.String(false), typ}]; ok {
+		return rrset.Clone()
+	}
+	return nil
+}
+
+// ZoneString return zone content in master file format
+func (s *Store) ZoneString(view, zoneName string) (string, error) {
+	rrsets, err := s.RRsets(view, zoneName)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	for _, rrset := range rrsets {
+		buf.WriteString(rrset.String())
+	}
+	return buf.String(), nil
+}
+
+func rrsetFromPB(r *pb.RRset) (*g53.RRset, error) {
+	if r == nil {
+		return nil, fmt.Errorf("rrset is empty")
+	}
+
+	name, err := g53.NameFromString(r.Name)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := rrTypeFromPB(r.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	rrset := &g53.RRset{
+		Name:  name,
+		Type:  typ,
+		Class: g53.CLASS_IN,
+		Ttl:   g53.RRTTL(r.Ttl),
+	}
+	for _, s := range r.Rdatas {
+		rdata, err := g53.RdataFromString(typ, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rdata %s:%s", s, err.Error())
+		}
+		rrset.AddRdata(rdata)
+	}
+	if len(rrset.Rdatas) == 0 {
+		return nil, fmt.Errorf("rrset %s %s has no rdata", r.Name, typ.String())
+	}
+	return rrset, nil
+}
+
+func rrTypeFromPB(typ pb.RRType) (g53.RRType, error) {
+	name, ok := pb.RRType_name[int32(typ)]
+	if ok == false {
+		return 0, fmt.Errorf("unknown rr type %d", typ)
+	}
+	return g53.TypeFromString(name)
+}
+
+func keyOfRRset(rrset *g53.RRset) rrsetKey {
+	return rrsetKey{rrset.Name.String(false), rrset.Type}
+}
@@ -27,6 +27,7 @@ const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 type AddZoneRequest struct {
 	Zone                 string   `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	ZoneContent          string   `protobuf:"bytes,2,opt,name=zone_content,json=zoneContent,proto3" json:"zone_content,omitempty"`
+	View                 string   `protobuf:"bytes,3,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -71,6 +72,13 @@ func (m *AddZoneRequest) GetZoneContent() string {
 	return ""
 }
 
+func (m *AddZoneRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type AddZoneResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -104,6 +112,7 @@ var xxx_messageInfo_AddZoneResponse proto.InternalMessageInfo
 
 type DeleteZoneRequest struct {
 	Zones                []string `protobuf:"bytes,1,rep,name=zones,proto3" json:"zones,omitempty"`
+	View                 string   `protobuf:"bytes,2,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -141,6 +150,13 @@ func (m *DeleteZoneRequest) GetZones() []string {
 	return nil
 }
 
+func (m *DeleteZoneRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type DeleteZoneResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -175,6 +191,7 @@ var xxx_messageInfo_DeleteZoneResponse proto.InternalMessageInfo
 type AddRRsetRequest struct {
 	Zone                 string   `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	Rrsets               []*RRset `protobuf:"bytes,2,rep,name=rrsets,proto3" json:"rrsets,omitempty"`
+	View                 string   `protobuf:"bytes,3,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -219,6 +236,13 @@ func (m *AddRRsetRequest) GetRrsets() []*RRset {
 	return nil
 }
 
+func (m *AddRRsetRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type AddRRsetResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -253,6 +277,7 @@ var xxx_messageInfo_AddRRsetResponse proto.InternalMessageInfo
 type DeleteDomainRequest struct {
 	Zone                 string   `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	Names                []string `protobuf:"bytes,2,rep,name=names,proto3" json:"names,omitempty"`
+	View                 string   `protobuf:"bytes,3,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -297,6 +322,13 @@ func (m *DeleteDomainRequest) GetNames() []string {
 	return nil
 }
 
+func (m *DeleteDomainRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type DeleteDomainResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -331,6 +363,7 @@ var xxx_messageInfo_DeleteDomainResponse proto.InternalMessageInfo
 type DeleteRRsetRequest struct {
 	Zone                 string         `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	Rrsets               []*RRsetHeader `protobuf:"bytes,2,rep,name=rrsets,proto3" json:"rrsets,omitempty"`
+	View                 string         `protobuf:"bytes,3,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
 	XXX_unrecognized     []byte         `json:"-"`
 	XXX_sizecache        int32          `json:"-"`
@@ -375,6 +408,13 @@ func (m *DeleteRRsetRequest) GetRrsets() []*RRsetHeader {
 	return nil
 }
 
+func (m *DeleteRRsetRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type DeleteRRsetResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -409,6 +449,7 @@ var xxx_messageInfo_DeleteRRsetResponse proto.InternalMessageInfo
 type DeleteRdataRequest struct {
 	Zone                 string   `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	Rrsets               []*RRset `protobuf:"bytes,2,rep,name=rrsets,proto3" json:"rrsets,omitempty"`
+	View                 string   `protobuf:"bytes,3,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -453,6 +494,13 @@ func (m *DeleteRdataRequest) GetRrsets() []*RRset {
 	return nil
 }
 
+func (m *DeleteRdataRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type DeleteRdataResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -488,6 +536,7 @@ type UpdateRdataRequest struct {
 	Zone                 string   `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
 	OldRrset             *RRset   `protobuf:"bytes,2,opt,name=old_rrset,json=oldRrset,proto3" json:"old_rrset,omitempty"`
 	NewRrset             *RRset   `protobuf:"bytes,3,opt,name=new_rrset,json=newRrset,proto3" json:"new_rrset,omitempty"`
+	View                 string   `protobuf:"bytes,4,opt,name=view,proto3" json:"view,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -539,6 +588,13 @@ func (m *UpdateRdataRequest) GetNewRrset() *RRset {
 	return nil
 }
 
+func (m *UpdateRdataRequest) GetView() string {
+	if m != nil {
+		return m.View
+	}
+	return ""
+}
+
 type UpdateRdataResponse struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -590,36 +646,37 @@ func init() {
 func init() { proto.RegisterFile("dynamic_update_interface.proto", fileDescriptor_def07e43856809cb) }
 
 var fileDescriptor_def07e43856809cb = []byte{
-	// 464 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x94, 0x4f, 0x6b, 0xd4, 0x40,
-	0x18, 0xc6, 0x9b, 0x6e, 0xbb, 0x36, 0x6f, 0xea, 0x9f, 0x4e, 0xe3, 0x1a, 0x53, 0x91, 0x35, 0x20,
-	0xac, 0x0a, 0x7b, 0xa8, 0x57, 0xa1, 0x88, 0x2b, 0x56, 0x14, 0x84, 0x40, 0x2f, 0x5e, 0xc2, 0x98,
-	0x79, 0x85, 0x40, 0x76, 0x66, 0x4d, 0xa6, 0x14, 0x3d, 0x79, 0xf5, 0x5b, 0x4b, 0x66, 0x26, 0xc9,
-	0x4c, 0x13, 0x76, 0x2f, 0x3d, 0xed, 0x66, 0x9e, 0x37, 0xbf, 0xe7, 0x79, 0x77, 0x1e, 0x16, 0x9e,
-	0xb3, 0xdf, 0x9c, 0xae, 0x8b, 0x3c, 0xbb, 0xde, 0x30, 0x2a, 0x31, 0x2b, 0xb8, 0xc4, 0xea, 0x27,
-	0xcd, 0x71, 0xb9, 0xa9, 0x84, 0x14, 0x64, 0x9a, 0x97, 0x05, 0x72, 0x19, 0x07, 0x55, 0x55, 0xa3,
-	0xd4, 0x87, 0xc9, 0x27, 0x78, 0xf0, 0x9e, 0xb1, 0xef, 0x82, 0x63, 0x8a, 0xbf, 0xae, 0xb1, 0x96,
-	0x84, 0xc0, 0xc1, 0x1f, 0xc1, 0x31, 0xf2, 0xe6, 0xde, 0xc2, 0x4f, 0xd5, 0x77, 0xf2, 0x02, 0x8e,
-	0x9b, 0xcf, 0x2c, 0x17, 0x5c, 0x22, 0x97, 0xd1, 0xbe, 0xd2, 0x82, 0xe6, 0xec, 0x83, 0x3e, 0x4a,
-	0x4e, 0xe0, 0x61, 0x07, 0xaa, 0x37, 0x82, 0xd7, 0x98, 0xbc, 0x82, 0x93, 0x15, 0x96, 0x28, 0xd1,
-	0xc6, 0x87, 0x70, 0xd8, 0xbc, 0x56, 0x47, 0xde, 0x7c, 0xb2, 0xf0, 0x53, 0xfd, 0x90, 0x84, 0x40,
-	0xec, 0x51, 0x03, 0xf8, 0xaa, 0x98, 0x69, 0x5a, 0xa3, 0xdc, 0x96, 0xee, 0x25, 0x4c, 0xd5, 0x4a,
-	0x75, 0xb4, 0x3f, 0x9f, 0x2c, 0x82, 0xf3, 0xfb, 0x4b, 0xbd, 0xe9, 0x52, 0xbf, 0x69, 0xc4, 0x84,
-	0xc0, 0xa3, 0x9e, 0x66, 0x1c, 0x2e, 0xe0, 0x54, 0xfb, 0xae, 0xc4, 0x9a, 0x16, 0x7c, 0x9b, 0x4b,
-	0x08, 0x87, 0x9c, 0xae, 0x51, 0x9b, 0xf8, 0xa9, 0x7e, 0x48, 0x66, 0x10, 0xba, 0x00, 0x03, 0xbe,
-	0x6a, 0x17, 0xda, 0x99, 0xfe, 0xcd, 0xad, 0xf4, 0xa7, 0x4e, 0xfa, 0x4b, 0xa4, 0x0c, 0xab, 0x6e,
-	0x87, 0xc7, 0x6d, 0x5e, 0x77, 0x8d, 0x6f, 0x9d, 0x1b, 0xa3, 0x92, 0xde, 0xc1, 0x6f, 0xd5, 0xfb,
-	0x68, 0xa0, 0xf1, 0xf9, 0xeb, 0x01, 0xb9, 0x52, 0xed, 0xda, 0x69, 0xf4, 0x1a, 0x7c, 0x51, 0xb2,
-	0x4c, 0xf1, 0x54, 0x5f, 0x06, 0x5e, 0x47, 0xa2, 0x64, 0x69, 0x23, 0x37, 0xb3, 0x1c, 0x6f, 0xcc,
-	0xec, 0x64, 0x74, 0x96, 0xe3, 0x8d, 0x9a, 0x6d, 0x92, 0x39, 0x09, 0x74, 0xb2, 0xf3, 0x7f, 0x07,
-	0x30, 0x5b, 0xe9, 0xfe, 0x6b, 0xf9, 0x73, 0xdb, 0x7e, 0xf2, 0x0e, 0xee, 0x99, 0x66, 0x92, 0x59,
-	0x4b, 0x75, 0x3b, 0x1f, 0x3f, 0x19, 0x9c, 0x9b, 0x85, 0xf7, 0xc8, 0x47, 0x80, 0xbe, 0x99, 0xe4,
-	0x69, 0x3b, 0x38, 0x28, 0x76, 0x1c, 0x8f, 0x49, 0x1d, 0xe6, 0x02, 0x8e, 0xda, 0xf2, 0x11, 0xdb,
-	0xcd, 0xae, 0x47, 0x1c, 0x0d, 0x85, 0x0e, 0xf0, 0x05, 0x8e, 0xed, 0xa2, 0x91, 0x33, 0xd7, 0xce,
-	0xe9, 0x6f, 0xfc, 0x6c, 0x5c, 0xec, 0x60, 0x97, 0x10, 0x58, 0x35, 0x22, 0xb7, 0xa2, 0x3b, 0x99,
-	0xce, 0x46, 0xb5, 0x11, 0x52, 0x73, 0x1d, 0x03, 0x92, 0xd5, 0x92, 0x01, 0xc9, 0x69, 0x96, 0x22,
-	0x59, 0x17, 0xdb, 0x93, 0x86, 0x7d, 0xeb, 0x49, 0x23, 0x4d, 0x48, 0xf6, 0x7e, 0x4c, 0xd5, 0x5f,
-	0xdb, 0xdb, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff, 0xeb, 0x97, 0xe9, 0x0e, 0x11, 0x05, 0x00, 0x00,
+	// 480 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x54, 0x4d, 0x8f, 0xd3, 0x30,
+	0x10, 0xa5, 0x1f, 0x5b, 0xb6, 0xd3, 0xe5, 0x63, 0xbd, 0xa5, 0x84, 0x14, 0xa1, 0x52, 0x09, 0xa9,
+	0x02, 0xa9, 0x87, 0xe5, 0x0a, 0x42, 0x88, 0x22, 0x2d, 0xe2, 0x16, 0xc4, 0x05, 0x0e, 0xc5, 0xc4,
+	0x83, 0x14, 0xa9, 0xb5, 0x4b, 0xe2, 0xa5, 0x82, 0x7f, 0xc0, 0x9d, 0x1f, 0x8c, 0xfc, 0x95, 0xd8,
+	0x1b, 0xab, 0x7b, 0xda, 0x53, 0x13, 0xbf, 0x99, 0xf7, 0xe6, 0x39, 0x6f, 0x0a, 0x4f, 0xd8, 0x6f,
+	0x4e, 0xb7, 0x45, 0xbe, 0xbe, 0xdc, 0x31, 0x2a, 0x71, 0x5d, 0x70, 0x89, 0xe5, 0x0f, 0x9a, 0xe3,
+	0x72, 0x57, 0x0a, 0x29, 0xc8, 0x20, 0xdf, 0x14, 0xc8, 0x65, 0x3a, 0x2a, 0xcb, 0x0a, 0xa5, 0x39,
+	0x9c, 0x7f, 0x85, 0xbb, 0x6f, 0x19, 0xfb, 0x22, 0x38, 0x66, 0xf8, 0xf3, 0x12, 0x2b, 0x49, 0x08,
+	0xf4, 0xff, 0x08, 0x8e, 0x49, 0x67, 0xd6, 0x59, 0x0c, 0x33, 0xfd, 0x4c, 0x9e, 0xc2, 0x89, 0xfa,
+	0x5d, 0xe7, 0x82, 0x4b, 0xe4, 0x32, 0xe9, 0x6a, 0x6c, 0xa4, 0xce, 0xde, 0x99, 0x23, 0xd5, 0xf6,
+	0xab, 0xc0, 0x7d, 0xd2, 0x33, 0x6d, 0xea, 0x79, 0x7e, 0x0a, 0xf7, 0x6a, 0xf2, 0x6a, 0x27, 0x78,
+	0x85, 0xf3, 0xd7, 0x70, 0xba, 0xc2, 0x0d, 0x4a, 0xf4, 0x25, 0xc7, 0x70, 0xa4, 0xa8, 0xaa, 0xa4,
+	0x33, 0xeb, 0x2d, 0x86, 0x99, 0x79, 0xa9, 0x19, 0xbb, 0x1e, 0xe3, 0x18, 0x88, 0xdf, 0x6e, 0x49,
+	0xbf, 0x69, 0x9d, 0x2c, 0xab, 0x50, 0x1e, 0x72, 0xf1, 0x0c, 0x06, 0xda, 0x7a, 0x95, 0x74, 0x67,
+	0xbd, 0xc5, 0xe8, 0xfc, 0xce, 0xd2, 0xdc, 0xc8, 0xd2, 0x74, 0x5a, 0x30, 0xea, 0x84, 0xc0, 0xfd,
+	0x46, 0xc1, 0xaa, 0x7e, 0x82, 0x33, 0x33, 0xcb, 0x4a, 0x6c, 0x69, 0xc1, 0x0f, 0x29, 0x8f, 0xe1,
+	0x88, 0xd3, 0x2d, 0x1a, 0xe1, 0x61, 0x66, 0x5e, 0xa2, 0x42, 0x13, 0x18, 0x87, 0xa4, 0x56, 0xac,
+	0x70, 0xc6, 0xaf, 0x75, 0xf9, 0xe2, 0x8a, 0xcb, 0xb3, 0xc0, 0xe5, 0x05, 0x52, 0x86, 0xe5, 0x41,
+	0xaf, 0x0f, 0x9c, 0xaf, 0xd0, 0x6e, 0x5e, 0x4f, 0xc0, 0xa8, 0xa4, 0x37, 0x74, 0xcf, 0x8d, 0xb6,
+	0x11, 0xb1, 0xda, 0xff, 0x3a, 0x40, 0x3e, 0xeb, 0x54, 0x5f, 0x2b, 0xfe, 0x1c, 0x86, 0x62, 0xc3,
+	0xd6, 0x5a, 0x43, 0x47, 0xa7, 0xa5, 0x7f, 0x2c, 0x36, 0x2c, 0x53, 0xb0, 0xaa, 0xe5, 0xb8, 0xb7,
+	0xb5, 0xbd, 0x68, 0x2d, 0xc7, 0xbd, 0xa9, 0x75, 0xd3, 0xf6, 0xc3, 0x69, 0x83, 0xa9, 0xcc, 0xb4,
+	0xe7, 0x7f, 0xfb, 0x30, 0x59, 0x99, 0x5d, 0x34, 0xf0, 0x07, 0xb7, 0x89, 0xe4, 0x15, 0xdc, 0xb6,
+	0x1b, 0x41, 0x26, 0x4e, 0x29, 0xdc, 0xbf, 0xf4, 0x61, 0xeb, 0xdc, 0x5e, 0xc2, 0x2d, 0xf2, 0x1e,
+	0xa0, 0x49, 0x3f, 0x79, 0xe4, 0x0a, 0x5b, 0x0b, 0x95, 0xa6, 0x31, 0xa8, 0xa6, 0x79, 0x03, 0xc7,
+	0x2e, 0xcc, 0xc4, 0x57, 0xf3, 0xa3, 0x95, 0x26, 0x6d, 0xa0, 0x26, 0xf8, 0x08, 0x27, 0x7e, 0x48,
+	0xc9, 0x34, 0x94, 0x0b, 0xf6, 0x21, 0x7d, 0x1c, 0x07, 0x6b, 0xb2, 0x0b, 0x18, 0x79, 0x71, 0x23,
+	0x57, 0x46, 0x0f, 0x66, 0x9a, 0x46, 0xb1, 0x08, 0x93, 0xfa, 0x1c, 0x2d, 0x26, 0x2f, 0x39, 0xe9,
+	0x34, 0x8a, 0xf9, 0x4c, 0xde, 0x87, 0x6d, 0x98, 0xda, 0x19, 0x4c, 0xa7, 0x51, 0xcc, 0x31, 0x7d,
+	0x1f, 0xe8, 0xbf, 0xd9, 0x97, 0xff, 0x07, 0x00, 0x72, 0x86, 0x5c, 0x3e, 0x9d, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
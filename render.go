@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+
+	"github.com/zdnscloud/vanguard2-controller/config"
+	"github.com/zdnscloud/vanguard2-controller/controller"
+	"github.com/zdnscloud/vanguard2-controller/crd"
+	"github.com/zdnscloud/vanguard2-controller/memstore"
+	pb "github.com/zdnscloud/vanguard2-controller/proto"
+	"github.com/zdnscloud/vanguard2-controller/util"
+)
+
+func runRender(args []string) error {
+	var manifests, clusterDomainAliases, configFile string
+	var base config.Config
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.StringVar(&manifests, "f", "", "yaml or json manifest file, or directory of manifests")
+	fs.StringVar(&configFile, "config", "", "controller config file, it overrides the flags like the controller does")
+	fs.StringVar(&base.ClusterDomain, "cluster-domain", "cluster.local", "k8s cluster domain")
+	fs.StringVar(&clusterDomainAliases, "cluster-domain-aliases", "", "comma separated domains where records of cluster domain are published as well")
+	fs.StringVar(&base.ServiceIPRange, "service-ip-range", "", "comma separated networks of service ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&base.PodIPRange, "pod-ip-range", "", "comma separated networks of pod ip, each with 8, 16 or 24 bits mask")
+	fs.StringVar(&base.DNSServer, "dns-server", "", "k8s dns service address")
+	fs.BoolVar(&base.Features.WatchIngress, "ingress", false, "publish ingress hosts")
+	fs.StringVar(&base.IngressTarget, "ingress-target", "", "cname target for ingress hosts, use ingress load balancer ips if empty")
+	fs.BoolVar(&base.Features.WatchDNSResource, "dns-resource", false, "render DNSZone and DNSRecord resources")
+	fs.BoolVar(&base.Features.WatchPods, "pods", false, "publish pods with hostname and subdomain under headless services")
+	fs.Parse(args)
+
+	if manifests == "" {
+		return fmt.Errorf("manifests should be specified with -f")
+	}
+	base.ClusterDomainAliases = splitList(clusterDomainAliases)
+	cfg, err := loadConfigFile(configFile, base)
+	if err != nil {
+		return err
+	}
+
+	if err := crd.AddToScheme(scheme.Scheme); err != nil {
+		return err
+	}
+	objs, err := util.LoadObjects(manifests)
+	if err != nil {
+		return err
+	}
+
+	store := memstore.New()
+	client, err := newOfflineClient(store, cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := controller.NewOfflineController(client, objs, controllerOptions(cfg)); err != nil {
+		return err
+	}
+
+	for _, zone := range store.Zones(controller.DefaultView) {
+		content, err := store.ZoneString(controller.DefaultView, zone)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "; zone %s\n%s\n", zone, content)
+	}
+	return nil
+}
+
+// loadConfigFile overrides the fields of base with the controller config
+// file if it's specified, only the fields generating records are used, so
+// the config isn't validated
+func loadConfigFile(file string, base config.Config) (*config.Config, error) {
+	cfg := base
+	if file == "" {
+		return &cfg, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config failed:%s", err.Error())
+	}
+	return &cfg, nil
+}
+
+// newOfflineClient creates the client on backend with the zones and naming
+// of cfg, records aren't checked against owners
+func newOfflineClient(backend pb.DynamicUpdateInterfaceClient, cfg *config.Config) (*controller.VgClient, error) {
+	client, err := controller.NewVgClientWithBackend(backend, cfg.ClusterDomain, cfg.ServiceIPRange, cfg.PodIPRange, cfg.DNSServer, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SetNamingSchemes(cfg.Naming); err != nil {
+		return nil, err
+	}
+	if err := client.SetClusterDomainAliases(cfg.ClusterDomainAliases); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -35,6 +35,19 @@ func ReverseZoneName(network string) (*g53.Name, error) {
 	return g53.NameFromStringUnsafe(zone), nil
 }
 
+// ReverseZoneNames returns the reverse zones of comma separated networks
+func ReverseZoneNames(networks string) ([]*g53.Name, error) {
+	var zones []*g53.Name
+	for _, network := range strings.Split(networks, ",") {
+		zone, err := ReverseZoneName(strings.TrimSpace(network))
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
 func ReverseIPName(ip string) (*g53.Name, error) {
 	labels := strings.Split(ip, ".")
 	if len(labels) != 4 {
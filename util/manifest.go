@@ -0,0 +1,108 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// LoadObjects loads k8s objects from yaml or json file, or all such files
+// under the directory, list objects like the output of kubectl get -o yaml
+// are flattened
+func LoadObjects(path string) ([]runtime.Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() == false {
+		return loadObjectsFromFile(path)
+	}
+
+	var objs []runtime.Object
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		fileObjs, err := loadObjectsFromFile(p)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, fileObjs...)
+		return nil
+	})
+	return objs, err
+}
+
+func loadObjectsFromFile(path string) ([]runtime.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objs []runtime.Object
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse %s failed:%s", path, err.Error())
+		}
+
+		docObjs, err := decodeObjects(raw.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s failed:%s", path, err.Error())
+		}
+		objs = append(objs, docObjs...)
+	}
+	return objs, nil
+}
+
+func decodeObjects(data []byte) ([]runtime.Object, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []runtime.RawExtension
+	switch list := obj.(type) {
+	case *corev1.List:
+		items = list.Items
+	case *metav1.List:
+		items = list.Items
+	default:
+		return []runtime.Object{obj}, nil
+	}
+
+	var objs []runtime.Object
+	for _, item := range items {
+		itemObjs, err := decodeObjects(item.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, itemObjs...)
+	}
+	return objs, nil
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+const (
+	QueryUDPSize = 4096
+)
+
+// Query sends the query with the view option if view isn't empty, so the
+// server answers from the view instead of the one matching the client
+func Query(server, view string, name *g53.Name, typ g53.RRType, timeout time.Duration) (*g53.Message, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query := g53.MakeQuery(name, typ, QueryUDPSize, false)
+	setView(query, view)
+	render := g53.NewMsgRender()
+	query.Rend(render)
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(render.Data()); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, QueryUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g53.MessageFromWire(util.NewInputBuffer(buf[:n]))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Id != query.Header.Id {
+		return nil, fmt.Errorf("response id %d doesn't match query id %d", resp.Header.Id, query.Header.Id)
+	}
+	return resp, nil
+}
+
+// return the rrset in answer section with the name and type of question, nil if not found
+func QueryRRset(server, view string, name *g53.Name, typ g53.RRType, timeout time.Duration) (*g53.RRset, error) {
+	resp, err := Query(server, view, name, typ, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.Header.Rcode {
+	case g53.R_NOERROR, g53.R_NXDOMAIN:
+	default:
+		return nil, fmt.Errorf("query %s %s get %s", name.String(false), typ.String(), resp.Header.Rcode.String())
+	}
+
+	for _, rrset := range resp.GetSection(g53.AnswerSection) {
+		if rrset.Type == typ && rrset.Name.Equals(name) {
+			return rrset, nil
+		}
+	}
+	return nil, nil
+}
+
+func setView(msg *g53.Message, view string) {
+	if view == "" {
+		return
+	}
+	if msg.Edns == nil {
+		msg.Edns = &g53.EDNS{UdpSize: QueryUDPSize}
+		msg.Header.ARCount += 1
+	}
+	msg.Edns.AddSubnetView(view)
+}
@@ -0,0 +1,10 @@
+package util
+
+func HasString(ss []string, s string) bool {
+	for _, s_ := range ss {
+		if s_ == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/zdnscloud/g53"
+	"github.com/zdnscloud/g53/util"
+)
+
+// AXFR transfers the zone in view from server, the returned rrsets don't
+// include the trailing soa, tsig is optional
+func AXFR(server, view string, zone *g53.Name, tsig *g53.TSIG) ([]*g53.RRset, error) {
+	conn, err := util.NewTCPConn(server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query := g53.MakeAXFR(zone, tsig)
+	setView(query, view)
+	render := g53.NewMsgRender()
+	query.Rend(render)
+	if err := util.TCPWrite(render.Data(), conn); err != nil {
+		return nil, err
+	}
+
+	var rrsets []*g53.RRset
+	index := make(map[string]int)
+	soaCount := 0
+	for soaCount < 2 {
+		data, err := util.TCPRead(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := g53.MessageFromWire(util.NewInputBuffer(data))
+		if err != nil {
+			return nil, err
+		}
+		if resp.Header.Rcode != g53.R_NOERROR {
+			return nil, fmt.Errorf("transfer zone %s get %s", zone.String(false), resp.Header.Rcode.String())
+		}
+
+		answers := resp.GetSection(g53.AnswerSection)
+		if len(answers) == 0 {
+			return nil, fmt.Errorf("transfer zone %s get empty answer", zone.String(false))
+		}
+		for _, rrset := range answers {
+			if rrset.Type == g53.RR_SOA {
+				soaCount += 1
+				if soaCount > 1 {
+					break
+				}
+			}
+
+			key := rrset.Name.String(false) + "/" + rrset.Type.String()
+			if i, ok := index[key]; ok {
+				for _, rdata := range rrset.Rdatas {
+					rrsets[i].AddRdata(rdata)
+				}
+			} else {
+				index[key] = len(rrsets)
+				rrsets = append(rrsets, rrset)
+			}
+		}
+
+		if len(rrsets) == 0 || rrsets[0].Type != g53.RR_SOA {
+			return nil, fmt.Errorf("transfer zone %s doesn't start with soa", zone.String(false))
+		}
+	}
+	return rrsets, nil
+}